@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/traves/linesense/internal/config"
+	"github.com/traves/linesense/internal/core"
+)
+
+// runAudit handles the audit log subcommands
+func runAudit(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("audit subcommand required (verify, export, record)")
+	}
+
+	switch args[0] {
+	case "verify":
+		return runAuditVerify(args[1:])
+	case "export":
+		return runAuditExport(args[1:])
+	case "record":
+		return runAuditRecord(args[1:])
+	default:
+		return fmt.Errorf("unknown audit subcommand: %s", args[0])
+	}
+}
+
+// runAuditVerify checks the audit log's hash chain
+func runAuditVerify(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path := core.AuditLogPath()
+	records, err := core.ReadAuditLog()
+	if err == nil {
+		err = core.VerifyAuditLog(records)
+	}
+	if err != nil {
+		return fmt.Errorf("%s is not intact: %w", path, err)
+	}
+
+	if len(records) == 0 {
+		fmt.Printf("No audit records in %s\n", path)
+		return nil
+	}
+	last := records[len(records)-1]
+	fmt.Printf("%s is intact: %d records\n", path, len(records))
+	fmt.Printf("  Last record: %s\n", last.Timestamp)
+	fmt.Printf("  Last hash:   %s\n", last.Hash)
+	return nil
+}
+
+// runAuditExport prints the audit log as JSON or CSV
+func runAuditExport(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("audit export", flag.ExitOnError)
+	format := fs.String("format", "json", "Output format: json or csv")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown format %q (want json or csv)", *format)
+	}
+
+	records, err := core.ReadAuditLog()
+	if err != nil {
+		return err
+	}
+
+	// Export anyway, but say so when the log has been tampered with
+	if err := core.VerifyAuditLog(records); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not intact: %v\n", core.AuditLogPath(), err)
+	}
+
+	if *format == "json" {
+		if records == nil {
+			records = []core.AuditRecord{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	}
+
+	writer := csv.NewWriter(os.Stdout)
+	writer.Write([]string{"seq", "timestamp", "user", "host", "cwd", "command", "action", "policy", "risk", "findings", "model", "prev_hash", "hash"})
+	for _, record := range records {
+		var findings []string
+		for _, finding := range record.Findings {
+			findings = append(findings, fmt.Sprintf("%s (%s): %s", finding.Rule, finding.Severity, finding.Reason))
+		}
+		writer.Write([]string{
+			strconv.Itoa(record.Seq), record.Timestamp, record.User, record.Host, record.CWD, record.Command,
+			record.Action, record.Policy, string(record.Risk), strings.Join(findings, "; "), record.Model,
+			record.PrevHash, record.Hash,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// runAuditRecord records the first suggestion in linesense JSON output, read
+// from stdin, as accepted, along with the overrides that loosened it. The
+// shell integrations call it once they have put the suggestion on the
+// command line.
+func runAuditRecord(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("audit record", flag.ExitOnError)
+	cwd := fs.String("cwd", "", "Working directory the suggestion was accepted in")
+	model := fs.String("model", "", "Model the suggestion came from (default: configured)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var output struct {
+		Suggestions []core.Suggestion `json:"suggestions"`
+	}
+	if err := json.NewDecoder(os.Stdin).Decode(&output); err != nil {
+		return fmt.Errorf("failed to read suggestions: %w", err)
+	}
+	if len(output.Suggestions) == 0 {
+		return fmt.Errorf("no suggestion to record")
+	}
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if *cwd == "" {
+		*cwd, _ = os.Getwd()
+	}
+	return auditSuggestion(core.AuditAccepted, "", output.Suggestions[0], *cwd, *model, cfg)
+}
+
+// auditSuggestion logs the overrides that loosened suggestion, and appends
+// it to the audit log when it is medium or high risk. Callers act on the
+// suggestion only once it has been logged.
+func auditSuggestion(action, policy string, suggestion core.Suggestion, cwd, model string, cfg *config.Config) error {
+	if err := core.LogOverrides(suggestion.Overrides); err != nil {
+		return err
+	}
+	if !core.ShouldAudit(suggestion.Risk) {
+		return nil
+	}
+	if suggestion.Source == "preset" {
+		model = ""
+	} else {
+		model = modelFor(cfg, model)
+	}
+
+	_, err := core.LogAudit(core.AuditRecord{
+		CWD:      cwd,
+		Command:  suggestion.Command,
+		Action:   action,
+		Policy:   policy,
+		Risk:     suggestion.Risk,
+		Findings: suggestion.Findings,
+		Model:    model,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// modelFor returns the model suggestions come from: override when it is set,
+// otherwise the configured provider profile's model
+func modelFor(cfg *config.Config, override string) string {
+	if override != "" {
+		return override
+	}
+	providersCfg, err := config.LoadProvidersConfig()
+	if err != nil {
+		return ""
+	}
+	profile, err := providersCfg.GetProfile(cfg.AI.ProviderProfile)
+	if err != nil {
+		return ""
+	}
+	return profile.Model
+}
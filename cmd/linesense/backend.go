@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/traves/linesense/internal/ai"
+	"github.com/traves/linesense/internal/config"
+	"github.com/traves/linesense/internal/core"
+	"github.com/traves/linesense/internal/server"
+)
+
+// backend generates suggestions, explanations, fixes and completions, either
+// through the daemon or in this process
+type backend interface {
+	Suggest(ctx context.Context, input core.SuggestInput) ([]core.Suggestion, error)
+	Explain(ctx context.Context, input core.ExplainInput) (core.Explanation, error)
+	Fix(ctx context.Context, input core.FixInput) ([]core.Suggestion, error)
+	Complete(ctx context.Context, input core.CompleteInput) (core.Completion, error)
+}
+
+// newBackend returns a client for the running daemon, or an in-process engine
+// when no daemon of this version is running or LINESENSE_NO_DAEMON=1.
+// Collector timings are only available in process, so passing onCollect
+// skips the daemon.
+func newBackend(cfg *config.Config, onCollect func([]core.CollectorTiming)) backend {
+	if onCollect == nil && os.Getenv("LINESENSE_NO_DAEMON") != "1" {
+		if client, err := server.Dial(server.SocketPath(), version); err == nil {
+			return &daemonBackend{client: client, cfg: cfg}
+		}
+	}
+	return newEngine(cfg, onCollect)
+}
+
+// newEngine returns an in-process engine for cfg
+func newEngine(cfg *config.Config, onCollect func([]core.CollectorTiming)) *core.Engine {
+	engine := core.NewEngine(cfg, ai.LoadProvider(cfg.AI.ProviderProfile))
+	if onCollect != nil {
+		engine.OnCollect(onCollect)
+	}
+	return engine
+}
+
+// daemonBackend calls the daemon, and retries a call in process once when
+// the daemon gave no usable answer, for example because it stopped after
+// Dial
+type daemonBackend struct {
+	client *server.Client
+	cfg    *config.Config
+}
+
+func (b *daemonBackend) Suggest(ctx context.Context, input core.SuggestInput) ([]core.Suggestion, error) {
+	return withFallback(b, func(be backend) ([]core.Suggestion, error) { return be.Suggest(ctx, input) })
+}
+
+func (b *daemonBackend) Explain(ctx context.Context, input core.ExplainInput) (core.Explanation, error) {
+	return withFallback(b, func(be backend) (core.Explanation, error) { return be.Explain(ctx, input) })
+}
+
+func (b *daemonBackend) Fix(ctx context.Context, input core.FixInput) ([]core.Suggestion, error) {
+	return withFallback(b, func(be backend) ([]core.Suggestion, error) { return be.Fix(ctx, input) })
+}
+
+func (b *daemonBackend) Complete(ctx context.Context, input core.CompleteInput) (core.Completion, error) {
+	return withFallback(b, func(be backend) (core.Completion, error) { return be.Complete(ctx, input) })
+}
+
+// withFallback runs call against the daemon, and against an in-process
+// engine if the daemon was unavailable
+func withFallback[T any](b *daemonBackend, call func(backend) (T, error)) (T, error) {
+	result, err := call(b.client)
+	var unavailable *server.UnavailableError
+	if errors.As(err, &unavailable) {
+		return call(newEngine(b.cfg, nil))
+	}
+	return result, err
+}
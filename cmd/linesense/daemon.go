@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/traves/linesense/internal/server"
+)
+
+// runDaemon runs the background daemon, or controls a running one with the
+// status and stop subcommands
+func runDaemon(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "status":
+			return runDaemonStatus(args[1:])
+		case "stop":
+			return runDaemonStop(args[1:])
+		}
+	}
+
+	// Parse flags
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	socket := fs.String("socket", server.SocketPath(), "Unix socket to listen on")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	listener, err := server.Listen(*socket)
+	if err != nil {
+		return err
+	}
+
+	// Stop cleanly on Ctrl+C or when the service manager stops us
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "linesense daemon listening on %s\n", *socket)
+	return server.Serve(ctx, listener, server.NewService(version))
+}
+
+// runDaemonStatus prints information about the running daemon
+func runDaemonStatus(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("daemon status", flag.ExitOnError)
+	socket := fs.String("socket", server.SocketPath(), "Unix socket of the daemon")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := server.Dial(*socket, "")
+	if err != nil {
+		fmt.Printf("Daemon is not running (%s)\n", *socket)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get daemon status: %w", err)
+	}
+
+	fmt.Printf("Daemon is running (%s)\n", *socket)
+	fmt.Printf("  Version:  %s\n", status.Version)
+	fmt.Printf("  PID:      %d\n", status.PID)
+	fmt.Printf("  Uptime:   %s\n", status.Uptime)
+	fmt.Printf("  Requests: %d\n", status.Requests)
+	fmt.Printf("  Cached:   %d responses\n", status.CacheEntries)
+	if status.Version != version {
+		fmt.Printf("\nThe daemon is running version %s but this is %s; restart it with `linesense daemon stop`.\n", status.Version, version)
+	}
+	return nil
+}
+
+// runDaemonStop asks the running daemon to exit
+func runDaemonStop(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("daemon stop", flag.ExitOnError)
+	socket := fs.String("socket", server.SocketPath(), "Unix socket of the daemon")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := server.Dial(*socket, "")
+	if err != nil {
+		return fmt.Errorf("daemon is not running on %s", *socket)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to stop daemon: %w", err)
+	}
+
+	fmt.Println("Daemon stopped")
+	return nil
+}
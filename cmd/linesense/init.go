@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/traves/linesense/internal/config"
+	"github.com/traves/linesense/scripts"
+)
+
+// runInit prints the shell integration script with the keybindings from
+// config.toml, for use as eval "$(linesense init zsh)"
+func runInit(args []string) error {
+	shell := detectShell()
+	if len(args) > 0 {
+		shell = args[0]
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("usage: linesense init [bash|zsh|fish]")
+	}
+
+	// A missing config just means default keybindings
+	var keys config.KeybindingsConfig
+	cfg, err := config.LoadConfig()
+	switch {
+	case err == nil:
+		keys = cfg.Keybindings
+	case !errors.Is(err, os.ErrNotExist):
+		fmt.Fprintf(os.Stderr, "linesense: %v; using default keybindings\n", err)
+	}
+
+	script, err := scripts.Generate(shell, keys, func(err error) {
+		fmt.Fprintf(os.Stderr, "linesense: %v; using the default keybinding\n", err)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(script)
+	return err
+}
@@ -3,15 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/traves/linesense/internal/ai"
 	"github.com/traves/linesense/internal/config"
 	"github.com/traves/linesense/internal/core"
 )
@@ -28,6 +30,11 @@ func main() {
 	}
 
 	if err := run(); err != nil {
+		// linesense run exits with the status of the command it ran
+		var exitErr *commandExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -56,8 +63,22 @@ func run() error {
 		return runSuggest(os.Args[2:])
 	case "explain":
 		return runExplain(os.Args[2:])
+	case "fix":
+		return runFix(os.Args[2:])
+	case "complete":
+		return runComplete(os.Args[2:])
+	case "run":
+		return runRun(os.Args[2:])
+	case "init":
+		return runInit(os.Args[2:])
+	case "daemon":
+		return runDaemon(os.Args[2:])
+	case "serve":
+		return runServe(os.Args[2:])
 	case "config":
 		return runConfig(os.Args[2:])
+	case "audit":
+		return runAudit(os.Args[2:])
 	case "update":
 		return runUpdate()
 	case "version", "--version", "-v":
@@ -79,6 +100,14 @@ Usage:
   linesense config [subcommand]  Configure LineSense
   linesense suggest [flags]      Generate command suggestions
   linesense explain [flags]      Explain a command
+  linesense fix [flags]          Fix the last failed command
+  linesense complete [flags]     Print a completion suffix for the current line
+  linesense run [flags]          Suggest a command and print, confirm or run it
+  linesense init [shell]         Print the shell integration (bash, zsh, fish)
+  linesense daemon [subcommand]  Run the background daemon (status, stop)
+  linesense audit [subcommand]   Work with the audit log (verify, export, record)
+  linesense serve --stdio        Serve JSON-RPC 2.0 on stdin/stdout for editors
+  linesense serve --http ADDR    Serve the HTTP API (POST /v1/suggest, /v1/explain)
   linesense update               Update LineSense to the latest version
   linesense version              Show version information
   linesense help                 Show this help message
@@ -92,24 +121,90 @@ Config Subcommands:
   show            Display current configuration
 
 Suggest Flags:
-  --shell string     Shell type (bash, zsh) (default: auto-detect)
+  --shell string     Shell type (bash, zsh, fish) (default: auto-detect)
   --line string      Partial command line to complete (required)
   --cwd string       Current working directory (default: current directory)
   --model string     Override model ID from config
   --format string    Output format: pretty or json (default: pretty)
+  --timings          Show how long each context collector took (on stderr)
+  --histfile string  Shell history file (default: $HISTFILE or the shell's default)
+  --interactive      Pick a suggestion (arrows/1-9, e to edit) and print it on stdout
 
 Explain Flags:
-  --shell string     Shell type (bash, zsh) (default: auto-detect)
+  --shell string     Shell type (bash, zsh, fish) (default: auto-detect)
   --line string      Command to explain (required)
   --cwd string       Current working directory (default: current directory)
   --model string     Override model ID from config
   --format string    Output format: pretty or json (default: pretty)
+  --timings          Show how long each context collector took (on stderr)
+  --histfile string  Shell history file (default: $HISTFILE or the shell's default)
+
+Fix Flags:
+  --line string         Failed command to fix (default: last failed command in LineSense history)
+  --exit-code int       Exit code of the failed command (default: from history)
+  --stderr-file string  File with the command's error output (- for stdin)
+  --shell string        Shell type (bash, zsh, fish) (default: auto-detect)
+  --cwd string          Current working directory (default: current directory)
+  --model string        Override model ID from config
+  --format string       Output format: pretty or json (default: pretty)
+  --timings             Show how long each context collector took (on stderr)
+  --histfile string     Shell history file (default: $HISTFILE or the shell's default)
+  --interactive         Pick a fix (arrows/1-9, e to edit) and print it on stdout
+
+Complete Flags:
+  --line string      Partial command line to complete (required)
+  --shell string     Shell type (bash, zsh, fish) (default: auto-detect)
+  --cwd string       Current working directory (default: current directory)
+  --model string     Override model ID from config
+  --format string    Output format: text or json (default: text)
+  --histfile string  Shell history file (default: $HISTFILE or the shell's default)
+  --timeout duration Give up after this long (default: 5s)
+
+Run Flags:
+  --line string      What to do, or a partial command line (required)
+  --policy string    paste_only, confirm, confirm_high_risk or auto_low_risk
+                     (default: safety.default_execution, or paste_only)
+  --shell string     Shell to run the command with (bash, zsh, fish) (default: auto-detect)
+  --cwd string       Directory to run the command in (default: current directory)
+  --model string     Override model ID from config
+  --histfile string  Shell history file (default: $HISTFILE or the shell's default)
+  --interactive      Pick the suggestion (arrows/1-9, e to edit) instead of taking the first
+  --preview          Run the command's dry run (rsync -n, terraform plan, ...) first
+
+  Commands matching safety.denylist are never run, whatever the policy.
+
+Audit Subcommands:
+  verify          Check the audit log's hash chain
+  export          Print the audit log (--format json or csv, default: json)
+  record          Record the first suggestion in JSON on stdin as accepted
+                  (--cwd, --model); used by the shell integrations
+
+  Medium- and high-risk commands picked, put on the command line, confirmed or
+  run are recorded in ~/.config/linesense/audit.jsonl.
+
+Daemon Flags:
+  --socket string    Unix socket path (default: $XDG_RUNTIME_DIR/linesense.sock)
+
+  While the daemon runs, suggest, explain, fix and complete use it
+  automatically. Set LINESENSE_NO_DAEMON=1 to always work in process.
+
+Shell Integration:
+  eval "$(linesense init bash)"     # ~/.bashrc
+  eval "$(linesense init zsh)"      # ~/.zshrc
+  linesense init fish | source      # ~/.config/fish/config.fish
+
+  Keybindings come from [keybindings] in config.toml, e.g. suggest = "ctrl+space",
+  explain = "ctrl+x ctrl+e", fix = "ctrl+x ctrl+f", alternatives = "alt+a".
 
 Examples:
   linesense suggest --line "list files"
   linesense explain --line "rm -rf /"
   linesense suggest --line "git com" --shell bash
+  linesense suggest --line "find big files" --interactive
   linesense explain --line "docker ps -a" --model gpt-4
+  linesense fix
+  linesense run --line "show disk usage" --policy auto_low_risk
+  make 2>&1 | linesense fix --line make --stderr-file -
 
 Configuration:
   Config files: ~/.config/linesense/config.toml
@@ -120,11 +215,14 @@ Configuration:
 func runSuggest(args []string) error {
 	// Parse flags
 	fs := flag.NewFlagSet("suggest", flag.ExitOnError)
-	shell := fs.String("shell", "", "Shell type (bash, zsh)")
+	shell := fs.String("shell", "", "Shell type (bash, zsh, fish)")
 	line := fs.String("line", "", "Partial command line to complete")
 	cwd := fs.String("cwd", "", "Current working directory")
 	model := fs.String("model", "", "Override model ID from config")
 	format := fs.String("format", "pretty", "Output format: json or pretty")
+	timings := fs.Bool("timings", false, "Show how long each context collector took")
+	histFile := fs.String("histfile", "", "Shell history file (default: $HISTFILE or the shell's default)")
+	interactive := fs.Bool("interactive", false, "Pick a suggestion interactively and print it")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -155,22 +253,17 @@ func runSuggest(args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	providersCfg, err := config.LoadProvidersConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load providers config: %w", err)
+	// Use the daemon if it is running, otherwise work in this process
+	var collectorTimings []core.CollectorTiming
+	var onCollect func([]core.CollectorTiming)
+	if *timings {
+		onCollect = func(t []core.CollectorTiming) { collectorTimings = t }
 	}
+	backend := newBackend(cfg, onCollect)
 
-	// Create provider
-	provider, err := ai.NewProvider(providersCfg, cfg.AI.ProviderProfile)
-	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
-	}
-
-	// Build context
-	contextEnv, err := core.BuildContext(*shell, *line, *cwd, cfg)
-	if err != nil {
-		return fmt.Errorf("failed to build context: %w", err)
-	}
+	// Build context; the backend collects the rest
+	contextEnv := &core.ContextEnvelope{Shell: *shell, Line: *line, CWD: *cwd, HistFile: *histFile}
+	core.PrepareEnvelope(contextEnv, cfg)
 
 	// Create suggest input
 	input := core.SuggestInput{
@@ -183,13 +276,20 @@ func runSuggest(args []string) error {
 	var suggestions []core.Suggestion
 	err = withSpinner("Generating suggestions...", func(ctx context.Context) error {
 		var err error
-		suggestions, err = provider.Suggest(ctx, input)
+		suggestions, err = backend.Suggest(ctx, input)
 		return err
 	})
+	if *timings {
+		printTimingsStyled(collectorTimings)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to generate suggestions: %w", err)
 	}
 
+	if *interactive {
+		return pickSuggestion(suggestions, backend, contextEnv, *model, cfg, *format)
+	}
+
 	// Output based on format
 	if *format == "json" {
 		output := map[string]interface{}{
@@ -208,11 +308,13 @@ func runSuggest(args []string) error {
 func runExplain(args []string) error {
 	// Parse flags
 	fs := flag.NewFlagSet("explain", flag.ExitOnError)
-	shell := fs.String("shell", "", "Shell type (bash, zsh)")
+	shell := fs.String("shell", "", "Shell type (bash, zsh, fish)")
 	line := fs.String("line", "", "Command to explain")
 	cwd := fs.String("cwd", "", "Current working directory")
 	model := fs.String("model", "", "Override model ID from config")
 	format := fs.String("format", "pretty", "Output format: json or pretty")
+	timings := fs.Bool("timings", false, "Show how long each context collector took")
+	histFile := fs.String("histfile", "", "Shell history file (default: $HISTFILE or the shell's default)")
 
 	if err := fs.Parse(args); err != nil {
 		return err
@@ -243,22 +345,17 @@ func runExplain(args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	providersCfg, err := config.LoadProvidersConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load providers config: %w", err)
-	}
-
-	// Create provider
-	provider, err := ai.NewProvider(providersCfg, cfg.AI.ProviderProfile)
-	if err != nil {
-		return fmt.Errorf("failed to create provider: %w", err)
+	// Use the daemon if it is running, otherwise work in this process
+	var collectorTimings []core.CollectorTiming
+	var onCollect func([]core.CollectorTiming)
+	if *timings {
+		onCollect = func(t []core.CollectorTiming) { collectorTimings = t }
 	}
+	backend := newBackend(cfg, onCollect)
 
-	// Build context
-	contextEnv, err := core.BuildContext(*shell, *line, *cwd, cfg)
-	if err != nil {
-		return fmt.Errorf("failed to build context: %w", err)
-	}
+	// Build context; the backend collects the rest
+	contextEnv := &core.ContextEnvelope{Shell: *shell, Line: *line, CWD: *cwd, HistFile: *histFile}
+	core.PrepareEnvelope(contextEnv, cfg)
 
 	// Create explain input
 	input := core.ExplainInput{
@@ -271,9 +368,12 @@ func runExplain(args []string) error {
 	var explanation core.Explanation
 	err = withSpinner("Analyzing command...", func(ctx context.Context) error {
 		var err error
-		explanation, err = provider.Explain(ctx, input)
+		explanation, err = backend.Explain(ctx, input)
 		return err
 	})
+	if *timings {
+		printTimingsStyled(collectorTimings)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to generate explanation: %w", err)
 	}
@@ -286,10 +386,280 @@ func runExplain(args []string) error {
 	}
 
 	// Pretty format (default) with styled output
-	printExplanationStyled(explanation)
+	printExplanationStyled(*line, explanation)
+	return nil
+}
+
+// fixHistoryLookback is how many recorded commands `fix` searches for the
+// last failure
+const fixHistoryLookback = 50
+
+func runFix(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("fix", flag.ExitOnError)
+	shell := fs.String("shell", "", "Shell type (bash, zsh, fish)")
+	line := fs.String("line", "", "Failed command to fix (default: last failed command)")
+	exitCode := fs.Int("exit-code", 0, "Exit code of the failed command")
+	stderrFile := fs.String("stderr-file", "", "File with the command's error output (- for stdin)")
+	cwd := fs.String("cwd", "", "Current working directory")
+	model := fs.String("model", "", "Override model ID from config")
+	format := fs.String("format", "pretty", "Output format: json or pretty")
+	timings := fs.Bool("timings", false, "Show how long each context collector took")
+	histFile := fs.String("histfile", "", "Shell history file (default: $HISTFILE or the shell's default)")
+	interactive := fs.Bool("interactive", false, "Pick a fix interactively and print it")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Default to the last failed command recorded by the shell hooks
+	if *line == "" {
+		history, err := core.CollectManagedHistory(*shell, fixHistoryLookback)
+		if err != nil {
+			return fmt.Errorf("failed to read command history: %w", err)
+		}
+		failed, ok := core.LastFailedCommand(history)
+		if !ok {
+			return fmt.Errorf("no failed command found in %s; pass the command with --line", core.ManagedHistoryPath())
+		}
+		*line = failed.Command
+		if *exitCode == 0 {
+			*exitCode = *failed.ExitCode
+		}
+	}
+
+	// Read captured error output if provided
+	var stderr string
+	if *stderrFile != "" {
+		var data []byte
+		var err error
+		if *stderrFile == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(*stderrFile)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read error output: %w", err)
+		}
+		stderr = string(data)
+	}
+
+	// Auto-detect shell if not provided
+	if *shell == "" {
+		*shell = detectShell()
+	}
+
+	// Use current directory if not provided
+	if *cwd == "" {
+		var err error
+		*cwd, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use the daemon if it is running, otherwise work in this process
+	var collectorTimings []core.CollectorTiming
+	var onCollect func([]core.CollectorTiming)
+	if *timings {
+		onCollect = func(t []core.CollectorTiming) { collectorTimings = t }
+	}
+	backend := newBackend(cfg, onCollect)
+
+	// Build context; the backend collects the rest
+	contextEnv := &core.ContextEnvelope{Shell: *shell, Line: *line, CWD: *cwd, HistFile: *histFile}
+	core.PrepareEnvelope(contextEnv, cfg)
+
+	// Create fix input
+	input := core.FixInput{
+		ModelID:  *model,
+		Command:  *line,
+		ExitCode: *exitCode,
+		Stderr:   stderr,
+		Context:  contextEnv,
+	}
+
+	// Generate fixes with spinner
+	var suggestions []core.Suggestion
+	err = withSpinner("Fixing command...", func(ctx context.Context) error {
+		var err error
+		suggestions, err = backend.Fix(ctx, input)
+		return err
+	})
+	if *timings {
+		printTimingsStyled(collectorTimings)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate fixes: %w", err)
+	}
+
+	if *interactive {
+		return pickSuggestion(suggestions, backend, contextEnv, *model, cfg, *format)
+	}
+
+	// Output based on format
+	if *format == "json" {
+		output := map[string]interface{}{
+			"command":     *line,
+			"suggestions": suggestions,
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	}
+
+	// Pretty format (default) with styled output
+	printSuggestionsStyled(suggestions)
+	return nil
+}
+
+func runComplete(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("complete", flag.ExitOnError)
+	shell := fs.String("shell", "", "Shell type (bash, zsh, fish)")
+	line := fs.String("line", "", "Partial command line to complete")
+	cwd := fs.String("cwd", "", "Current working directory")
+	model := fs.String("model", "", "Override model ID from config")
+	format := fs.String("format", "text", "Output format: text or json")
+	histFile := fs.String("histfile", "", "Shell history file (default: $HISTFILE or the shell's default)")
+	timeout := fs.Duration("timeout", 5*time.Second, "Give up after this long")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Validate required flags
+	if *line == "" {
+		return fmt.Errorf("--line flag is required")
+	}
+
+	// Auto-detect shell if not provided
+	if *shell == "" {
+		*shell = detectShell()
+	}
+
+	// Use current directory if not provided
+	if *cwd == "" {
+		var err error
+		*cwd, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use the daemon if it is running, otherwise work in this process
+	backend := newBackend(cfg, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// Build context; the backend collects the rest
+	contextEnv := &core.ContextEnvelope{Shell: *shell, Line: *line, CWD: *cwd, HistFile: *histFile}
+	core.PrepareEnvelope(contextEnv, cfg)
+
+	completion, err := backend.Complete(ctx, core.CompleteInput{ModelID: *model, Context: contextEnv})
+	if err != nil {
+		return fmt.Errorf("failed to generate completion: %w", err)
+	}
+
+	// Output based on format
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(completion)
+	}
+
+	if completion.Suffix != "" {
+		fmt.Println(completion.Suffix)
+	}
+	return nil
+}
+
+// pickSuggestion runs the interactive picker and prints the chosen command on
+// stdout, or as a single-element suggestions list with --format json. Nothing
+// is printed if the user cancels.
+func pickSuggestion(suggestions []core.Suggestion, backend backend, contextEnv *core.ContextEnvelope, model string, cfg *config.Config, format string) error {
+	chosen, ok, err := chooseSuggestion(suggestions, backend, contextEnv, model, cfg)
+	if err != nil || !ok {
+		return err
+	}
+
+	// Output based on format
+	if format == "json" {
+		output := map[string]interface{}{
+			"suggestions": []core.Suggestion{chosen},
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	}
+
+	fmt.Println(chosen.Command)
 	return nil
 }
 
+// chooseSuggestion runs the interactive picker and returns the chosen
+// suggestion, classified again with the files it affects counted, and
+// recorded in the audit log if it is medium or high risk. ok is false if the
+// user cancels.
+func chooseSuggestion(suggestions []core.Suggestion, backend backend, contextEnv *core.ContextEnvelope, model string, cfg *config.Config) (core.Suggestion, bool, error) {
+	if len(suggestions) == 0 {
+		return core.Suggestion{}, false, fmt.Errorf("no suggestions found")
+	}
+
+	// Explain highlighted suggestions with the same context as the request
+	explain := func(ctx context.Context, command string) (core.Explanation, error) {
+		explainEnv := *contextEnv
+		explainEnv.Line = command
+		return backend.Explain(ctx, core.ExplainInput{
+			ModelID: model,
+			Prompt:  command,
+			Context: &explainEnv,
+		})
+	}
+
+	result, err := runPicker(suggestions, explain)
+	if err != nil {
+		return core.Suggestion{}, false, err
+	}
+	if result.Canceled {
+		return core.Suggestion{}, false, nil
+	}
+
+	chosen := suggestions[result.Index]
+	classifyChosen(&chosen, contextEnv, cfg)
+	if result.Edited {
+		chosen.Command = result.Command
+		classifyChosen(&chosen, contextEnv, cfg)
+		chosen.Preview = core.PreviewFor(chosen, &cfg.Safety)
+		core.ApplyUndoRules(&chosen, contextEnv.CWD, &cfg.Safety)
+	}
+	if err := auditSuggestion(core.AuditAccepted, "", chosen, contextEnv.CWD, model, cfg); err != nil {
+		return core.Suggestion{}, false, err
+	}
+	return chosen, true, nil
+}
+
+// classifyChosen classifies the suggestion that is about to be used again,
+// counting the files it affects, which suggestions are classified without
+func classifyChosen(chosen *core.Suggestion, contextEnv *core.ContextEnvelope, cfg *config.Config) {
+	input := core.NewRiskInput(chosen.Command, contextEnv)
+	input.CountTargets = true
+	chosen.Risk, chosen.Findings, chosen.Overrides = core.DefaultRiskChain(&cfg.Safety).ClassifyOverrides(context.Background(), input)
+}
+
 // detectShell attempts to auto-detect the current shell
 func detectShell() string {
 	// Try SHELL environment variable
@@ -297,6 +667,9 @@ func detectShell() string {
 		if strings.Contains(shell, "zsh") {
 			return "zsh"
 		}
+		if strings.Contains(shell, "fish") {
+			return "fish"
+		}
 		if strings.Contains(shell, "bash") {
 			return "bash"
 		}
@@ -355,7 +728,10 @@ func runConfigEdit() error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run %s: %w", editor, err)
+	}
+	return nil
 }
 
 // runConfigInitProject initializes a project-specific context file
@@ -516,6 +892,8 @@ func runConfigSetKey(args []string) error {
 		rcFile = filepath.Join(homeDir, ".zshrc")
 	case "bash":
 		rcFile = filepath.Join(homeDir, ".bashrc")
+	case "fish":
+		rcFile = filepath.Join(homeDir, ".config", "fish", "config.fish")
 	default:
 		rcFile = filepath.Join(homeDir, ".bashrc")
 	}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/traves/linesense/internal/config"
+	"github.com/traves/linesense/internal/core"
+	"golang.org/x/term"
+)
+
+// runRun suggests a command for --line and, according to the execution
+// policy, prints it, asks for a typed confirmation or runs it in the user's
+// shell
+func runRun(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	shell := fs.String("shell", "", "Shell to run the command with (bash, zsh, fish)")
+	line := fs.String("line", "", "What to do, or a partial command line")
+	cwd := fs.String("cwd", "", "Directory to run the command in")
+	model := fs.String("model", "", "Override model ID from config")
+	histFile := fs.String("histfile", "", "Shell history file (default: $HISTFILE or the shell's default)")
+	policy := fs.String("policy", "", "Execution policy: paste_only, confirm, confirm_high_risk or auto_low_risk")
+	interactive := fs.Bool("interactive", false, "Pick the suggestion interactively instead of taking the first")
+	preview := fs.Bool("preview", false, "Run the command's dry run first, when one is known")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Validate required flags
+	if *line == "" {
+		return fmt.Errorf("--line flag is required")
+	}
+
+	// Auto-detect shell if not provided
+	if *shell == "" {
+		*shell = detectShell()
+	}
+
+	// Use current directory if not provided
+	if *cwd == "" {
+		var err error
+		*cwd, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Reject an unknown policy before asking the model
+	if *policy == "" {
+		*policy = cfg.Safety.DefaultExecution
+	}
+	if _, err := core.ExecActionFor(*policy, core.RiskLow); err != nil {
+		return err
+	}
+
+	backend := newBackend(cfg, nil)
+	contextEnv := &core.ContextEnvelope{Shell: *shell, Line: *line, CWD: *cwd, HistFile: *histFile}
+	core.PrepareEnvelope(contextEnv, cfg)
+
+	// Generate suggestions with spinner
+	var suggestions []core.Suggestion
+	err = withSpinner("Generating suggestions...", func(ctx context.Context) error {
+		var err error
+		suggestions, err = backend.Suggest(ctx, core.SuggestInput{ModelID: *model, Prompt: *line, Context: contextEnv})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate suggestions: %w", err)
+	}
+	if len(suggestions) == 0 {
+		return fmt.Errorf("no suggestions found")
+	}
+
+	chosen := suggestions[0]
+	if *interactive {
+		var ok bool
+		chosen, ok, err = chooseSuggestion(suggestions, backend, contextEnv, *model, cfg)
+		if err != nil || !ok {
+			return err
+		}
+	} else {
+		classifyChosen(&chosen, contextEnv, cfg)
+	}
+
+	// The denylist applies whatever the policy, and to edited commands too
+	if err := core.CheckExecutable(chosen.Command, &cfg.Safety); err != nil {
+		return err
+	}
+
+	action, err := core.ExecActionFor(*policy, chosen.Risk)
+	if err != nil {
+		return err
+	}
+	if action == core.ActionPrint {
+		// The picker has already recorded the suggestion it returned
+		if !*interactive {
+			if err := auditSuggestion(core.AuditAccepted, *policy, chosen, *cwd, *model, cfg); err != nil {
+				return err
+			}
+		}
+		fmt.Println(chosen.Command)
+		return nil
+	}
+
+	printRunCommandStyled(chosen)
+
+	switch {
+	case *preview && chosen.Preview == "":
+		fmt.Fprintln(os.Stderr, mutedStyle.Render("   No dry run is known for this command."))
+	case *preview:
+		ok, err := runPreview(chosen, *policy, *shell, *cwd, *model, cfg, contextEnv)
+		if err != nil || !ok {
+			return err
+		}
+		// Leave time to read what the dry run printed
+		if action == core.ActionRun {
+			action = core.ActionConfirm
+		}
+	}
+
+	audit, ok, err := approve(action, chosen.Command, "it")
+	if err != nil || !ok {
+		return err
+	}
+
+	// Nothing runs unrecorded: a command that can't be logged isn't run
+	if err := auditSuggestion(audit, *policy, chosen, *cwd, *model, cfg); err != nil {
+		return err
+	}
+	return execute(chosen.Command, *shell, *cwd, cfg)
+}
+
+// runPreview runs the dry run of chosen, classified and confirmed under
+// policy like any other command. ok is false if it wasn't run or failed, in
+// which case the command mustn't be run either.
+func runPreview(chosen core.Suggestion, policy, shell, cwd, model string, cfg *config.Config, contextEnv *core.ContextEnvelope) (bool, error) {
+	preview := core.Suggestion{Command: chosen.Preview, Source: chosen.Source}
+	classifyChosen(&preview, contextEnv, cfg)
+	action, err := core.ExecActionFor(policy, preview.Risk)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %s\n", headerStyle.Render("Dry run:"), commandStyle.Render(preview.Command))
+	audit, ok, err := approve(action, preview.Command, "the dry run")
+	if err != nil || !ok {
+		return false, err
+	}
+	if err := auditSuggestion(audit, policy, preview, cwd, model, cfg); err != nil {
+		return false, err
+	}
+
+	if err := execute(preview.Command, shell, cwd, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, mutedStyle.Render("The dry run failed, so the command was not run."))
+		return false, err
+	}
+	fmt.Fprintln(os.Stderr)
+	return true, nil
+}
+
+// approve asks for the confirmation action calls for, naming the command
+// what, and returns how it was approved for the audit log. ok is false if
+// it wasn't.
+func approve(action core.ExecAction, command, what string) (audit string, ok bool, err error) {
+	switch action {
+	case core.ActionConfirm:
+		ok, err = confirmTyped(fmt.Sprintf(`Type "yes" to run %s: `, what), "yes")
+		return core.AuditConfirmed, ok, err
+	case core.ActionRetype:
+		prompt := fmt.Sprintf("High-risk command. Type it again to run %s: ", what)
+		if strings.Contains(command, "\n") {
+			prompt = fmt.Sprintf("High-risk command. Type it again, on one line, to run %s: ", what)
+		}
+		ok, err = confirmTyped(prompt, command)
+		return core.AuditConfirmed, ok, err
+	}
+	return core.AuditExecuted, true, nil
+}
+
+// confirmTyped asks on the terminal for want to be typed, and reports
+// whether it was. Only one line is read, so whitespace is compared loosely: a
+// multi-line command is typed with spaces for its line breaks.
+func confirmTyped(prompt, want string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("confirmation needs a terminal; use --policy paste_only to print the command instead")
+	}
+
+	fmt.Fprint(os.Stderr, headerStyle.Render(prompt))
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(os.Stderr)
+		return false, nil
+	}
+	if normalizeSpace(answer) != normalizeSpace(want) {
+		fmt.Fprintln(os.Stderr, mutedStyle.Render("Not run."))
+		return false, nil
+	}
+	return true, nil
+}
+
+// normalizeSpace collapses the whitespace in s, line breaks and
+// backslash-continued lines included, into single spaces
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(s, "\\\n", " ")), " ")
+}
+
+// execute runs command in the user's shell, connected to the terminal. The
+// shell gets Ctrl+C, not linesense, which waits for it to finish.
+func execute(command, shell, cwd string, cfg *config.Config) error {
+	cmd, err := core.ShellCommand(context.Background(), command, shell, cwd, &cfg.Safety)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Catch rather than ignore the signal: an ignored signal would stay
+	// ignored in the command
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return &commandExitError{code: exitErr.ExitCode()}
+	}
+	return err
+}
+
+// commandExitError reports that a command run by execute exited with a
+// non-zero status, which linesense exits with too
+type commandExitError struct {
+	code int
+}
+
+func (e *commandExitError) Error() string {
+	return fmt.Sprintf("command exited with status %d", e.code)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/traves/linesense/internal/server"
+)
+
+// runServe runs LineSense as a server for editor and tool integrations
+func runServe(args []string) error {
+	// Parse flags
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	stdio := fs.Bool("stdio", false, "Speak JSON-RPC 2.0 on stdin and stdout")
+	httpAddr := fs.String("http", "", "Serve the HTTP API on this address (e.g. 127.0.0.1:7878)")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *stdio == (*httpAddr != "") {
+		return fmt.Errorf("exactly one of --stdio or --http is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *stdio {
+		// stdout carries the protocol, so nothing else may be printed there
+		return server.ServeStdio(ctx, os.Stdin, os.Stdout, server.NewService(version))
+	}
+
+	return runServeHTTP(ctx, *httpAddr)
+}
+
+// runServeHTTP serves the HTTP API on addr, authenticating requests with the
+// token in the config directory
+func runServeHTTP(ctx context.Context, addr string) error {
+	tokenPath := server.TokenPath()
+	token, created, err := server.LoadOrCreateToken(tokenPath)
+	if err != nil {
+		return err
+	}
+	if created {
+		fmt.Fprintf(os.Stderr, "Created API token in %s\n", tokenPath)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	// The API has no TLS, so it is meant for localhost
+	if tcpAddr, ok := listener.Addr().(*net.TCPAddr); ok && !tcpAddr.IP.IsLoopback() {
+		fmt.Fprintf(os.Stderr, "Warning: %s is reachable from other machines and traffic is not encrypted\n", listener.Addr())
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	logger.Printf("linesense HTTP API listening on http://%s", listener.Addr())
+
+	handler := server.NewHTTPHandler(server.NewService(version), token, logger)
+	return server.ServeHTTP(ctx, listener, handler)
+}
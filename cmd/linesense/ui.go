@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/traves/linesense/internal/core"
@@ -136,7 +137,9 @@ type doneMsg struct{}
 func showSpinner(message string, fn func() error) error {
 	done := make(chan error, 1)
 
-	p := tea.NewProgram(newSpinnerModel(message))
+	// Render on stderr so the spinner never mixes into output that shell
+	// integrations capture from stdout
+	p := tea.NewProgram(newSpinnerModel(message), tea.WithOutput(os.Stderr))
 
 	// Run the function in a goroutine
 	go func() {
@@ -146,7 +149,7 @@ func showSpinner(message string, fn func() error) error {
 	// Start the spinner in another goroutine
 	go func() {
 		if _, err := p.Run(); err != nil {
-			fmt.Printf("Error running spinner: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error running spinner: %v\n", err)
 		}
 	}()
 
@@ -214,20 +217,92 @@ func printSuggestionsStyled(suggestions []core.Suggestion) {
 		)
 		parts = append(parts, risk)
 
+		// Why the command got its risk level
+		for _, line := range findingLines(suggestion.Command, suggestion.Findings) {
+			parts = append(parts, "     "+line)
+		}
+
 		// Explanation
 		if suggestion.Explanation != "" {
 			explanation := mutedStyle.Render(fmt.Sprintf("   %s", suggestion.Explanation))
 			parts = append(parts, explanation)
 		}
 
+		// Dry run and how to take the command back
+		if suggestion.Preview != "" {
+			parts = append(parts, fmt.Sprintf("   %s %s", mutedStyle.Render("Preview:"), suggestion.Preview))
+		}
+		if line := undoLine(suggestion); line != "" {
+			parts = append(parts, "   "+line)
+		}
+
 		fmt.Printf("\n%s\n", strings.Join(parts, "\n"))
 	}
 
 	fmt.Println()
 }
 
-// printExplanationStyled prints a command explanation with Lipgloss styling
-func printExplanationStyled(explanation core.Explanation) {
+// printRunCommandStyled shows the command linesense run is about to run, with
+// its risk and findings, on stderr
+func printRunCommandStyled(suggestion core.Suggestion) {
+	style, icon := riskStyleFor(suggestion.Risk)
+	fmt.Fprintf(os.Stderr, "\n%s\n", commandStyle.Render("$ "+suggestion.Command))
+	fmt.Fprintf(os.Stderr, "   %s Risk: %s\n", style.Render(icon), style.Render(string(suggestion.Risk)))
+	for _, line := range findingLines(suggestion.Command, suggestion.Findings) {
+		fmt.Fprintf(os.Stderr, "     %s\n", line)
+	}
+	if suggestion.Explanation != "" {
+		fmt.Fprintln(os.Stderr, mutedStyle.Render("   "+suggestion.Explanation))
+	}
+	if suggestion.Preview != "" {
+		fmt.Fprintf(os.Stderr, "   %s %s\n", mutedStyle.Render("Preview:"), suggestion.Preview)
+	}
+	if line := undoLine(suggestion); line != "" {
+		fmt.Fprintf(os.Stderr, "   %s\n", line)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// undoLine renders a suggestion's undo hint, or "" when it has none
+func undoLine(suggestion core.Suggestion) string {
+	switch {
+	case suggestion.Irreversible:
+		return riskHighStyle.Render("⚠ Irreversible")
+	case suggestion.Undo != "":
+		return fmt.Sprintf("%s %s", mutedStyle.Render("Undo:"), suggestion.Undo)
+	}
+	return ""
+}
+
+// printTimingsStyled prints context collector timings to stderr so that
+// stdout stays machine-readable
+func printTimingsStyled(timings []core.CollectorTiming) {
+	fmt.Fprintf(os.Stderr, "\n%s\n", titleStyle.Render("⏱  Context Collectors"))
+
+	var total time.Duration
+	for _, timing := range timings {
+		status := riskLowStyle.Render("ok")
+		if timing.Dropped {
+			status = riskHighStyle.Render("dropped")
+		}
+		if timing.Duration > total {
+			total = timing.Duration
+		}
+
+		fmt.Fprintf(os.Stderr, "  %-16s %8s %s %s\n",
+			timing.Name,
+			timing.Duration.Round(time.Microsecond),
+			mutedStyle.Render(fmt.Sprintf("(budget %s)", timing.Budget)),
+			status,
+		)
+	}
+
+	fmt.Fprintf(os.Stderr, "  %-16s %8s %s\n\n", "total", total.Round(time.Microsecond), mutedStyle.Render("(collectors run concurrently)"))
+}
+
+// printExplanationStyled prints the explanation of command with Lipgloss
+// styling
+func printExplanationStyled(command string, explanation core.Explanation) {
 	// Get terminal width for dynamic sizing
 	termWidth := getTerminalWidth()
 	contentWidth := termWidth - 6 // Account for box padding/borders
@@ -276,6 +351,11 @@ func printExplanationStyled(explanation core.Explanation) {
 		))
 	fmt.Println(riskBox)
 
+	// Why the command got its risk level
+	for _, line := range findingLines(command, explanation.Findings) {
+		fmt.Println("  " + line)
+	}
+
 	// Details
 	if len(explanation.Notes) > 0 {
 		detailsTitle := headerStyle.Render("\nDetails")
@@ -316,3 +396,336 @@ func withSpinner(message string, fn func(context.Context) error) error {
 		return fn(ctx)
 	})
 }
+
+// explainDebounce is how long a suggestion must stay highlighted in the
+// picker before its explanation is requested
+const explainDebounce = 300 * time.Millisecond
+
+// explainFunc explains a single command for the picker's preview pane
+type explainFunc func(ctx context.Context, command string) (core.Explanation, error)
+
+// pickerResult is the outcome of the interactive suggestion picker
+type pickerResult struct {
+	Index    int    // index of the chosen suggestion
+	Command  string // chosen command, possibly edited
+	Edited   bool   // the command was changed before accepting
+	Canceled bool
+}
+
+// explainState tracks the preview of one suggestion
+type explainState struct {
+	loading     bool
+	explanation core.Explanation
+	err         error
+}
+
+type explainDebounceMsg struct{ index int }
+
+type explainDoneMsg struct {
+	index       int
+	explanation core.Explanation
+	err         error
+}
+
+// pickerModel is the Bubble Tea model for choosing between suggestions
+type pickerModel struct {
+	ctx          context.Context
+	suggestions  []core.Suggestion
+	explain      explainFunc
+	explanations map[int]*explainState
+	cursor       int
+	editing      bool
+	input        textinput.Model
+	width        int
+	result       pickerResult
+	done         bool
+}
+
+func newPickerModel(ctx context.Context, suggestions []core.Suggestion, explain explainFunc) pickerModel {
+	input := textinput.New()
+	input.Prompt = "› "
+	input.PromptStyle = lipgloss.NewStyle().Foreground(secondaryColor).Bold(true)
+
+	return pickerModel{
+		ctx:          ctx,
+		suggestions:  suggestions,
+		explain:      explain,
+		explanations: make(map[int]*explainState),
+		input:        input,
+		width:        getTerminalWidth(),
+	}
+}
+
+func (m pickerModel) Init() tea.Cmd {
+	return m.scheduleExplain()
+}
+
+// scheduleExplain requests the explanation of the highlighted suggestion
+// once it has stayed highlighted for explainDebounce
+func (m pickerModel) scheduleExplain() tea.Cmd {
+	if m.explain == nil || m.explanations[m.cursor] != nil {
+		return nil
+	}
+	index := m.cursor
+	return tea.Tick(explainDebounce, func(time.Time) tea.Msg {
+		return explainDebounceMsg{index: index}
+	})
+}
+
+func (m pickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		return m, nil
+
+	case explainDebounceMsg:
+		// Skip if the user has moved on or the explanation is already known
+		if msg.index != m.cursor || m.explanations[msg.index] != nil {
+			return m, nil
+		}
+		m.explanations[msg.index] = &explainState{loading: true}
+		ctx, explain, command := m.ctx, m.explain, m.suggestions[msg.index].Command
+		return m, func() tea.Msg {
+			explanation, err := explain(ctx, command)
+			return explainDoneMsg{index: msg.index, explanation: explanation, err: err}
+		}
+
+	case explainDoneMsg:
+		m.explanations[msg.index] = &explainState{explanation: msg.explanation, err: msg.err}
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.editing {
+			return m.updateEditing(msg)
+		}
+		return m.updateList(msg)
+	}
+
+	return m, nil
+}
+
+// updateList handles keys while moving through the list
+func (m pickerModel) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k", "ctrl+p":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+		return m, m.scheduleExplain()
+	case "down", "j", "ctrl+n":
+		if m.cursor < len(m.suggestions)-1 {
+			m.cursor++
+		}
+		return m, m.scheduleExplain()
+	case "enter":
+		return m.accept(m.suggestions[m.cursor].Command)
+	case "e", "tab":
+		m.editing = true
+		m.input.SetValue(m.suggestions[m.cursor].Command)
+		m.input.CursorEnd()
+		return m, m.input.Focus()
+	case "esc", "q", "ctrl+c", "ctrl+g":
+		m.result = pickerResult{Canceled: true}
+		m.done = true
+		return m, tea.Quit
+	}
+
+	// Number keys choose the matching suggestion directly
+	if key := msg.String(); len(key) == 1 && key[0] >= '1' && key[0] <= '9' {
+		if index := int(key[0] - '1'); index < len(m.suggestions) {
+			m.cursor = index
+			return m.accept(m.suggestions[index].Command)
+		}
+	}
+
+	return m, nil
+}
+
+// updateEditing handles keys while the highlighted command is being edited
+func (m pickerModel) updateEditing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		if command := strings.TrimSpace(m.input.Value()); command != "" {
+			return m.accept(command)
+		}
+		return m, nil
+	case "esc":
+		m.editing = false
+		m.input.Blur()
+		return m, nil
+	case "ctrl+c":
+		m.result = pickerResult{Canceled: true}
+		m.done = true
+		return m, tea.Quit
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// accept finishes the picker with the given command
+func (m pickerModel) accept(command string) (tea.Model, tea.Cmd) {
+	m.result = pickerResult{
+		Index:   m.cursor,
+		Command: command,
+		Edited:  command != m.suggestions[m.cursor].Command,
+	}
+	m.done = true
+	return m, tea.Quit
+}
+
+func (m pickerModel) View() string {
+	// Clear the picker from the terminal once a choice has been made
+	if m.done {
+		return ""
+	}
+
+	// Show the preview beside the list on wide terminals, below it otherwise
+	listWidth := m.width
+	previewWidth := m.width - 4
+	sideBySide := m.width >= 100
+	if sideBySide {
+		listWidth = m.width * 55 / 100
+		previewWidth = m.width - listWidth - 4
+	}
+
+	list := m.viewList(listWidth)
+	preview := m.viewPreview(previewWidth)
+
+	var body string
+	if sideBySide {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, list, preview)
+	} else {
+		body = lipgloss.JoinVertical(lipgloss.Left, list, preview)
+	}
+
+	header := titleStyle.Render("💡 Command Suggestions")
+	help := "↑/↓ move • 1-9 choose • enter accept • e edit • esc cancel"
+	if m.editing {
+		help = "enter accept • esc back to list"
+	}
+
+	return fmt.Sprintf("\n%s\n%s\n%s\n", header, body, mutedStyle.Render("  "+help))
+}
+
+// viewList renders the suggestions, or the edit field while editing
+func (m pickerModel) viewList(width int) string {
+	var lines []string
+	for i, suggestion := range m.suggestions {
+		riskStyle, riskIcon := riskStyleFor(suggestion.Risk)
+
+		pointer := "  "
+		command := suggestion.Command
+		if i == m.cursor {
+			pointer = lipgloss.NewStyle().Foreground(secondaryColor).Bold(true).Render("› ")
+			command = commandStyle.Padding(0).Render(command)
+		} else {
+			command = mutedStyle.Render(command)
+		}
+
+		number := lipgloss.NewStyle().Foreground(secondaryColor).Render(fmt.Sprintf("%d.", i+1))
+		lines = append(lines, fmt.Sprintf("%s%s %s %s", pointer, number, riskStyle.Render(riskIcon), command))
+	}
+
+	if m.editing {
+		lines = append(lines, "", headerStyle.Render("  Edit command:"), "  "+m.input.View())
+	}
+
+	return lipgloss.NewStyle().Width(width).MarginTop(1).Render(strings.Join(lines, "\n"))
+}
+
+// viewPreview renders the explanation of the highlighted suggestion
+func (m pickerModel) viewPreview(width int) string {
+	suggestion := m.suggestions[m.cursor]
+	riskStyle, riskIcon := riskStyleFor(suggestion.Risk)
+
+	parts := []string{
+		headerStyle.Render("Explanation"),
+		fmt.Sprintf("%s Risk: %s", riskStyle.Render(riskIcon), riskStyle.Render(string(suggestion.Risk))),
+	}
+	parts = append(parts, findingLines(suggestion.Command, suggestion.Findings)...)
+	if suggestion.Explanation != "" {
+		parts = append(parts, mutedStyle.Render(suggestion.Explanation))
+	}
+	if suggestion.Preview != "" {
+		parts = append(parts, mutedStyle.Render("Preview: ")+suggestion.Preview)
+	}
+	if line := undoLine(suggestion); line != "" {
+		parts = append(parts, line)
+	}
+
+	state := m.explanations[m.cursor]
+	switch {
+	case m.explain == nil:
+	case state == nil || state.loading:
+		parts = append(parts, "", mutedStyle.Render("Loading explanation..."))
+	case state.err != nil:
+		parts = append(parts, "", riskHighStyle.Render("Explanation unavailable: ")+mutedStyle.Render(state.err.Error()))
+	default:
+		parts = append(parts, "", state.explanation.Summary)
+		for _, note := range state.explanation.Notes {
+			parts = append(parts, mutedStyle.Render(note))
+		}
+	}
+
+	return boxStyle.Width(max(width, 20)).Render(strings.Join(parts, "\n"))
+}
+
+// findingLines renders one line per finding: the severity, the reason, the
+// part of command the rule matched and where the rule comes from
+func findingLines(command string, findings []core.Finding) []string {
+	var lines []string
+	for _, finding := range findings {
+		style, icon := riskStyleFor(finding.Severity)
+		line := fmt.Sprintf("%s %s", style.Render(icon), finding.Reason)
+		if finding.Span.Start >= 0 && finding.Span.End <= len(command) && finding.Span.Start < finding.Span.End {
+			line += ": " + commandStyle.Padding(0).Render(command[finding.Span.Start:finding.Span.End])
+		}
+		line += mutedStyle.Render(fmt.Sprintf(" (%s %s)", finding.Source, finding.Rule))
+		switch {
+		case finding.Targets == 1:
+			line += mutedStyle.Render(", 1 file")
+		case finding.Targets > 1:
+			line += mutedStyle.Render(fmt.Sprintf(", %d files", finding.Targets))
+		}
+		if finding.Override != "" {
+			line += mutedStyle.Render(", " + finding.Override)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// riskStyleFor returns the style and icon used to show a risk level
+func riskStyleFor(risk core.RiskLevel) (lipgloss.Style, string) {
+	switch risk {
+	case core.RiskLow:
+		return riskLowStyle, "✓"
+	case core.RiskMedium:
+		return riskMediumStyle, "⚠"
+	case core.RiskHigh:
+		return riskHighStyle, "⚠"
+	default:
+		return mutedStyle, "•"
+	}
+}
+
+// runPicker lets the user choose, and optionally edit, one of the suggestions.
+// The picker draws on stderr and reads keys from the terminal, so stdout stays
+// free for the chosen command even when it is captured by a shell widget.
+func runPicker(suggestions []core.Suggestion, explain explainFunc) (pickerResult, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Styles pick their colors for stdout, which is usually a pipe here
+	lipgloss.SetColorProfile(lipgloss.NewRenderer(os.Stderr).ColorProfile())
+
+	p := tea.NewProgram(newPickerModel(ctx, suggestions, explain), tea.WithOutput(os.Stderr), tea.WithInputTTY())
+	final, err := p.Run()
+	if err != nil {
+		return pickerResult{}, fmt.Errorf("failed to run picker: %w", err)
+	}
+
+	return final.(pickerModel).result, nil
+}
@@ -92,6 +92,9 @@ get_shell_rc() {
         zsh)
             echo "$HOME/.zshrc"
             ;;
+        fish)
+            echo "${XDG_CONFIG_HOME:-$HOME/.config}/fish/config.fish"
+            ;;
         *)
             warn "Unknown shell: $shell_name"
             echo ""
@@ -189,26 +192,17 @@ install_shell_integration() {
 
     info "Installing shell integration for $shell_name..."
 
-    # Copy shell integration script
-    local integration_dir="$CONFIG_DIR/shell"
-    mkdir -p "$integration_dir"
-
-    if [ -f "scripts/linesense.$shell_name" ]; then
-        cp "scripts/linesense.$shell_name" "$integration_dir/"
-        chmod +x "$integration_dir/linesense.$shell_name"
-        success "Shell integration script copied to $integration_dir"
-    else
-        warn "Shell integration script not found for $shell_name"
-        return
+    # The integration script is built into the binary
+    local source_line="eval \"\$(linesense init $shell_name)\""
+    if [ "$shell_name" = "fish" ]; then
+        source_line="linesense init fish | source"
     fi
 
-    # Add sourcing to RC file
-    local source_line="[ -f \"$integration_dir/linesense.$shell_name\" ] && source \"$integration_dir/linesense.$shell_name\""
-
-    if grep -q "linesense.$shell_name" "$rc_file" 2>/dev/null; then
+    if grep -q "linesense init\|linesense.$shell_name" "$rc_file" 2>/dev/null; then
         info "Shell integration already present in $rc_file"
     else
         info "Adding shell integration to $rc_file..."
+        mkdir -p "$(dirname "$rc_file")"
         echo "" >> "$rc_file"
         echo "# LineSense AI Shell Assistant" >> "$rc_file"
         echo "$source_line" >> "$rc_file"
@@ -246,7 +240,7 @@ print_next_steps() {
     echo -e "     ${BLUE}linesense suggest \"list files sorted by size\"${NC}"
     echo -e "     ${BLUE}linesense explain \"git rebase -i HEAD~3\"${NC}"
     echo ""
-    echo "  4. Use shell integration (Ctrl+Space for suggestions & Ctrl+X for Explanation)"
+    echo "  4. Use shell integration (Ctrl+Space for suggestions, Alt+A to pick between them & Ctrl+X for Explanation)"
     echo ""
     echo "  5. See all commands:"
     echo -e "     ${BLUE}linesense --help${NC}"
@@ -20,6 +20,7 @@ type OpenRouterProvider struct {
 	config  config.OpenRouterConfig
 	profile config.ProfileConfig
 	apiKey  string
+	client  *http.Client // reused so connections are kept alive between calls
 }
 
 // NewOpenRouterProvider creates a new OpenRouter provider
@@ -34,6 +35,9 @@ func NewOpenRouterProvider(cfg config.OpenRouterConfig, profile config.ProfileCo
 		config:  cfg,
 		profile: profile,
 		apiKey:  apiKey,
+		client: &http.Client{
+			Timeout: time.Duration(cfg.TimeoutMs) * time.Millisecond,
+		},
 	}, nil
 }
 
@@ -78,6 +82,39 @@ func (p *OpenRouterProvider) Explain(ctx context.Context, input core.ExplainInpu
 	return explanation, nil
 }
 
+// Fix generates corrected versions of a failed command using OpenRouter
+func (p *OpenRouterProvider) Fix(ctx context.Context, input core.FixInput) ([]core.Suggestion, error) {
+	// Build the prompt
+	systemPrompt := buildFixSystemPrompt()
+	userPrompt := buildFixUserPrompt(input)
+
+	// Make API request
+	response, err := p.callOpenRouter(ctx, input.ModelID, systemPrompt, userPrompt)
+	if err != nil {
+		return nil, fmt.Errorf("OpenRouter API call failed: %w", err)
+	}
+
+	// Parse suggestions from response
+	suggestions := parseSuggestions(response, input.Command)
+
+	return suggestions, nil
+}
+
+// Complete generates an inline completion for the current line using OpenRouter
+func (p *OpenRouterProvider) Complete(ctx context.Context, input core.CompleteInput) (string, error) {
+	// Build the prompt
+	systemPrompt := buildCompleteSystemPrompt()
+	userPrompt := buildCompleteUserPrompt(input.Context)
+
+	// Make API request
+	response, err := p.callOpenRouter(ctx, input.ModelID, systemPrompt, userPrompt)
+	if err != nil {
+		return "", fmt.Errorf("OpenRouter API call failed: %w", err)
+	}
+
+	return parseCompletion(response, input.Context.Line), nil
+}
+
 // OpenRouter API types
 type openRouterRequest struct {
 	Model       string              `json:"model"`
@@ -135,13 +172,8 @@ func (p *OpenRouterProvider) callOpenRouter(ctx context.Context, modelID, system
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.apiKey))
 
-	// Set timeout
-	client := &http.Client{
-		Timeout: time.Duration(p.config.TimeoutMs) * time.Millisecond,
-	}
-
 	// Make request
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("HTTP request failed: %w", err)
 	}
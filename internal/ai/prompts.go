@@ -3,6 +3,7 @@ package ai
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/traves/linesense/internal/core"
 )
@@ -19,6 +20,8 @@ IMPORTANT RULES:
 5. If the input is already complete, suggest improvements or alternatives
 6. For ambiguous or typo inputs, interpret user intent and suggest corrections
 7. Keep commands concise but complete
+8. If a git operation (rebase, merge, cherry-pick, etc.) is in progress, prefer commands that resolve, continue or abort it
+9. If the most recent command failed, consider suggesting a corrected version of it
 
 OS-SPECIFIC COMMANDS - CRITICAL RULES:
 - You MUST ONLY suggest commands that work on the user's detected operating system
@@ -40,17 +43,25 @@ PACKAGE MANAGEMENT - USE THE DETECTED PACKAGE MANAGER:
 
 FILE PATHS AND COMMAND SYNTAX:
 - Linux/macOS: forward slashes (/home/user/file), standard Unix commands
+- Match the "Shell" field: for fish use fish syntax (set -x VAR value, (cmd) instead of $(cmd), "; and"/"; or" or && ||), never bash-only constructs like export VAR=value or [[ ]]
 - Windows: backslashes or PowerShell syntax, Windows-specific commands
 - Adjust based on "Operating System" field
 
+UNDO HINTS:
+For a command that changes files, git state, packages or services, end its explanation with one of:
+- [undo: COMMAND] - the command that reverses it, run in the same directory, only when you are confident it restores the previous state
+- [irreversible] - when data or state is lost for good (deleted files, discarded changes, dropped tables, overwritten remote history)
+Leave the hint out for read-only commands or when you don't know how to reverse the command.
+
 RESPONSE FORMAT:
 One suggestion per line in this exact format:
-COMMAND | brief explanation (5-10 words max)
+COMMAND | brief explanation (5-10 words max) [undo hint, if any]
 
 Example:
 ls -la | List all files with details
 find . -type f -name "*.txt" | Find all text files recursively
-tree -L 2 | Show directory tree 2 levels deep`
+git stash | Set aside uncommitted changes [undo: git stash pop]
+rm -rf build | Delete the build directory [irreversible]`
 }
 
 // buildSuggestUserPrompt creates the user prompt with context
@@ -76,22 +87,19 @@ func buildSuggestUserPrompt(ctx *core.ContextEnvelope) string {
 	// Add git context if available
 	if ctx.Git != nil && ctx.Git.IsRepo {
 		parts = append(parts, "\nGit context:")
-		parts = append(parts, fmt.Sprintf("- Branch: %s", ctx.Git.Branch))
-		parts = append(parts, fmt.Sprintf("- Status: %s", ctx.Git.StatusSummary))
-		if len(ctx.Git.Remotes) > 0 {
-			parts = append(parts, fmt.Sprintf("- Remotes: %s", strings.Join(ctx.Git.Remotes, ", ")))
-		}
+		parts = append(parts, buildGitContextLines(ctx.Git)...)
 	}
 
 	// Add recent history if available
 	if len(ctx.History) > 0 {
-		parts = append(parts, "\nRecent commands (last 5):")
+		parts = append(parts, "\nRecent commands (last 5, oldest first; weight recent ones more; failed commands show their exit code):")
 		start := len(ctx.History) - 5
 		if start < 0 {
 			start = 0
 		}
+		now := time.Now()
 		for _, entry := range ctx.History[start:] {
-			parts = append(parts, fmt.Sprintf("- %s", entry.Command))
+			parts = append(parts, formatHistoryEntry(entry, ctx.CWD, now))
 		}
 	}
 
@@ -112,6 +120,106 @@ func buildSuggestUserPrompt(ctx *core.ContextEnvelope) string {
 	return strings.Join(parts, "\n")
 }
 
+// formatHistoryEntry renders a history entry for the prompt, noting when,
+// where and for how long it ran and whether it failed, as far as the history
+// source recorded that
+func formatHistoryEntry(entry core.HistoryEntry, cwd string, now time.Time) string {
+	line := fmt.Sprintf("- %s", entry.Command)
+
+	var notes []string
+	if entry.ExitCode != nil && *entry.ExitCode != 0 {
+		notes = append(notes, fmt.Sprintf("failed, exit %d", *entry.ExitCode))
+	}
+	if entry.CWD != "" && entry.CWD != cwd {
+		notes = append(notes, fmt.Sprintf("in %s", entry.CWD))
+	}
+	if entry.Timestamp != nil {
+		if started, err := time.Parse(time.RFC3339, *entry.Timestamp); err == nil {
+			notes = append(notes, fmt.Sprintf("%s ago", formatAge(now.Sub(started))))
+		}
+	}
+	if entry.Duration != nil && *entry.Duration > 0 {
+		notes = append(notes, fmt.Sprintf("ran %ds", *entry.Duration))
+	}
+
+	if len(notes) > 0 {
+		line += fmt.Sprintf(" (%s)", strings.Join(notes, ", "))
+	}
+	return line
+}
+
+// formatAge renders a duration coarsely, e.g. "45s", "12m", "3h" or "2d"
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// gitOperationCommands maps an in-progress git operation to the commands
+// that continue or abort it
+var gitOperationCommands = map[string]string{
+	"rebase":      "git rebase --continue / git rebase --abort",
+	"merge":       "git merge --continue / git merge --abort",
+	"cherry-pick": "git cherry-pick --continue / git cherry-pick --abort",
+	"revert":      "git revert --continue / git revert --abort",
+	"am":          "git am --continue / git am --abort",
+	"bisect":      "git bisect good / git bisect bad / git bisect reset",
+}
+
+// buildGitContextLines formats git repository state for the suggest prompt
+func buildGitContextLines(git *core.GitInfo) []string {
+	var lines []string
+
+	if git.Detached {
+		lines = append(lines, fmt.Sprintf("- HEAD: detached at %s", git.Branch))
+	} else {
+		lines = append(lines, fmt.Sprintf("- Branch: %s", git.Branch))
+	}
+
+	if git.Upstream != "" {
+		lines = append(lines, fmt.Sprintf("- Upstream: %s (ahead %d, behind %d)", git.Upstream, git.Ahead, git.Behind))
+	}
+
+	lines = append(lines, fmt.Sprintf("- Status: %s", git.StatusSummary))
+
+	if git.Operation != "" {
+		operation := fmt.Sprintf("- In progress: %s", git.Operation)
+		if commands, ok := gitOperationCommands[git.Operation]; ok {
+			operation += fmt.Sprintf(" (next steps: %s)", commands)
+		}
+		lines = append(lines, operation)
+	}
+	if len(git.Conflicts) > 0 {
+		lines = append(lines, fmt.Sprintf("- Conflicted files: %s", strings.Join(git.Conflicts, ", ")))
+	}
+
+	if git.StashCount > 0 {
+		lines = append(lines, fmt.Sprintf("- Stash entries: %d", git.StashCount))
+	}
+	if len(git.Tags) > 0 {
+		lines = append(lines, fmt.Sprintf("- Tags on HEAD: %s", strings.Join(git.Tags, ", ")))
+	}
+	if len(git.RecentCommits) > 0 {
+		lines = append(lines, "- Recent commits:")
+		for _, subject := range git.RecentCommits {
+			lines = append(lines, fmt.Sprintf("  - %s", subject))
+		}
+	}
+
+	if len(git.Remotes) > 0 {
+		lines = append(lines, fmt.Sprintf("- Remotes: %s", strings.Join(git.Remotes, ", ")))
+	}
+
+	return lines
+}
+
 // buildExplainSystemPrompt creates the system prompt for command explanations
 func buildExplainSystemPrompt() string {
 	return `You are an expert shell command explainer. Your job is to explain what a command does, its risks, and potential side effects.
@@ -150,11 +258,181 @@ func buildExplainUserPrompt(ctx *core.ContextEnvelope) string {
 	// Add git context if relevant
 	if ctx.Git != nil && ctx.Git.IsRepo {
 		parts = append(parts, fmt.Sprintf("\nGit repository: branch=%s, status=%s", ctx.Git.Branch, ctx.Git.StatusSummary))
+		if ctx.Git.Operation != "" {
+			parts = append(parts, fmt.Sprintf("Git operation in progress: %s", ctx.Git.Operation))
+		}
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// maxFixStderr is how much captured error output is sent to the model; the
+// end of the output usually holds the actual error
+const maxFixStderr = 4000
+
+// buildFixSystemPrompt creates the system prompt for repairing failed commands
+func buildFixSystemPrompt() string {
+	return `You are an expert shell command debugger. A command the user ran has failed. Your job is to suggest 1-5 corrected commands that accomplish what the user intended.
+
+IMPORTANT RULES:
+1. Order suggestions from most likely to fix the problem to least likely
+2. Use the exit code and error output to find the cause (typos, wrong flags, missing files, permissions, missing packages, wrong directory, git state)
+3. Keep the user's intent; change only what is needed to make the command work
+4. If a prerequisite is missing (package, directory, git remote), suggest the command that provides it
+5. Only suggest commands that work on the user's operating system, shell and package manager
+6. Never escalate to destructive or privileged commands (rm -rf, sudo, --force) unless the error clearly requires it
+
+UNDO HINTS:
+For a command that changes files, git state, packages or services, end its explanation with one of:
+- [undo: COMMAND] - the command that reverses it, run in the same directory, only when you are confident it restores the previous state
+- [irreversible] - when data or state is lost for good (deleted files, discarded changes, dropped tables, overwritten remote history)
+Leave the hint out for read-only commands or when you don't know how to reverse the command.
+
+RESPONSE FORMAT:
+One suggestion per line in this exact format:
+COMMAND | brief explanation of the fix (5-10 words max) [undo hint, if any]
+
+Example:
+git push --set-upstream origin feature | Branch has no upstream yet
+make build | Fix typo in target name
+mkdir -p logs | Create the missing directory [undo: rmdir logs]`
+}
+
+// buildFixUserPrompt creates the user prompt for repairing a failed command
+func buildFixUserPrompt(input core.FixInput) string {
+	ctx := input.Context
+	var parts []string
+
+	// Add the failed command and what we know about the failure
+	parts = append(parts, fmt.Sprintf("Failed command: %s", input.Command))
+	if input.ExitCode != 0 {
+		parts = append(parts, fmt.Sprintf("Exit code: %d", input.ExitCode))
+	}
+	if stderr := strings.TrimSpace(input.Stderr); stderr != "" {
+		if len(stderr) > maxFixStderr {
+			stderr = "..." + stderr[len(stderr)-maxFixStderr:]
+		}
+		parts = append(parts, "\nError output:")
+		parts = append(parts, stderr)
+	}
+
+	if ctx == nil {
+		return strings.Join(parts, "\n")
+	}
+
+	// Add system information
+	parts = append(parts, fmt.Sprintf("\nOperating System: %s", ctx.OS))
+	if ctx.Distribution != "" {
+		parts = append(parts, fmt.Sprintf("Distribution: %s", ctx.Distribution))
+	}
+	if ctx.PackageManager != "" {
+		parts = append(parts, fmt.Sprintf("Package Manager: %s", ctx.PackageManager))
+	}
+
+	// Add shell and working directory
+	parts = append(parts, fmt.Sprintf("\nShell: %s", ctx.Shell))
+	parts = append(parts, fmt.Sprintf("Working directory: %s", ctx.CWD))
+
+	// Add git context if available
+	if ctx.Git != nil && ctx.Git.IsRepo {
+		parts = append(parts, "\nGit context:")
+		parts = append(parts, buildGitContextLines(ctx.Git)...)
 	}
 
+	// Add recent history if available
+	if len(ctx.History) > 0 {
+		parts = append(parts, "\nRecent commands (last 5, oldest first):")
+		start := len(ctx.History) - 5
+		if start < 0 {
+			start = 0
+		}
+		now := time.Now()
+		for _, entry := range ctx.History[start:] {
+			parts = append(parts, formatHistoryEntry(entry, ctx.CWD, now))
+		}
+	}
+
+	// Add project-specific context if available
+	if ctx.ProjectContext != "" {
+		parts = append(parts, "\nProject Context (.linesense_context):")
+		parts = append(parts, ctx.ProjectContext)
+	}
+
+	parts = append(parts, "\nSuggest the corrected command:")
+
 	return strings.Join(parts, "\n")
 }
 
+// buildCompleteSystemPrompt creates the system prompt for inline completions
+func buildCompleteSystemPrompt() string {
+	return `You are a shell autocompletion engine. Given what the user has typed so far, predict how they will finish the command.
+
+IMPORTANT RULES:
+1. Respond with ONLY the text to append to the input, exactly as it should be typed (include a leading space if one is needed)
+2. Never repeat the input itself, never add explanations, quotes or markdown
+3. Complete a single command on a single line
+4. Prefer completions that match recent commands, the working directory and the git context
+5. Only complete commands that work on the user's operating system and shell
+6. If you cannot predict a useful completion, respond with nothing`
+}
+
+// buildCompleteUserPrompt creates the user prompt for inline completions. It
+// is kept short so that completions come back quickly.
+func buildCompleteUserPrompt(ctx *core.ContextEnvelope) string {
+	var parts []string
+
+	parts = append(parts, fmt.Sprintf("Input: %s", ctx.Line))
+	parts = append(parts, fmt.Sprintf("\nOperating System: %s", ctx.OS))
+	if ctx.PackageManager != "" {
+		parts = append(parts, fmt.Sprintf("Package Manager: %s", ctx.PackageManager))
+	}
+	parts = append(parts, fmt.Sprintf("Shell: %s", ctx.Shell))
+	parts = append(parts, fmt.Sprintf("Working directory: %s", ctx.CWD))
+
+	if ctx.Git != nil && ctx.Git.IsRepo {
+		parts = append(parts, fmt.Sprintf("Git branch: %s", ctx.Git.Branch))
+	}
+
+	// Add recent history if available
+	if len(ctx.History) > 0 {
+		parts = append(parts, "\nRecent commands (oldest first):")
+		start := len(ctx.History) - 10
+		if start < 0 {
+			start = 0
+		}
+		for _, entry := range ctx.History[start:] {
+			parts = append(parts, fmt.Sprintf("- %s", entry.Command))
+		}
+	}
+
+	parts = append(parts, "\nText to append:")
+
+	return strings.Join(parts, "\n")
+}
+
+// parseCompletion extracts the suffix to append to line from an AI response.
+// Models sometimes return the whole command instead of just the suffix; in
+// that case the input is stripped off again.
+func parseCompletion(response string, line string) string {
+	cleaned := strings.TrimRight(response, " \t\r\n")
+	cleaned = strings.TrimPrefix(cleaned, "```bash")
+	cleaned = strings.TrimPrefix(cleaned, "```sh")
+	cleaned = strings.TrimPrefix(cleaned, "```")
+	cleaned = strings.TrimSuffix(cleaned, "```")
+	cleaned = strings.TrimLeft(cleaned, "\r\n")
+
+	// Keep only the first line
+	if i := strings.IndexAny(cleaned, "\r\n"); i >= 0 {
+		cleaned = cleaned[:i]
+	}
+	cleaned = strings.TrimRight(cleaned, " \t")
+
+	if trimmed := strings.TrimSpace(cleaned); strings.HasPrefix(trimmed, line) {
+		return trimmed[len(line):]
+	}
+	return cleaned
+}
+
 // parseSuggestions extracts command suggestions from AI response
 func parseSuggestions(response string, originalLine string) []core.Suggestion {
 	// Clean up the response
@@ -163,6 +441,7 @@ func parseSuggestions(response string, originalLine string) []core.Suggestion {
 	// Remove markdown code blocks if present
 	cleaned = strings.TrimPrefix(cleaned, "```bash")
 	cleaned = strings.TrimPrefix(cleaned, "```sh")
+	cleaned = strings.TrimPrefix(cleaned, "```fish")
 	cleaned = strings.TrimPrefix(cleaned, "```")
 	cleaned = strings.TrimSuffix(cleaned, "```")
 	cleaned = strings.TrimSpace(cleaned)
@@ -205,8 +484,12 @@ func parseSuggestions(response string, originalLine string) []core.Suggestion {
 			continue
 		}
 
-		// Create suggestion with risk assessment
-		risk := assessRisk(command)
+		// Split off the undo hint the model may end the explanation with
+		explanation, hint := splitUndoHint(explanation)
+
+		// Classify with the built-in safety rules; the engine classifies
+		// again with the full chain once config and cwd are known
+		risk := core.ClassifyRisk(command, nil)
 
 		// Use the extracted explanation if available, otherwise use default
 		if explanation == "" {
@@ -214,10 +497,12 @@ func parseSuggestions(response string, originalLine string) []core.Suggestion {
 		}
 
 		suggestions = append(suggestions, core.Suggestion{
-			Command:     command,
-			Risk:        risk,
-			Explanation: explanation,
-			Source:      "llm",
+			Command:      command,
+			Risk:         risk,
+			Explanation:  explanation,
+			Source:       "llm",
+			Undo:         hint.Undo,
+			Irreversible: hint.Irreversible,
 		})
 
 		// Limit to 5 suggestions max
@@ -229,6 +514,22 @@ func parseSuggestions(response string, originalLine string) []core.Suggestion {
 	return suggestions
 }
 
+// splitUndoHint splits a trailing "[undo: COMMAND]" or "[irreversible]"
+// off an explanation
+func splitUndoHint(explanation string) (string, core.UndoHint) {
+	lower := strings.ToLower(explanation)
+	if rest, ok := strings.CutSuffix(lower, "[irreversible]"); ok {
+		return strings.TrimSpace(explanation[:len(rest)]), core.UndoHint{Irreversible: true}
+	}
+
+	i := strings.LastIndex(lower, "[undo:")
+	if i < 0 || !strings.HasSuffix(explanation, "]") {
+		return explanation, core.UndoHint{}
+	}
+	undo := strings.Trim(strings.TrimSpace(explanation[i+len("[undo:"):len(explanation)-1]), "`")
+	return strings.TrimSpace(explanation[:i]), core.UndoHint{Undo: undo}
+}
+
 // parseExplanation extracts explanation from AI response
 func parseExplanation(response string) core.Explanation {
 	lines := strings.Split(response, "\n")
@@ -272,33 +573,3 @@ func parseExplanation(response string) core.Explanation {
 
 	return explanation
 }
-
-// assessRisk performs basic risk assessment on a command
-func assessRisk(command string) core.RiskLevel {
-	commandLower := strings.ToLower(command)
-
-	// High risk patterns
-	highRiskPatterns := []string{
-		"rm -rf", "dd if=", "mkfs", "> /dev/", "rm /",
-		"chmod 777", "chown -R", "sudo rm",
-	}
-	for _, pattern := range highRiskPatterns {
-		if strings.Contains(commandLower, pattern) {
-			return core.RiskHigh
-		}
-	}
-
-	// Medium risk patterns
-	mediumRiskPatterns := []string{
-		"sudo", "rm ", "mv ", "chmod", "chown",
-		"kill", "pkill", "systemctl stop",
-	}
-	for _, pattern := range mediumRiskPatterns {
-		if strings.Contains(commandLower, pattern) {
-			return core.RiskMedium
-		}
-	}
-
-	// Default to low risk
-	return core.RiskLow
-}
@@ -3,6 +3,7 @@ package ai
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/traves/linesense/internal/core"
 )
@@ -388,7 +389,9 @@ Only reads repository information`,
 	}
 }
 
-func TestAssessRisk(t *testing.T) {
+// TestParseSuggestions_Risk checks that suggestions are classified by the
+// same rules as core.ClassifyRisk
+func TestParseSuggestions_Risk(t *testing.T) {
 	tests := []struct {
 		name     string
 		command  string
@@ -420,10 +423,206 @@ func TestAssessRisk(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			risk := assessRisk(tt.command)
-			if risk != tt.wantRisk {
-				t.Errorf("assessRisk(%q) = %v, want %v", tt.command, risk, tt.wantRisk)
+			suggestions := parseSuggestions(tt.command, "")
+			if len(suggestions) != 1 {
+				t.Fatalf("parseSuggestions(%q) returned %d suggestions, want 1", tt.command, len(suggestions))
+			}
+			if risk := suggestions[0].Risk; risk != tt.wantRisk {
+				t.Errorf("risk of %q = %v, want %v", tt.command, risk, tt.wantRisk)
+			}
+			if want := core.ClassifyRisk(tt.command, nil); suggestions[0].Risk != want {
+				t.Errorf("risk of %q = %v, but core.ClassifyRisk = %v", tt.command, suggestions[0].Risk, want)
+			}
+		})
+	}
+}
+
+func TestBuildSuggestUserPrompt_GitOperation(t *testing.T) {
+	ctx := &core.ContextEnvelope{
+		Shell: "zsh",
+		Line:  "finish this",
+		CWD:   "/home/user/project",
+		OS:    "linux",
+		Git: &core.GitInfo{
+			IsRepo:        true,
+			Branch:        "feature",
+			Detached:      true,
+			StatusSummary: "conflicted",
+			Upstream:      "origin/feature",
+			Ahead:         2,
+			Behind:        1,
+			Operation:     "rebase",
+			Conflicts:     []string{"main.go"},
+			StashCount:    3,
+			RecentCommits: []string{"Add parser"},
+			Tags:          []string{"v1.0.0"},
+		},
+	}
+
+	prompt := buildSuggestUserPrompt(ctx)
+
+	expected := []string{
+		"detached at feature",
+		"origin/feature (ahead 2, behind 1)",
+		"In progress: rebase",
+		"git rebase --continue",
+		"Conflicted files: main.go",
+		"Stash entries: 3",
+		"Tags on HEAD: v1.0.0",
+		"Add parser",
+	}
+	for _, want := range expected {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Prompt should contain %q", want)
+		}
+	}
+}
+
+func TestFormatHistoryEntry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	timestamp := now.Add(-5 * time.Minute).Format(time.RFC3339)
+	duration := 12
+	exitCode := 127
+	success := 0
+
+	tests := []struct {
+		name  string
+		entry core.HistoryEntry
+		want  string
+	}{
+		{"plain", core.HistoryEntry{Command: "ls"}, "- ls"},
+		{"timestamp", core.HistoryEntry{Command: "make", Timestamp: &timestamp}, "- make (5m ago)"},
+		{"timestamp and duration", core.HistoryEntry{Command: "make", Timestamp: &timestamp, Duration: &duration}, "- make (5m ago, ran 12s)"},
+		{"failed", core.HistoryEntry{Command: "mkae", ExitCode: &exitCode}, "- mkae (failed, exit 127)"},
+		{"succeeded", core.HistoryEntry{Command: "make", ExitCode: &success}, "- make"},
+		{"same directory", core.HistoryEntry{Command: "make", CWD: "/repo"}, "- make"},
+		{"other directory", core.HistoryEntry{Command: "make", CWD: "/tmp", ExitCode: &exitCode}, "- make (failed, exit 127, in /tmp)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatHistoryEntry(tt.entry, "/repo", now); got != tt.want {
+				t.Errorf("formatHistoryEntry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildFixUserPrompt(t *testing.T) {
+	input := core.FixInput{
+		Command:  "git psuh",
+		ExitCode: 1,
+		Stderr:   strings.Repeat("x", maxFixStderr) + "\ngit: 'psuh' is not a git command.",
+		Context: &core.ContextEnvelope{
+			Shell: "zsh",
+			CWD:   "/repo",
+			OS:    "linux",
+			Git:   &core.GitInfo{IsRepo: true, Branch: "main"},
+		},
+	}
+
+	prompt := buildFixUserPrompt(input)
+
+	expected := []string{
+		"Failed command: git psuh",
+		"Exit code: 1",
+		"'psuh' is not a git command",
+		"Shell: zsh",
+		"Branch: main",
+	}
+	for _, want := range expected {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Prompt should contain %q", want)
+		}
+	}
+
+	// Long error output is truncated from the front
+	if strings.Contains(prompt, strings.Repeat("x", maxFixStderr)) {
+		t.Error("Prompt should truncate long error output")
+	}
+}
+
+func TestBuildFixUserPrompt_UnknownExitCode(t *testing.T) {
+	prompt := buildFixUserPrompt(core.FixInput{Command: "foo"})
+
+	if strings.Contains(prompt, "Exit code") {
+		t.Error("Prompt should not mention an unknown exit code")
+	}
+	if strings.Contains(prompt, "Error output") {
+		t.Error("Prompt should not include an empty error output section")
+	}
+}
+
+func TestParseCompletion(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		line     string
+		want     string
+	}{
+		{"suffix", " status\n", "git", " status"},
+		{"whole command", "git status --short", "git st", "atus --short"},
+		{"code block", "```bash\ngit status\n```", "git", " status"},
+		{"first line only", "atus\nexplanation", "git st", "atus"},
+		{"input repeated", "git status", "git status", ""},
+		{"empty", "", "git", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCompletion(tt.response, tt.line); got != tt.want {
+				t.Errorf("parseCompletion(%q, %q) = %q, want %q", tt.response, tt.line, got, tt.want)
 			}
 		})
 	}
 }
+
+func TestBuildCompleteUserPrompt(t *testing.T) {
+	ctx := &core.ContextEnvelope{
+		Line:  "git ch",
+		Shell: "zsh",
+		CWD:   "/repo",
+		OS:    "linux",
+		Git:   &core.GitInfo{IsRepo: true, Branch: "feature"},
+		History: []core.HistoryEntry{
+			{Command: "git fetch"},
+		},
+	}
+
+	prompt := buildCompleteUserPrompt(ctx)
+
+	for _, want := range []string{"Input: git ch", "Shell: zsh", "Git branch: feature", "- git fetch"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Prompt should contain %q", want)
+		}
+	}
+}
+
+func TestParseSuggestions_UndoHints(t *testing.T) {
+	response := "git stash | Set aside changes [undo: `git stash pop`]\n" +
+		"rm -rf build | Delete the build directory [Irreversible]\n" +
+		"mkdir -p logs | Create the directory [undo: [ -d logs ] && rmdir logs]\n" +
+		"ls -la | List files [sorted]"
+
+	suggestions := parseSuggestions(response, "clean up")
+
+	tests := []struct {
+		explanation  string
+		undo         string
+		irreversible bool
+	}{
+		{"Set aside changes", "git stash pop", false},
+		{"Delete the build directory", "", true},
+		{"Create the directory", "[ -d logs ] && rmdir logs", false},
+		{"List files [sorted]", "", false},
+	}
+	if len(suggestions) != len(tests) {
+		t.Fatalf("got %d suggestions, want %d", len(suggestions), len(tests))
+	}
+	for i, tt := range tests {
+		got := suggestions[i]
+		if got.Explanation != tt.explanation || got.Undo != tt.undo || got.Irreversible != tt.irreversible {
+			t.Errorf("suggestions[%d] = %q, undo %q, irreversible %v, want %q, %q, %v", i, got.Explanation, got.Undo, got.Irreversible, tt.explanation, tt.undo, tt.irreversible)
+		}
+	}
+}
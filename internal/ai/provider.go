@@ -1,6 +1,7 @@
 package ai
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/traves/linesense/internal/config"
@@ -24,3 +25,55 @@ func NewProvider(cfg *config.ProvidersConfig, profileName string) (core.Provider
 		return nil, fmt.Errorf("unsupported provider: %s", profile.Provider)
 	}
 }
+
+// LoadProvider loads providers.toml and creates the provider for profileName.
+// If that fails, the returned provider fails every call with the error, so
+// requests that don't need a model (such as history completions) still work.
+func LoadProvider(profileName string) core.Provider {
+	providersCfg, err := config.LoadProvidersConfig()
+	if err != nil {
+		return NewUnavailableProvider(fmt.Errorf("failed to load providers config: %w", err))
+	}
+
+	provider, err := NewProvider(providersCfg, profileName)
+	if err != nil {
+		return NewUnavailableProvider(fmt.Errorf("failed to create provider: %w", err))
+	}
+	return provider
+}
+
+// unavailableProvider stands in for a provider that could not be created.
+// Every model call fails with the creation error.
+type unavailableProvider struct {
+	err error
+}
+
+// NewUnavailableProvider returns a provider whose calls all fail with err
+func NewUnavailableProvider(err error) core.Provider {
+	return &unavailableProvider{err: err}
+}
+
+// Name returns the provider name
+func (p *unavailableProvider) Name() string {
+	return "unavailable"
+}
+
+// Suggest returns the creation error
+func (p *unavailableProvider) Suggest(_ context.Context, _ core.SuggestInput) ([]core.Suggestion, error) {
+	return nil, p.err
+}
+
+// Explain returns the creation error
+func (p *unavailableProvider) Explain(_ context.Context, _ core.ExplainInput) (core.Explanation, error) {
+	return core.Explanation{}, p.err
+}
+
+// Fix returns the creation error
+func (p *unavailableProvider) Fix(_ context.Context, _ core.FixInput) ([]core.Suggestion, error) {
+	return nil, p.err
+}
+
+// Complete returns the creation error
+func (p *unavailableProvider) Complete(_ context.Context, _ core.CompleteInput) (string, error) {
+	return "", p.err
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
@@ -21,12 +22,14 @@ type Config struct {
 type ShellConfig struct {
 	EnableBash bool `toml:"enable_bash"`
 	EnableZsh  bool `toml:"enable_zsh"`
+	EnableFish bool `toml:"enable_fish"`
 }
 
 // KeybindingsConfig defines keybindings for shell actions
 type KeybindingsConfig struct {
 	Suggest      string `toml:"suggest"`      // e.g. "ctrl+space"
 	Explain      string `toml:"explain"`      // e.g. "ctrl+e"
+	Fix          string `toml:"fix"`          // e.g. "ctrl+x ctrl+f"
 	Alternatives string `toml:"alternatives"` // e.g. "alt+a"
 }
 
@@ -37,13 +40,104 @@ type ContextConfig struct {
 	IncludeFiles       bool   `toml:"include_files"`
 	IncludeEnv         bool   `toml:"include_env"`
 	GlobalInstructions string `toml:"global_instructions"` // User-defined global context/rules
+	// Per-collector time budgets in milliseconds, keyed by collector name
+	// ("git", "git_status", "history", "distribution", "package_manager",
+	// "env", "project_context", "hostname")
+	CollectorTimeoutsMs map[string]int `toml:"collector_timeouts_ms"`
 }
 
 // SafetyConfig defines safety rules
 type SafetyConfig struct {
 	RequireConfirmPatterns []string `toml:"require_confirm_patterns"`
 	Denylist               []string `toml:"denylist"`
-	DefaultExecution       string   `toml:"default_execution"` // "paste_only" (v0.1)
+	DefaultExecution       string   `toml:"default_execution"` // paste_only, confirm, confirm_high_risk or auto_low_risk
+
+	// Allowlist holds regular expressions for commands known to be safe. A
+	// command matching one in full is low risk whatever the rules say; the
+	// denylist still applies.
+	Allowlist []string `toml:"allowlist"`
+
+	// Rules overrides individual rules, keyed by rule ID
+	Rules map[string]RuleOverride `toml:"rules"`
+
+	// MaxTargets is how many files rm, mv, chmod -R, find -delete and the
+	// like may affect before they are high risk (default 100)
+	MaxTargets int `toml:"max_targets"`
+
+	// SensitiveEnvironments are environments, such as production, in which
+	// commands that change state are high risk
+	SensitiveEnvironments []SensitiveEnvironment `toml:"sensitive_environments"`
+
+	// RiskPlugins are executables that classify commands in addition to the
+	// built-in rules ("~/" is expanded)
+	RiskPlugins []string `toml:"risk_plugins"`
+
+	// Projects holds extra rules for commands run inside a directory, keyed
+	// by the project's root path ("~/" is expanded)
+	Projects map[string]ProjectSafetyConfig `toml:"projects"`
+}
+
+// ProjectSafetyConfig defines safety rules that apply inside one project.
+// Its allowlist adds to the global one and its rule overrides take
+// precedence over global overrides of the same rule.
+type ProjectSafetyConfig struct {
+	RequireConfirmPatterns []string                `toml:"require_confirm_patterns"`
+	Allowlist              []string                `toml:"allowlist"`
+	Rules                  map[string]RuleOverride `toml:"rules"`
+}
+
+// SensitiveEnvironment describes an environment by glob patterns (as in
+// path.Match) for the active kube context, AWS profile, git branch or host
+// name. The environment is active when any pattern matches.
+type SensitiveEnvironment struct {
+	Name         string   `toml:"name"`
+	KubeContexts []string `toml:"kube_contexts"`
+	AWSProfiles  []string `toml:"aws_profiles"`
+	GitBranches  []string `toml:"git_branches"`
+	Hostnames    []string `toml:"hostnames"`
+}
+
+// RuleOverride loosens one rule: Disable drops its findings, Downgrade
+// lowers their severity to "medium" or "low"
+type RuleOverride struct {
+	Disable   bool   `toml:"disable"`
+	Downgrade string `toml:"downgrade"`
+}
+
+// ProjectFor returns the project rules that apply in cwd and the project's
+// root. When projects are nested, the innermost one wins.
+func (c *SafetyConfig) ProjectFor(cwd string) (string, ProjectSafetyConfig, bool) {
+	if c == nil || cwd == "" {
+		return "", ProjectSafetyConfig{}, false
+	}
+
+	cwd = filepath.Clean(cwd)
+	var (
+		bestRoot string
+		best     ProjectSafetyConfig
+	)
+	for root, project := range c.Projects {
+		dir := filepath.Clean(expandHome(root))
+		if cwd != dir && !strings.HasPrefix(cwd, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+			continue
+		}
+		if len(dir) > len(bestRoot) {
+			bestRoot, best = dir, project
+		}
+	}
+	return bestRoot, best, bestRoot != ""
+}
+
+// expandHome replaces a leading "~" with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
 }
 
 // AIConfig controls AI provider settings
@@ -194,3 +194,38 @@ provider_profile = "broken
 		t.Error("LoadConfig() should error on invalid TOML")
 	}
 }
+
+func TestSafetyConfig_ProjectFor(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+
+	cfg := &SafetyConfig{
+		Projects: map[string]ProjectSafetyConfig{
+			"/srv/app":          {RequireConfirmPatterns: []string{"deploy"}},
+			"/srv/app/infra/":   {RequireConfirmPatterns: []string{"terraform apply"}},
+			"~/work/prod-tools": {RequireConfirmPatterns: []string{"kubectl"}},
+		},
+	}
+
+	tests := []struct {
+		cwd      string
+		wantRoot string
+		wantOK   bool
+	}{
+		{"/srv/app", "/srv/app", true},
+		{"/srv/app/src", "/srv/app", true},
+		{"/srv/app/infra/modules", "/srv/app/infra", true},
+		{"/srv/application", "", false},
+		{filepath.Join(home, "work/prod-tools/bin"), filepath.Join(home, "work/prod-tools"), true},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		root, _, ok := cfg.ProjectFor(tt.cwd)
+		if root != tt.wantRoot || ok != tt.wantOK {
+			t.Errorf("ProjectFor(%q) = %q, %v; want %q, %v", tt.cwd, root, ok, tt.wantRoot, tt.wantOK)
+		}
+	}
+}
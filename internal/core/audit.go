@@ -0,0 +1,246 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+// Audit actions
+const (
+	AuditAccepted  = "accepted"  // picked in the interactive picker
+	AuditConfirmed = "confirmed" // confirmed by typing and then run by linesense run
+	AuditExecuted  = "executed"  // run by linesense run without confirmation
+)
+
+const (
+	auditLockWait  = 2 * time.Second  // how long LogAudit waits for another writer
+	auditLockStale = 10 * time.Second // age at which a left-over lock is removed
+)
+
+// AuditRecord records a medium- or high-risk command that was accepted,
+// confirmed or run. Records form a hash chain: each holds the hash of the
+// one before it, so editing, removing or reordering records breaks the
+// chain from that point on.
+type AuditRecord struct {
+	Seq       int       `json:"seq"`       // 1 for the first record
+	Timestamp string    `json:"timestamp"` // RFC 3339
+	User      string    `json:"user"`
+	Host      string    `json:"host"`
+	CWD       string    `json:"cwd"`
+	Command   string    `json:"command"`
+	Action    string    `json:"action"` // "accepted" | "confirmed" | "executed"
+	Policy    string    `json:"policy,omitempty"`
+	Risk      RiskLevel `json:"risk"`
+	Findings  []Finding `json:"findings,omitempty"`
+	Model     string    `json:"model,omitempty"` // empty for preset suggestions
+	PrevHash  string    `json:"prev_hash"`       // empty for the first record
+	Hash      string    `json:"hash"`
+}
+
+// AuditError reports where the audit log's hash chain is broken
+type AuditError struct {
+	Line   int
+	Reason string
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit log line %d: %s", e.Line, e.Reason)
+}
+
+// AuditLogPath returns the audit log of accepted and executed commands
+func AuditLogPath() string {
+	return filepath.Join(config.GetConfigDir(), "audit.jsonl")
+}
+
+// ShouldAudit reports whether commands of the given risk are audited
+func ShouldAudit(risk RiskLevel) bool {
+	return risk == RiskMedium || risk == RiskHigh
+}
+
+// LogAudit fills in record's timestamp, user, host and place in the chain
+// and appends it to the audit log. It refuses to extend a log whose last
+// record can't be read, since the new record couldn't be chained to it.
+func LogAudit(record AuditRecord) (AuditRecord, error) {
+	path := AuditLogPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return record, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	unlock, err := lockAuditLog(path)
+	if err != nil {
+		return record, err
+	}
+	defer unlock()
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return record, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	last, err := lastAuditRecord(file)
+	if err != nil {
+		return record, err
+	}
+
+	record.Seq, record.PrevHash = 1, ""
+	if last != nil {
+		record.Seq, record.PrevHash = last.Seq+1, last.Hash
+	}
+	record.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	record.User, record.Host = currentUser(), hostname()
+	record.Hash, err = hashAuditRecord(record)
+	if err != nil {
+		return record, err
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return record, fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return record, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return record, nil
+}
+
+// ReadAuditLog returns the records in the audit log, or none if there is no
+// log yet
+func ReadAuditLog() ([]AuditRecord, error) {
+	file, err := os.Open(AuditLogPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var records []AuditRecord
+	reader := bufio.NewReader(file)
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record AuditRecord
+			if jsonErr := json.Unmarshal(line, &record); jsonErr != nil {
+				return records, &AuditError{Line: n, Reason: "not a valid record: " + jsonErr.Error()}
+			}
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("failed to read audit log: %w", err)
+		}
+	}
+}
+
+// VerifyAuditLog checks that every record's hash matches its contents and
+// that each record follows the one before it. Records removed from the end
+// of the log can't be detected this way; compare the last hash with one
+// kept elsewhere for that.
+func VerifyAuditLog(records []AuditRecord) error {
+	prev := ""
+	for i, record := range records {
+		line := i + 1
+		if record.Seq != line {
+			return &AuditError{Line: line, Reason: fmt.Sprintf("sequence number is %d, want %d", record.Seq, line)}
+		}
+		if record.PrevHash != prev {
+			return &AuditError{Line: line, Reason: "previous hash doesn't match the record before it"}
+		}
+		hash, err := hashAuditRecord(record)
+		if err != nil {
+			return err
+		}
+		if record.Hash != hash {
+			return &AuditError{Line: line, Reason: "hash doesn't match the record's contents"}
+		}
+		prev = record.Hash
+	}
+	return nil
+}
+
+// hashAuditRecord returns the hex SHA-256 of record encoded as JSON with an
+// empty hash. The encoding includes the previous hash, which chains it.
+func hashAuditRecord(record AuditRecord) (string, error) {
+	record.Hash = ""
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastAuditRecord reads the last record in file, or nil when it is empty.
+// Only the end of the file is read, so appending stays cheap as it grows.
+func lastAuditRecord(file *os.File) (*AuditRecord, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	size := info.Size()
+
+	for window := int64(64 << 10); ; window *= 2 {
+		start := max(size-window, 0)
+		buf := make([]byte, size-start)
+		if _, err := file.ReadAt(buf, start); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		buf = bytes.TrimRight(buf, "\n")
+		if len(buf) == 0 && start == 0 {
+			return nil, nil
+		}
+		i := bytes.LastIndexByte(buf, '\n')
+		if i < 0 && start > 0 {
+			continue // the last line is longer than the window
+		}
+
+		var record AuditRecord
+		if err := json.Unmarshal(buf[i+1:], &record); err != nil || record.Hash == "" {
+			return nil, fmt.Errorf("audit log's last record is unreadable, so new records can't be chained to it; check it with linesense audit verify")
+		}
+		return &record, nil
+	}
+}
+
+// lockAuditLog takes a lock file next to path so that concurrent writers
+// don't chain two records to the same predecessor. A lock older than
+// auditLockStale was left by a writer that died and is removed.
+func lockAuditLog(path string) (func(), error) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(auditLockWait)
+	for {
+		file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock audit log: %w", err)
+		}
+
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > auditLockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock audit log: %s is held by another process", lock)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
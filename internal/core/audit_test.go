@@ -0,0 +1,112 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestLogAudit(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	commands := []string{"rm -rf build", "git push --force", "kubectl delete pod web-1"}
+	for _, command := range commands {
+		record := AuditRecord{CWD: "/src", Command: command, Action: AuditConfirmed, Risk: RiskHigh, Model: "test/model",
+			Findings: []Finding{{Rule: "rm-recursive", Span: Span{Start: 0, End: 6}, Source: "builtin", Severity: RiskHigh, Reason: "deletes <files> & directories"}}}
+		if _, err := LogAudit(record); err != nil {
+			t.Fatalf("LogAudit() error = %v", err)
+		}
+	}
+
+	info, err := os.Stat(AuditLogPath())
+	if err != nil {
+		t.Fatalf("audit log not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	records, err := ReadAuditLog()
+	if err != nil {
+		t.Fatalf("ReadAuditLog() error = %v", err)
+	}
+	if len(records) != len(commands) {
+		t.Fatalf("got %d records, want %d", len(records), len(commands))
+	}
+	for i, record := range records {
+		if record.Seq != i+1 || record.Command != commands[i] || record.User == "" || record.Timestamp == "" {
+			t.Errorf("record %d = %+v", i, record)
+		}
+	}
+	if records[0].PrevHash != "" || records[1].PrevHash != records[0].Hash {
+		t.Errorf("records aren't chained: %+v", records)
+	}
+	if err := VerifyAuditLog(records); err != nil {
+		t.Errorf("VerifyAuditLog() error = %v", err)
+	}
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, command := range []string{"rm a", "rm b", "rm c"} {
+		if _, err := LogAudit(AuditRecord{Command: command, Action: AuditExecuted, Risk: RiskMedium}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	records, err := ReadAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		tamper   func([]AuditRecord) []AuditRecord
+		wantLine int // 0 for an intact log
+	}{
+		{"intact", func(r []AuditRecord) []AuditRecord { return r }, 0},
+		{"edited command", func(r []AuditRecord) []AuditRecord { r[1].Command = "ls"; return r }, 2},
+		{"edited and rehashed", func(r []AuditRecord) []AuditRecord {
+			r[1].Command = "ls"
+			r[1].Hash, _ = hashAuditRecord(r[1])
+			return r
+		}, 3},
+		{"removed record", func(r []AuditRecord) []AuditRecord { return slices.Delete(r, 1, 2) }, 2},
+		{"reordered", func(r []AuditRecord) []AuditRecord { r[1], r[2] = r[2], r[1]; return r }, 2},
+		{"removed from the end", func(r []AuditRecord) []AuditRecord { return r[:2] }, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyAuditLog(tt.tamper(slices.Clone(records)))
+			var auditErr *AuditError
+			switch {
+			case tt.wantLine == 0 && err != nil:
+				t.Errorf("VerifyAuditLog() error = %v, want nil", err)
+			case tt.wantLine != 0 && (!errors.As(err, &auditErr) || auditErr.Line != tt.wantLine):
+				t.Errorf("VerifyAuditLog() error = %v, want one at line %d", err, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestLogAudit_UnreadableLastRecord(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, err := LogAudit(AuditRecord{Command: "rm a", Action: AuditExecuted, Risk: RiskMedium}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(AuditLogPath(), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"seq":2,"command":"rm b"` + "\n")
+	file.Close()
+
+	if _, err := LogAudit(AuditRecord{Command: "rm c", Action: AuditExecuted, Risk: RiskMedium}); err == nil {
+		t.Error("LogAudit() error = nil, want an error for an unreadable last record")
+	}
+	if _, err := ReadAuditLog(); err == nil {
+		t.Error("ReadAuditLog() error = nil, want an error for an invalid line")
+	}
+}
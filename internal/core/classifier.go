@@ -0,0 +1,197 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+// RiskInput is what a risk classifier is asked about
+type RiskInput struct {
+	Command string
+	CWD     string
+	// ModelRisk is the risk the model reported for the command, or empty
+	// when there is none (suggestions and completions)
+	ModelRisk RiskLevel
+	// CountTargets counts the files destructive commands affect, which
+	// walks the filesystem and runs git. Set it only when a decision
+	// depends on it, like confirming a command before it runs.
+	CountTargets bool
+
+	// Where the command runs, for safety.sensitive_environments. The git
+	// branch and host name are looked up when empty.
+	KubeContext string
+	AWSProfile  string
+	GitBranch   string
+	Hostname    string
+}
+
+// NewRiskInput describes command run in the context env was collected for
+func NewRiskInput(command string, env *ContextEnvelope) RiskInput {
+	input := RiskInput{Command: command}
+	if env == nil {
+		return input
+	}
+	input.CWD = env.CWD
+	input.KubeContext = env.KubeContext
+	input.AWSProfile = env.AWSProfile
+	input.Hostname = env.Hostname
+	if env.Git != nil {
+		input.GitBranch = env.Git.Branch
+	}
+	return input
+}
+
+// RiskClassifier reports the findings for one command. Classifiers only add
+// findings; how they combine into a risk level is decided by MaxSeverity.
+type RiskClassifier interface {
+	Name() string
+	Classify(ctx context.Context, input RiskInput) []Finding
+}
+
+// RiskChain runs classifiers in order and combines their findings
+type RiskChain struct {
+	classifiers []RiskClassifier
+	// overrides holds the allowlist and rule overrides applied to the
+	// findings
+	overrides *config.SafetyConfig
+}
+
+// NewRiskChain creates a chain of classifiers
+func NewRiskChain(classifiers ...RiskClassifier) *RiskChain {
+	return &RiskChain{classifiers: classifiers}
+}
+
+// DefaultRiskChain returns the chain used for every command: built-in rules,
+// require_confirm_patterns (global and per project), the model-reported
+// risk, then the configured risk plugins. The allowlist and rule overrides
+// in cfg are applied to the findings.
+func DefaultRiskChain(cfg *config.SafetyConfig) *RiskChain {
+	builtin := BuiltinClassifier{}
+	if cfg != nil {
+		builtin.MaxTargets = cfg.MaxTargets
+		builtin.Environments = cfg.SensitiveEnvironments
+	}
+	chain := NewRiskChain(builtin, ConfigClassifier{Config: cfg}, ModelClassifier{})
+	chain.overrides = cfg
+	if cfg != nil {
+		for _, path := range cfg.RiskPlugins {
+			chain.classifiers = append(chain.classifiers, NewPluginClassifier(path))
+		}
+	}
+	return chain
+}
+
+// Classify returns the risk of input and the findings behind it, ordered from
+// most to least severe
+func (c *RiskChain) Classify(ctx context.Context, input RiskInput) (RiskLevel, []Finding) {
+	risk, findings, _ := c.ClassifyOverrides(ctx, input)
+	return risk, findings
+}
+
+// ClassifyOverrides is Classify that also returns the allowlist entries and
+// rule overrides that loosened the findings. Nothing is logged here, as
+// commands are classified far more often than they are used: callers log the
+// events with LogOverrides once the command is accepted or run.
+func (c *RiskChain) ClassifyOverrides(ctx context.Context, input RiskInput) (RiskLevel, []Finding, []OverrideEvent) {
+	var findings []Finding
+	for _, classifier := range c.classifiers {
+		findings = append(findings, classifier.Classify(ctx, input)...)
+	}
+	findings, events := applyOverrides(c.overrides, input, findings)
+	findings = sortFindings(findings)
+	return MaxSeverity(findings), findings, events
+}
+
+// MaxSeverity is the policy for combining findings into a risk level: the
+// most severe finding wins, and a command without findings is low risk. No
+// classifier can lower the risk another one reported.
+func MaxSeverity(findings []Finding) RiskLevel {
+	risk := RiskLow
+	for _, finding := range findings {
+		risk = maxRisk(risk, finding.Severity)
+	}
+	return risk
+}
+
+// BuiltinClassifier applies the rules shipped with linesense: shell-syntax
+// analysis, or regular expressions when the command can't be parsed. When
+// the working directory is known, the targets of destructive commands are
+// resolved too, and counted if the input asks for it, and commands that
+// change a sensitive environment are escalated.
+type BuiltinClassifier struct {
+	// MaxTargets is how many files a destructive command may affect before
+	// it is high risk; zero means DefaultMaxTargets
+	MaxTargets int
+	// Environments are the environments in which commands that change
+	// state are high risk
+	Environments []config.SensitiveEnvironment
+}
+
+// Name returns the classifier name
+func (BuiltinClassifier) Name() string { return SourceBuiltin }
+
+// Classify returns the built-in findings for input
+func (c BuiltinClassifier) Classify(ctx context.Context, input RiskInput) []Finding {
+	hits, ok := analyzeShell(input.Command, newPathContext(ctx, input.CWD, c.MaxTargets, input.CountTargets), newRiskEnv(c.Environments, input))
+	if !ok {
+		return matchPatterns(input.Command)
+	}
+
+	findings := make([]Finding, 0, len(hits))
+	for _, hit := range hits {
+		findings = append(findings, Finding{
+			Rule:     hit.rule,
+			Span:     Span{hit.pos, hit.end},
+			Source:   SourceBuiltin,
+			Severity: hit.level,
+			Reason:   hit.reason,
+			Targets:  hit.targets,
+		})
+	}
+	return findings
+}
+
+// ConfigClassifier applies require_confirm_patterns from the config, and from
+// the project containing the working directory
+type ConfigClassifier struct {
+	Config *config.SafetyConfig
+}
+
+// Name returns the classifier name
+func (ConfigClassifier) Name() string { return SourceConfig }
+
+// Classify returns a high-risk finding for every pattern matching input
+func (c ConfigClassifier) Classify(_ context.Context, input RiskInput) []Finding {
+	if c.Config == nil {
+		return nil
+	}
+
+	findings := matchConfirmPatterns(input.Command, c.Config.RequireConfirmPatterns, SourceConfig, "require_confirm_patterns")
+	if root, project, ok := c.Config.ProjectFor(input.CWD); ok {
+		findings = append(findings, matchConfirmPatterns(input.Command, project.RequireConfirmPatterns, SourceProject, "the require_confirm_patterns of project "+root)...)
+	}
+	return findings
+}
+
+// ModelClassifier turns the risk the model reported in an explanation into a
+// finding, so that it is combined with the rules like any other classifier
+type ModelClassifier struct{}
+
+// Name returns the classifier name
+func (ModelClassifier) Name() string { return SourceModel }
+
+// Classify returns a finding when the model rated input above low risk
+func (ModelClassifier) Classify(_ context.Context, input RiskInput) []Finding {
+	if input.ModelRisk != RiskMedium && input.ModelRisk != RiskHigh {
+		return nil
+	}
+	return []Finding{{
+		Rule:     "model-risk",
+		Span:     Span{0, len(input.Command)},
+		Source:   SourceModel,
+		Severity: input.ModelRisk,
+		Reason:   fmt.Sprintf("the model rated this command %s risk", input.ModelRisk),
+	}}
+}
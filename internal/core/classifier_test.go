@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+// staticClassifier reports the same findings for every command
+type staticClassifier []Finding
+
+func (staticClassifier) Name() string { return "static" }
+
+func (c staticClassifier) Classify(context.Context, RiskInput) []Finding { return c }
+
+func TestRiskChain_MaxSeverity(t *testing.T) {
+	medium := Finding{Rule: "m", Source: "static", Severity: RiskMedium, Reason: "medium"}
+	high := Finding{Rule: "h", Source: "static", Severity: RiskHigh, Reason: "high"}
+
+	tests := []struct {
+		name        string
+		classifiers []RiskClassifier
+		want        RiskLevel
+		wantFirst   string
+	}{
+		{"no classifiers", nil, RiskLow, ""},
+		{"no findings", []RiskClassifier{staticClassifier(nil)}, RiskLow, ""},
+		{"later classifier raises", []RiskClassifier{staticClassifier{medium}, staticClassifier{high}}, RiskHigh, "h"},
+		{"later classifier can't lower", []RiskClassifier{staticClassifier{high}, staticClassifier{medium}}, RiskHigh, "h"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			risk, findings := NewRiskChain(tt.classifiers...).Classify(context.Background(), RiskInput{Command: "x"})
+			if risk != tt.want {
+				t.Errorf("risk = %v, want %v", risk, tt.want)
+			}
+			if tt.wantFirst != "" && (len(findings) == 0 || findings[0].Rule != tt.wantFirst) {
+				t.Errorf("findings = %+v, want %q first", findings, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestDefaultRiskChain_ModelRisk(t *testing.T) {
+	chain := DefaultRiskChain(nil)
+
+	tests := []struct {
+		command   string
+		modelRisk RiskLevel
+		want      RiskLevel
+	}{
+		{"ls", "", RiskLow},
+		{"ls", RiskLow, RiskLow},
+		{"ls", RiskMedium, RiskMedium},
+		{"rm -rf /", RiskLow, RiskHigh}, // the model can't lower the rules
+	}
+
+	for _, tt := range tests {
+		risk, findings := chain.Classify(context.Background(), RiskInput{Command: tt.command, ModelRisk: tt.modelRisk})
+		if risk != tt.want {
+			t.Errorf("Classify(%q, model %q) = %v, want %v", tt.command, tt.modelRisk, risk, tt.want)
+		}
+		if tt.modelRisk == RiskMedium && (len(findings) != 1 || findings[0].Source != SourceModel) {
+			t.Errorf("findings = %+v, want one model finding", findings)
+		}
+	}
+}
+
+func TestPluginClassifier(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin := func(name, script string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	flagProd := writePlugin("prod", `grep -q prod && echo '{"findings":[{"rule":"prod-host","span":{"start":4,"end":8},"severity":"high","reason":"touches production"},{"rule":"noise","severity":"low"}]}' || echo '{"findings":[]}'`)
+	broken := writePlugin("broken", "echo oops >&2; exit 3")
+	garbage := writePlugin("garbage", "echo not json")
+
+	tests := []struct {
+		name     string
+		plugin   string
+		command  string
+		wantRule string
+		wantRisk RiskLevel
+	}{
+		{"finding", flagProd, "ssh prod uptime", "prod:prod-host", RiskHigh},
+		{"no finding", flagProd, "ssh dev uptime", "", RiskLow},
+		{"plugin fails", broken, "ls", "broken:plugin-error", RiskMedium},
+		{"invalid output", garbage, "ls", "garbage:plugin-error", RiskMedium},
+		{"missing plugin", filepath.Join(dir, "missing"), "ls", "missing:plugin-error", RiskMedium},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			risk, findings := NewRiskChain(NewPluginClassifier(tt.plugin)).Classify(context.Background(), RiskInput{Command: tt.command})
+			if risk != tt.wantRisk {
+				t.Errorf("risk = %v, want %v (findings %+v)", risk, tt.wantRisk, findings)
+			}
+			if tt.wantRule == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings = %+v, want none", findings)
+				}
+				return
+			}
+			if len(findings) != 1 || findings[0].Rule != tt.wantRule || findings[0].Source != SourcePlugin {
+				t.Fatalf("findings = %+v, want one %q plugin finding", findings, tt.wantRule)
+			}
+			if tt.wantRisk == RiskHigh && findings[0].Span != (Span{4, 8}) {
+				t.Errorf("span = %+v, want {4 8}", findings[0].Span)
+			}
+			if strings.HasSuffix(tt.wantRule, "plugin-error") && !strings.Contains(findings[0].Reason, "failed") {
+				t.Errorf("reason = %q, want it to say the plugin failed", findings[0].Reason)
+			}
+		})
+	}
+}
+
+func TestDefaultRiskChain_Plugins(t *testing.T) {
+	plugin := filepath.Join(t.TempDir(), "always")
+	script := `#!/bin/sh
+echo '{"findings":[{"rule":"always","severity":"medium","reason":"always flagged"}]}'
+`
+	if err := os.WriteFile(plugin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.SafetyConfig{RiskPlugins: []string{plugin}}
+	if risk := ClassifyRisk("ls", cfg); risk != RiskMedium {
+		t.Errorf("ClassifyRisk() = %v, want the plugin's medium", risk)
+	}
+}
@@ -0,0 +1,262 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+// Default time budgets for each context collector. A collector that does not
+// finish within its budget is dropped and the suggestion proceeds without it.
+var defaultCollectorBudgets = map[string]time.Duration{
+	"distribution":    100 * time.Millisecond,
+	"package_manager": 200 * time.Millisecond,
+	"git":             500 * time.Millisecond,
+	"git_status":      500 * time.Millisecond,
+	"history":         250 * time.Millisecond,
+	"env":             50 * time.Millisecond,
+	"project_context": 50 * time.Millisecond,
+	"hostname":        50 * time.Millisecond,
+}
+
+// CollectorTiming records how long a context collector ran
+type CollectorTiming struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Budget   time.Duration `json:"budget"`
+	Dropped  bool          `json:"dropped"` // true if the collector exceeded its budget
+}
+
+// collector gathers one piece of context. collect runs on its own goroutine
+// and returns a function that applies the result to the envelope; apply
+// functions are only ever called from the goroutine running CollectContext.
+type collector struct {
+	name    string
+	collect func(ctx context.Context) func(*ContextEnvelope)
+}
+
+// CollectContext fills in the collected fields of env (OS facts, git, history,
+// environment, project and global context, host name) by running the enabled
+// collectors concurrently, each with its own time budget. Shell, Line and CWD
+// must already be set; fields that are already populated are left untouched.
+func CollectContext(ctx context.Context, env *ContextEnvelope, cfg *config.Config) ([]CollectorTiming, error) {
+	return collectContext(ctx, env, cfg, false)
+}
+
+// CollectRequestContext is like CollectContext, but only adds the host's OS
+// facts and the global context. Nothing is read from the git repository,
+// shell history, environment or files of the user running LineSense, so
+// everything else must be supplied by the caller in env.
+func CollectRequestContext(ctx context.Context, env *ContextEnvelope, cfg *config.Config) ([]CollectorTiming, error) {
+	return collectContext(ctx, env, cfg, true)
+}
+
+// collectContext runs the collectors for env, leaving out those that read
+// the local user's data if requestOnly is set
+func collectContext(ctx context.Context, env *ContextEnvelope, cfg *config.Config, requestOnly bool) ([]CollectorTiming, error) {
+	if env.OS == "" {
+		env.OS = DetectOS()
+	}
+
+	// Add global context from config
+	if env.GlobalContext == "" {
+		env.GlobalContext = cfg.Context.GlobalInstructions
+	}
+
+	collectors := buildCollectors(env, cfg, requestOnly)
+	timings := runCollectors(ctx, env, collectors, cfg.Context.CollectorTimeoutsMs)
+
+	if err := ctx.Err(); err != nil {
+		return timings, err
+	}
+	return timings, nil
+}
+
+// buildCollectors returns the collectors needed to complete env. With
+// requestOnly, only the OS facts are collected.
+func buildCollectors(env *ContextEnvelope, cfg *config.Config, requestOnly bool) []collector {
+	var collectors []collector
+
+	if env.Distribution == "" {
+		collectors = append(collectors, collector{
+			name: "distribution",
+			collect: func(_ context.Context) func(*ContextEnvelope) {
+				distro := DetectDistribution()
+				return func(e *ContextEnvelope) { e.Distribution = distro }
+			},
+		})
+	}
+
+	if env.PackageManager == "" {
+		collectors = append(collectors, collector{
+			name: "package_manager",
+			collect: func(_ context.Context) func(*ContextEnvelope) {
+				manager := DetectPackageManager()
+				return func(e *ContextEnvelope) { e.PackageManager = manager }
+			},
+		})
+	}
+
+	if requestOnly {
+		return collectors
+	}
+
+	// Collect git context if enabled. The working tree status has its own
+	// collector: it is slow in large repositories, and dropping it mustn't
+	// lose the branch and in-progress operation.
+	if cfg.Context.IncludeGit && env.Git == nil {
+		cwd := env.CWD
+		collectors = append(collectors, collector{
+			name: "git",
+			collect: func(ctx context.Context) func(*ContextEnvelope) {
+				gitInfo, err := collectGitRepo(ctx, cwd)
+				if err != nil || gitInfo == nil {
+					// Silently ignore errors - git info is optional
+					return nil
+				}
+				return func(e *ContextEnvelope) { e.Git = gitInfo }
+			},
+		}, collector{
+			name: "git_status",
+			collect: func(ctx context.Context) func(*ContextEnvelope) {
+				status, err := collectGitStatus(ctx, cwd)
+				if err != nil {
+					return nil
+				}
+				// Applied after git, which may have been dropped
+				return func(e *ContextEnvelope) {
+					if e.Git == nil {
+						e.Git = &GitInfo{IsRepo: true}
+					}
+					status.applyTo(e.Git)
+				}
+			},
+		})
+	}
+
+	// Collect shell history if enabled
+	if cfg.Context.HistoryLength > 0 && len(env.History) == 0 {
+		shell := env.Shell
+		histFile := env.HistFile
+		limit := cfg.Context.HistoryLength
+		collectors = append(collectors, collector{
+			name: "history",
+			collect: func(_ context.Context) func(*ContextEnvelope) {
+				history, err := CollectHistoryFile(shell, histFile, limit)
+				if err != nil || len(history) == 0 {
+					// Silently ignore errors - history is optional
+					return nil
+				}
+				return func(e *ContextEnvelope) { e.History = history }
+			},
+		})
+	}
+
+	// Collect environment variables if enabled
+	if cfg.Context.IncludeEnv && env.Env == nil {
+		collectors = append(collectors, collector{
+			name: "env",
+			collect: func(_ context.Context) func(*ContextEnvelope) {
+				filtered := collectFilteredEnv()
+				return func(e *ContextEnvelope) { e.Env = filtered }
+			},
+		})
+	}
+
+	// Check for project-specific context file
+	if env.ProjectContext == "" {
+		cwd := env.CWD
+		collectors = append(collectors, collector{
+			name: "project_context",
+			collect: func(_ context.Context) func(*ContextEnvelope) {
+				content, err := os.ReadFile(filepath.Join(cwd, ".linesense_context"))
+				if err != nil {
+					return nil
+				}
+				return func(e *ContextEnvelope) { e.ProjectContext = string(content) }
+			},
+		})
+	}
+
+	if env.Hostname == "" {
+		collectors = append(collectors, collector{
+			name: "hostname",
+			collect: func(_ context.Context) func(*ContextEnvelope) {
+				host := hostname()
+				return func(e *ContextEnvelope) { e.Hostname = host }
+			},
+		})
+	}
+
+	return collectors
+}
+
+// runCollectors starts every collector on its own goroutine and waits for each
+// one until its budget expires. Results are applied to env in collector order.
+func runCollectors(ctx context.Context, env *ContextEnvelope, collectors []collector, overridesMs map[string]int) []CollectorTiming {
+	type result struct {
+		index    int
+		apply    func(*ContextEnvelope)
+		duration time.Duration
+		dropped  bool
+	}
+
+	results := make(chan result, len(collectors))
+	timings := make([]CollectorTiming, len(collectors))
+
+	for i, c := range collectors {
+		budget := collectorBudget(c.name, overridesMs)
+		timings[i] = CollectorTiming{Name: c.name, Budget: budget}
+
+		go func(index int, c collector, budget time.Duration) {
+			cctx, cancel := context.WithTimeout(ctx, budget)
+			defer cancel()
+
+			start := time.Now()
+			done := make(chan func(*ContextEnvelope), 1)
+			go func() {
+				done <- c.collect(cctx)
+			}()
+
+			select {
+			case apply := <-done:
+				results <- result{index: index, apply: apply, duration: time.Since(start)}
+			case <-cctx.Done():
+				// The collector keeps running until it notices cancellation,
+				// but its result is discarded
+				results <- result{index: index, duration: time.Since(start), dropped: true}
+			}
+		}(i, c, budget)
+	}
+
+	applies := make([]func(*ContextEnvelope), len(collectors))
+	for range collectors {
+		r := <-results
+		timings[r.index].Duration = r.duration
+		timings[r.index].Dropped = r.dropped
+		applies[r.index] = r.apply
+	}
+
+	for _, apply := range applies {
+		if apply != nil {
+			apply(env)
+		}
+	}
+
+	return timings
+}
+
+// collectorBudget returns the time budget for a collector, honoring
+// context.collector_timeouts_ms overrides from the config
+func collectorBudget(name string, overridesMs map[string]int) time.Duration {
+	if ms, ok := overridesMs[name]; ok && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	if budget, ok := defaultCollectorBudgets[name]; ok {
+		return budget
+	}
+	return 100 * time.Millisecond
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+func TestRunCollectors_DropsSlowCollector(t *testing.T) {
+	collectors := []collector{
+		{
+			name: "distribution",
+			collect: func(_ context.Context) func(*ContextEnvelope) {
+				return func(e *ContextEnvelope) { e.Distribution = "arch" }
+			},
+		},
+		{
+			name: "git",
+			collect: func(ctx context.Context) func(*ContextEnvelope) {
+				<-ctx.Done()
+				return func(e *ContextEnvelope) { e.Git = &GitInfo{IsRepo: true} }
+			},
+		},
+	}
+
+	env := &ContextEnvelope{}
+	start := time.Now()
+	timings := runCollectors(context.Background(), env, collectors, map[string]int{"git": 20})
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("runCollectors took %v, slow collector should be dropped after its budget", elapsed)
+	}
+
+	if env.Distribution != "arch" {
+		t.Errorf("Distribution = %q, want arch", env.Distribution)
+	}
+	if env.Git != nil {
+		t.Error("Git should not be applied after its budget expired")
+	}
+
+	if len(timings) != 2 {
+		t.Fatalf("Expected 2 timings, got %d", len(timings))
+	}
+	if timings[0].Dropped {
+		t.Error("Fast collector should not be dropped")
+	}
+	if !timings[1].Dropped {
+		t.Error("Slow collector should be dropped")
+	}
+	if timings[1].Budget != 20*time.Millisecond {
+		t.Errorf("Budget = %v, want 20ms from config override", timings[1].Budget)
+	}
+}
+
+func TestCollectContext_KeepsPopulatedFields(t *testing.T) {
+	cfg := &config.Config{
+		Context: config.ContextConfig{
+			HistoryLength: 10,
+			IncludeGit:    true,
+		},
+	}
+
+	env := &ContextEnvelope{
+		Shell:          "bash",
+		Line:           "ls",
+		CWD:            t.TempDir(),
+		Distribution:   "custom",
+		PackageManager: "nix",
+		Git:            &GitInfo{IsRepo: true, Branch: "provided"},
+		History:        []HistoryEntry{{Command: "provided"}},
+	}
+
+	timings, err := CollectContext(context.Background(), env, cfg)
+	if err != nil {
+		t.Fatalf("CollectContext() error = %v", err)
+	}
+
+	for _, timing := range timings {
+		switch timing.Name {
+		case "distribution", "package_manager", "git", "history":
+			t.Errorf("Collector %q should be skipped when its field is already set", timing.Name)
+		}
+	}
+
+	if env.Git.Branch != "provided" || env.History[0].Command != "provided" {
+		t.Error("Populated fields should not be overwritten")
+	}
+	if env.OS == "" {
+		t.Error("OS should be filled in")
+	}
+}
+
+func TestCollectContext_CanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	env := &ContextEnvelope{Shell: "bash", Line: "ls", CWD: t.TempDir()}
+	if _, err := CollectContext(ctx, env, &config.Config{}); err == nil {
+		t.Error("CollectContext() should return an error for a canceled context")
+	}
+}
+
+func TestCollectContext_SlowGitStatusKeepsBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if err := exec.Command("git", "-C", dir, "init", "-b", "main").Run(); err != nil {
+		t.Fatalf("Failed to init git repo: %v", err)
+	}
+
+	// git status gets a budget too short to finish in
+	cfg := &config.Config{
+		Context: config.ContextConfig{
+			IncludeGit:          true,
+			CollectorTimeoutsMs: map[string]int{"git_status": 1},
+		},
+	}
+	env := &ContextEnvelope{Shell: "bash", Line: "ls", CWD: dir}
+	timings, err := CollectContext(context.Background(), env, cfg)
+	if err != nil {
+		t.Fatalf("CollectContext() error = %v", err)
+	}
+
+	if env.Git == nil || env.Git.Branch != "main" {
+		t.Fatalf("Git = %+v, want the branch kept whether or not the status finished", env.Git)
+	}
+	for _, timing := range timings {
+		if timing.Name == "git" && timing.Dropped {
+			t.Error("git collector should not be dropped with git_status")
+		}
+		if timing.Name == "git_status" && timing.Dropped && env.Git.StatusSummary != "" {
+			t.Error("dropped git_status should not be applied")
+		}
+	}
+}
+
+func TestCollectRequestContext(t *testing.T) {
+	cfg := &config.Config{
+		Context: config.ContextConfig{
+			HistoryLength: 10,
+			IncludeGit:    true,
+			IncludeEnv:    true,
+		},
+	}
+
+	histFile := filepath.Join(t.TempDir(), ".bash_history")
+	if err := os.WriteFile(histFile, []byte("cat ~/.ssh/id_rsa\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env := &ContextEnvelope{Shell: "bash", Line: "ls", CWD: t.TempDir(), HistFile: histFile}
+
+	timings, err := CollectRequestContext(context.Background(), env, cfg)
+	if err != nil {
+		t.Fatalf("CollectRequestContext() error = %v", err)
+	}
+
+	for _, timing := range timings {
+		switch timing.Name {
+		case "distribution", "package_manager":
+		default:
+			t.Errorf("Collector %q reads local user data and should not run", timing.Name)
+		}
+	}
+	if env.History != nil || env.Env != nil || env.Git != nil || env.Hostname != "" {
+		t.Errorf("Local user data collected: %+v", env)
+	}
+}
@@ -1,8 +1,8 @@
 package core
 
 import (
+	"context"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/traves/linesense/internal/config"
@@ -10,18 +10,22 @@ import (
 
 // ContextEnvelope is collected before each suggestion / explanation
 type ContextEnvelope struct {
-	Shell          string            `json:"shell"` // "bash" | "zsh"
+	Shell          string            `json:"shell"` // "bash" | "zsh" | "fish"
 	Line           string            `json:"line"`  // current input line
 	CWD            string            `json:"cwd"`
 	OS             string            `json:"os"`                        // "linux" | "darwin" | "windows"
 	Distribution   string            `json:"distribution,omitempty"`    // Linux distro: "ubuntu", "arch", "fedora", etc.
 	PackageManager string            `json:"package_manager,omitempty"` // "apt", "yum", "brew", "pacman", etc.
 	Git            *GitInfo          `json:"git,omitempty"`
+	KubeContext    string            `json:"kube_context,omitempty"` // current kube context
+	AWSProfile     string            `json:"aws_profile,omitempty"`  // active AWS profile
+	Hostname       string            `json:"hostname,omitempty"`
 	Env            map[string]string `json:"env,omitempty"`     // filtered env (if enabled)
 	History        []HistoryEntry    `json:"history,omitempty"` // last N commands
 	UsageSummary   *UsageSummary     `json:"usage_summary,omitempty"`
 	ProjectContext string            `json:"project_context,omitempty"` // content of .linesense_context
 	GlobalContext  string            `json:"global_context,omitempty"`  // content from config.global_instructions
+	HistFile       string            `json:"histfile,omitempty"`        // history file reported by the shell integration
 }
 
 // GitInfo contains git repository information
@@ -30,13 +34,24 @@ type GitInfo struct {
 	Branch        string   `json:"branch,omitempty"`
 	StatusSummary string   `json:"status_summary,omitempty"`
 	Remotes       []string `json:"remotes,omitempty"`
+	Upstream      string   `json:"upstream,omitempty"`       // tracking branch, e.g. "origin/main"
+	Ahead         int      `json:"ahead,omitempty"`          // commits not yet pushed to upstream
+	Behind        int      `json:"behind,omitempty"`         // upstream commits not yet pulled
+	Detached      bool     `json:"detached,omitempty"`       // HEAD is not on a branch
+	Operation     string   `json:"operation,omitempty"`      // "rebase" | "merge" | "cherry-pick" | "revert" | "bisect" | "am"
+	Conflicts     []string `json:"conflicts,omitempty"`      // paths with unresolved conflicts
+	StashCount    int      `json:"stash_count,omitempty"`    // number of stash entries
+	RecentCommits []string `json:"recent_commits,omitempty"` // subjects of the last few commits, newest first
+	Tags          []string `json:"tags,omitempty"`           // tags pointing at HEAD
 }
 
 // HistoryEntry represents a shell history entry
 type HistoryEntry struct {
 	Command   string  `json:"command"`
-	Timestamp *string `json:"timestamp,omitempty"`
+	Timestamp *string `json:"timestamp,omitempty"` // ISO 8601, when the command started
+	Duration  *int    `json:"duration,omitempty"`  // seconds the command ran
 	ExitCode  *int    `json:"exit_code,omitempty"`
+	CWD       string  `json:"cwd,omitempty"` // directory the command ran in
 }
 
 // UsageSummary contains usage pattern information
@@ -47,49 +62,44 @@ type UsageSummary struct {
 // BuildContext gathers all contextual information
 func BuildContext(shell, line, cwd string, cfg *config.Config) (*ContextEnvelope, error) {
 	ctx := &ContextEnvelope{
-		Shell:          shell,
-		Line:           line,
-		CWD:            cwd,
-		OS:             DetectOS(),
-		Distribution:   DetectDistribution(),
-		PackageManager: DetectPackageManager(),
+		Shell: shell,
+		Line:  line,
+		CWD:   cwd,
 	}
 
-	// Collect git context if enabled
-	if cfg.Context.IncludeGit {
-		gitInfo, err := CollectGitInfo(cwd)
-		if err == nil && gitInfo != nil {
-			ctx.Git = gitInfo
-		}
-		// Silently ignore errors - git info is optional
+	if _, err := CollectContext(context.Background(), ctx, cfg); err != nil {
+		return nil, err
 	}
 
-	// Collect shell history if enabled
-	if cfg.Context.HistoryLength > 0 {
-		history, err := CollectHistory(shell, cfg.Context.HistoryLength)
-		if err == nil && len(history) > 0 {
-			ctx.History = history
+	// TODO: Build usage summary from usage log
+	// This will be implemented when usage logging is complete
+
+	return ctx, nil
+}
+
+// PrepareEnvelope fills in the parts of env that depend on the calling
+// process's environment: the shell history file, the kube context, the AWS
+// profile and, if enabled, the filtered environment variables. The rest of
+// the envelope can then be collected by another process, such as the daemon.
+func PrepareEnvelope(env *ContextEnvelope, cfg *config.Config) {
+	// The history recorded by the shell hooks is in the config directory,
+	// which other processes share, so only the shell's own file is resolved
+	if env.HistFile == "" && !hasManagedHistory(env.Shell) {
+		if path, err := getHistoryPath(env.Shell); err == nil {
+			env.HistFile = path
 		}
-		// Silently ignore errors - history is optional
 	}
 
-	// Collect environment variables if enabled
-	if cfg.Context.IncludeEnv {
-		ctx.Env = collectFilteredEnv()
+	if cfg.Context.IncludeEnv && env.Env == nil {
+		env.Env = collectFilteredEnv()
 	}
 
-	// Add global context from config
-	ctx.GlobalContext = cfg.Context.GlobalInstructions
-
-	// Check for project-specific context file
-	if content, err := os.ReadFile(filepath.Join(cwd, ".linesense_context")); err == nil {
-		ctx.ProjectContext = string(content)
+	if env.KubeContext == "" {
+		env.KubeContext = collectKubeContext()
+	}
+	if env.AWSProfile == "" {
+		env.AWSProfile = collectAWSProfile()
 	}
-
-	// TODO: Build usage summary from usage log
-	// This will be implemented when usage logging is complete
-
-	return ctx, nil
 }
 
 // collectFilteredEnv returns a filtered map of environment variables
@@ -701,7 +701,7 @@ pwd
 	os.Setenv("HISTFILE", histFile)
 
 	// Use unknown shell - should default to bash behavior
-	history, err := CollectHistory("fish", 10)
+	history, err := CollectHistory("tcsh", 10)
 	if err != nil {
 		t.Fatalf("CollectHistory() error = %v", err)
 	}
@@ -876,3 +876,177 @@ func TestBuildContext_AllFeatures(t *testing.T) {
 		t.Error("Sensitive env var should be filtered")
 	}
 }
+
+func TestParseGitBranchHeader(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       string
+		wantBranch   string
+		wantUpstream string
+		wantAhead    int
+		wantBehind   int
+		wantDetached bool
+	}{
+		{"no upstream", "## main", "main", "", 0, 0, false},
+		{"in sync", "## main...origin/main", "main", "origin/main", 0, 0, false},
+		{"ahead", "## feature...origin/feature [ahead 3]", "feature", "origin/feature", 3, 0, false},
+		{"ahead and behind", "## main...origin/main [ahead 1, behind 2]", "main", "origin/main", 1, 2, false},
+		{"upstream gone", "## topic...origin/topic [gone]", "topic", "origin/topic", 0, 0, false},
+		{"detached", "## HEAD (no branch)", "", "", 0, 0, true},
+		{"unborn", "## No commits yet on main", "main", "", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &GitInfo{}
+			parseGitBranchHeader(tt.header, info)
+
+			if info.Branch != tt.wantBranch {
+				t.Errorf("Branch = %q, want %q", info.Branch, tt.wantBranch)
+			}
+			if info.Upstream != tt.wantUpstream {
+				t.Errorf("Upstream = %q, want %q", info.Upstream, tt.wantUpstream)
+			}
+			if info.Ahead != tt.wantAhead || info.Behind != tt.wantBehind {
+				t.Errorf("Ahead/Behind = %d/%d, want %d/%d", info.Ahead, info.Behind, tt.wantAhead, tt.wantBehind)
+			}
+			if info.Detached != tt.wantDetached {
+				t.Errorf("Detached = %v, want %v", info.Detached, tt.wantDetached)
+			}
+		})
+	}
+}
+
+func TestParseGitConflicts(t *testing.T) {
+	porcelain := "UU main.go\nAA \"my file.go\"\nUD \"caf\\303\\251.txt\"\n M other.go\n"
+
+	conflicts := parseGitConflicts(porcelain)
+
+	want := []string{"main.go", "my file.go", "café.txt"}
+	if strings.Join(conflicts, "|") != strings.Join(want, "|") {
+		t.Errorf("conflicts = %q, want %q", conflicts, want)
+	}
+}
+
+func TestParseGitLog(t *testing.T) {
+	logOutput := "HEAD -> main, tag: v1.2.0, tag: latest, origin/main\x1fRelease 1.2.0\n\x1fFix parser\n\x1fInitial commit\n"
+
+	subjects, tags := parseGitLog(logOutput)
+
+	wantSubjects := []string{"Release 1.2.0", "Fix parser", "Initial commit"}
+	if strings.Join(subjects, "|") != strings.Join(wantSubjects, "|") {
+		t.Errorf("subjects = %v, want %v", subjects, wantSubjects)
+	}
+	if strings.Join(tags, ",") != "v1.2.0,latest" {
+		t.Errorf("tags = %v, want [v1.2.0 latest]", tags)
+	}
+}
+
+func TestCollectGitInfo_StashTagsAndCommits(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available in PATH")
+	}
+
+	tmpDir := t.TempDir()
+	exec.Command("git", "-C", tmpDir, "init").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.email", "test@example.com").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.name", "Test User").Run()
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	os.WriteFile(testFile, []byte("one"), 0644)
+	exec.Command("git", "-C", tmpDir, "add", ".").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "First commit").Run()
+	os.WriteFile(testFile, []byte("two"), 0644)
+	exec.Command("git", "-C", tmpDir, "commit", "-am", "Second commit").Run()
+	exec.Command("git", "-C", tmpDir, "tag", "v0.1.0").Run()
+
+	// Stash a change
+	os.WriteFile(testFile, []byte("three"), 0644)
+	exec.Command("git", "-C", tmpDir, "stash").Run()
+
+	gitInfo, err := CollectGitInfo(tmpDir)
+	if err != nil {
+		t.Fatalf("CollectGitInfo() error = %v", err)
+	}
+
+	if gitInfo.StashCount != 1 {
+		t.Errorf("StashCount = %d, want 1", gitInfo.StashCount)
+	}
+	if len(gitInfo.Tags) != 1 || gitInfo.Tags[0] != "v0.1.0" {
+		t.Errorf("Tags = %v, want [v0.1.0]", gitInfo.Tags)
+	}
+	if len(gitInfo.RecentCommits) != 2 || gitInfo.RecentCommits[0] != "Second commit" {
+		t.Errorf("RecentCommits = %v, want [Second commit First commit]", gitInfo.RecentCommits)
+	}
+}
+
+func TestCollectGitInfo_MergeConflict(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available in PATH")
+	}
+
+	tmpDir := t.TempDir()
+	exec.Command("git", "-C", tmpDir, "init", "-b", "main").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.email", "test@example.com").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.name", "Test User").Run()
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	os.WriteFile(testFile, []byte("base\n"), 0644)
+	exec.Command("git", "-C", tmpDir, "add", ".").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "Base").Run()
+
+	// Diverge on two branches
+	exec.Command("git", "-C", tmpDir, "checkout", "-b", "other").Run()
+	os.WriteFile(testFile, []byte("other\n"), 0644)
+	exec.Command("git", "-C", tmpDir, "commit", "-am", "Other").Run()
+	exec.Command("git", "-C", tmpDir, "checkout", "main").Run()
+	os.WriteFile(testFile, []byte("main\n"), 0644)
+	exec.Command("git", "-C", tmpDir, "commit", "-am", "Main").Run()
+
+	// Merge fails with a conflict
+	exec.Command("git", "-C", tmpDir, "merge", "other").Run()
+
+	gitInfo, err := CollectGitInfo(tmpDir)
+	if err != nil {
+		t.Fatalf("CollectGitInfo() error = %v", err)
+	}
+
+	if gitInfo.Operation != "merge" {
+		t.Errorf("Operation = %q, want merge", gitInfo.Operation)
+	}
+	if len(gitInfo.Conflicts) != 1 || gitInfo.Conflicts[0] != "test.txt" {
+		t.Errorf("Conflicts = %v, want [test.txt]", gitInfo.Conflicts)
+	}
+	if !strings.Contains(gitInfo.StatusSummary, "conflicted") {
+		t.Errorf("StatusSummary should contain 'conflicted', got: %q", gitInfo.StatusSummary)
+	}
+}
+
+func TestCollectGitInfo_Detached(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available in PATH")
+	}
+
+	tmpDir := t.TempDir()
+	exec.Command("git", "-C", tmpDir, "init").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.email", "test@example.com").Run()
+	exec.Command("git", "-C", tmpDir, "config", "user.name", "Test User").Run()
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	os.WriteFile(testFile, []byte("test"), 0644)
+	exec.Command("git", "-C", tmpDir, "add", ".").Run()
+	exec.Command("git", "-C", tmpDir, "commit", "-m", "Initial").Run()
+	exec.Command("git", "-C", tmpDir, "checkout", "--detach").Run()
+
+	gitInfo, err := CollectGitInfo(tmpDir)
+	if err != nil {
+		t.Fatalf("CollectGitInfo() error = %v", err)
+	}
+
+	if !gitInfo.Detached {
+		t.Error("Detached should be true")
+	}
+	if gitInfo.Branch == "" {
+		t.Error("Branch should name the detached commit")
+	}
+}
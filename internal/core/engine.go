@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/traves/linesense/internal/config"
 )
@@ -11,14 +12,24 @@ type Suggestion struct {
 	Command     string    `json:"command"`
 	Risk        RiskLevel `json:"risk"` // "low" | "medium" | "high"
 	Explanation string    `json:"explanation"`
-	Source      string    `json:"source"` // "llm" | "preset"
+	Source      string    `json:"source"`             // "llm" | "preset"
+	Findings    []Finding `json:"findings,omitempty"` // why Risk is above low
+	Preview     string    `json:"preview,omitempty"`  // a dry run of Command, for medium and high risk
+	// Overrides are the allowlist entries and rule overrides that loosened
+	// Findings, logged once the suggestion is accepted or run
+	Overrides []OverrideEvent `json:"overrides,omitempty"`
+	// Undo is a best-effort command that reverses Command, and Irreversible
+	// is set when its effect can't be reversed
+	Undo         string `json:"undo,omitempty"`
+	Irreversible bool   `json:"irreversible,omitempty"`
 }
 
 // Explanation represents an explanation of a command
 type Explanation struct {
-	Summary string    `json:"summary"`
-	Risk    RiskLevel `json:"risk"`
-	Notes   []string  `json:"notes,omitempty"`
+	Summary  string    `json:"summary"`
+	Risk     RiskLevel `json:"risk"`
+	Notes    []string  `json:"notes,omitempty"`
+	Findings []Finding `json:"findings,omitempty"` // rules the command matched
 }
 
 // Provider is the interface for AI providers
@@ -26,6 +37,8 @@ type Provider interface {
 	Name() string
 	Suggest(ctx context.Context, input SuggestInput) ([]Suggestion, error)
 	Explain(ctx context.Context, input ExplainInput) (Explanation, error)
+	Fix(ctx context.Context, input FixInput) ([]Suggestion, error)
+	Complete(ctx context.Context, input CompleteInput) (string, error)
 }
 
 // SuggestInput contains input for suggestion generation
@@ -42,10 +55,43 @@ type ExplainInput struct {
 	Context *ContextEnvelope `json:"context"`
 }
 
+// FixInput contains input for repairing a failed command
+type FixInput struct {
+	ModelID  string           `json:"model_id"`
+	Command  string           `json:"command"`             // the command that failed
+	ExitCode int              `json:"exit_code,omitempty"` // 0 if unknown
+	Stderr   string           `json:"stderr,omitempty"`    // captured error output, if available
+	Context  *ContextEnvelope `json:"context"`
+}
+
+// CompleteInput contains input for completing the current line inline
+type CompleteInput struct {
+	ModelID string           `json:"model_id"`
+	Context *ContextEnvelope `json:"context"`
+}
+
+// UndoHint says how to reverse a command: Undo is the inverse command, empty
+// when none is known, and Irreversible is set when there is none
+type UndoHint struct {
+	Undo         string `json:"undo,omitempty"`
+	Irreversible bool   `json:"irreversible,omitempty"`
+}
+
+// Completion is an inline completion for the current line
+type Completion struct {
+	Line   string    `json:"line"`
+	Suffix string    `json:"suffix"` // text to append to Line, empty if there is no completion
+	Source string    `json:"source"` // "history" | "llm"
+	Risk   RiskLevel `json:"risk"`   // risk of Line+Suffix
+}
+
 // Engine is the main engine for suggestions and explanations
 type Engine struct {
-	config   *config.Config
-	provider Provider
+	config      *config.Config
+	provider    Provider
+	risk        *RiskChain
+	onCollect   func([]CollectorTiming)
+	requestOnly bool // see LimitContextToRequest
 }
 
 // NewEngine creates a new engine instance
@@ -53,24 +99,170 @@ func NewEngine(cfg *config.Config, provider Provider) *Engine {
 	return &Engine{
 		config:   cfg,
 		provider: provider,
+		risk:     DefaultRiskChain(&cfg.Safety),
+	}
+}
+
+// OnCollect registers fn to receive the collector timings of every context
+// collection the engine runs
+func (e *Engine) OnCollect(fn func([]CollectorTiming)) {
+	e.onCollect = fn
+}
+
+// LimitContextToRequest makes the engine collect only the host's OS facts,
+// for requests from other users or machines: their git state, history and
+// environment must come with the request, not from the local user. Their
+// working directory isn't looked at either, so only the rules that need
+// nothing but the command's text apply.
+func (e *Engine) LimitContextToRequest() {
+	e.requestOnly = true
+}
+
+// collect fills in the missing parts of env
+func (e *Engine) collect(ctx context.Context, env *ContextEnvelope) error {
+	if env == nil {
+		return fmt.Errorf("context is required")
+	}
+
+	collect := CollectContext
+	if e.requestOnly {
+		collect = CollectRequestContext
+	}
+	timings, err := collect(ctx, env, e.config)
+	if e.onCollect != nil {
+		e.onCollect(timings)
 	}
+	if err != nil {
+		return fmt.Errorf("failed to build context: %w", err)
+	}
+	return nil
 }
 
-// Suggest generates command suggestions
-func (e *Engine) Suggest(_ context.Context, _ string, _ string, _ string) ([]Suggestion, error) {
-	// TODO: Build context envelope
-	// TODO: Build prompt for suggestions
-	// TODO: Call provider.Suggest
-	// TODO: Apply safety filters
-	// TODO: Return filtered suggestions
-	panic("not implemented")
+// Suggest collects context for input and generates command suggestions.
+// Suggestions matching the safety denylist are dropped and the rest are
+// classified with the safety rules and given undo hints.
+func (e *Engine) Suggest(ctx context.Context, input SuggestInput) ([]Suggestion, error) {
+	if err := e.collect(ctx, input.Context); err != nil {
+		return nil, err
+	}
+
+	suggestions, err := e.provider.Suggest(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	suggestions = e.screen(ctx, suggestions, input.Context)
+	e.addUndo(suggestions, input.Context)
+	return suggestions, nil
 }
 
-// Explain generates an explanation for a command
-func (e *Engine) Explain(_ context.Context, _ string, _ string, _ string) (Explanation, error) {
-	// TODO: Build context envelope
-	// TODO: Build prompt for explanation
-	// TODO: Call provider.Explain
-	// TODO: Return explanation
-	panic("not implemented")
+// Explain collects context for input and generates an explanation. The risk
+// the model reported is classified along with the safety rules, so the rules
+// can raise it but never lower it.
+func (e *Engine) Explain(ctx context.Context, input ExplainInput) (Explanation, error) {
+	if err := e.collect(ctx, input.Context); err != nil {
+		return Explanation{}, err
+	}
+
+	explanation, err := e.provider.Explain(ctx, input)
+	if err != nil {
+		return Explanation{}, err
+	}
+	risk := e.riskInput(input.Context.Line, input.Context)
+	risk.ModelRisk = explanation.Risk
+	risk.CountTargets = true
+	explanation.Risk, explanation.Findings = e.risk.Classify(ctx, risk)
+	return explanation, nil
+}
+
+// Fix collects context for input and generates corrected versions of the
+// failed command. Fixes matching the safety denylist are dropped and the
+// rest are classified with the safety rules and given undo hints.
+func (e *Engine) Fix(ctx context.Context, input FixInput) ([]Suggestion, error) {
+	if err := e.collect(ctx, input.Context); err != nil {
+		return nil, err
+	}
+
+	suggestions, err := e.provider.Fix(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	suggestions = e.screen(ctx, suggestions, input.Context)
+	e.addUndo(suggestions, input.Context)
+	return suggestions, nil
+}
+
+// Complete collects context for input and completes the current line. Recent
+// history is tried before the provider. A completion that would turn the
+// line into a blocked command is dropped and the zero Completion returned.
+func (e *Engine) Complete(ctx context.Context, input CompleteInput) (Completion, error) {
+	if err := e.collect(ctx, input.Context); err != nil {
+		return Completion{}, err
+	}
+
+	line := input.Context.Line
+	completion := Completion{Line: line, Source: "history"}
+
+	// Recent history usually predicts the rest of the line without a model call
+	suffix, ok := CompleteFromHistory(input.Context.History, line)
+	if !ok {
+		var err error
+		completion.Source = "llm"
+		suffix, err = e.provider.Complete(ctx, input)
+		if err != nil {
+			return Completion{}, err
+		}
+	}
+
+	// Never offer a completion that turns the line into a blocked command
+	command := line + suffix
+	if IsBlocked(command, &e.config.Safety) {
+		return Completion{}, nil
+	}
+	completion.Suffix = suffix
+	completion.Risk, _ = e.risk.Classify(ctx, e.riskInput(command, input.Context))
+
+	return completion, nil
+}
+
+// addUndo replaces the undo hints the model gave suggestions with those of
+// the local rules, where they know the command. Hints that stay are best
+// effort, and an undo command matching the denylist is dropped.
+func (e *Engine) addUndo(suggestions []Suggestion, env *ContextEnvelope) {
+	cwd := env.CWD
+	if e.requestOnly {
+		cwd = ""
+	}
+	for i := range suggestions {
+		hint := UndoHint{Undo: suggestions[i].Undo, Irreversible: suggestions[i].Irreversible}
+		if local, ok := UndoFor(suggestions[i].Command, cwd); ok {
+			hint = local
+		}
+		setUndo(&suggestions[i], hint, &e.config.Safety)
+	}
+}
+
+// riskInput describes command run in env to the risk chain, without the
+// working directory when the context is limited to the request
+func (e *Engine) riskInput(command string, env *ContextEnvelope) RiskInput {
+	input := NewRiskInput(command, env)
+	if e.requestOnly {
+		input.CWD = ""
+	}
+	return input
+}
+
+// screen removes suggestions that match the safety denylist, classifies the
+// rest with the engine's risk chain, as run in env, and adds a dry run to
+// risky ones
+func (e *Engine) screen(ctx context.Context, suggestions []Suggestion, env *ContextEnvelope) []Suggestion {
+	var allowed []Suggestion
+	for _, suggestion := range suggestions {
+		if IsBlocked(suggestion.Command, &e.config.Safety) {
+			continue
+		}
+		suggestion.Risk, suggestion.Findings, suggestion.Overrides = e.risk.ClassifyOverrides(ctx, e.riskInput(suggestion.Command, env))
+		suggestion.Preview = PreviewFor(suggestion, &e.config.Safety)
+		allowed = append(allowed, suggestion)
+	}
+	return allowed
 }
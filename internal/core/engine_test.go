@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+// fakeProvider returns canned responses and records the context it was given
+type fakeProvider struct {
+	suffix      string
+	suggestions []Suggestion // instead of ls -la
+	err         error
+	context     *ContextEnvelope
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Suggest(_ context.Context, input SuggestInput) ([]Suggestion, error) {
+	p.context = input.Context
+	if p.suggestions != nil {
+		return p.suggestions, p.err
+	}
+	return []Suggestion{{Command: "ls -la", Risk: RiskLow}}, p.err
+}
+
+func (p *fakeProvider) Explain(_ context.Context, input ExplainInput) (Explanation, error) {
+	p.context = input.Context
+	return Explanation{Summary: "lists files", Risk: RiskLow}, p.err
+}
+
+func (p *fakeProvider) Fix(_ context.Context, input FixInput) ([]Suggestion, error) {
+	p.context = input.Context
+	return nil, p.err
+}
+
+func (p *fakeProvider) Complete(_ context.Context, input CompleteInput) (string, error) {
+	p.context = input.Context
+	return p.suffix, p.err
+}
+
+func TestEngine_SuggestCollectsContext(t *testing.T) {
+	cfg := &config.Config{Context: config.ContextConfig{GlobalInstructions: "be brief"}}
+	provider := &fakeProvider{}
+	engine := NewEngine(cfg, provider)
+
+	var timings []CollectorTiming
+	engine.OnCollect(func(t []CollectorTiming) { timings = t })
+
+	env := &ContextEnvelope{Shell: "bash", Line: "list files", CWD: t.TempDir()}
+	suggestions, err := engine.Suggest(context.Background(), SuggestInput{Context: env})
+	if err != nil {
+		t.Fatalf("Suggest() error = %v", err)
+	}
+	if len(suggestions) != 1 {
+		t.Fatalf("got %d suggestions, want 1", len(suggestions))
+	}
+	if provider.context.OS == "" || provider.context.GlobalContext != "be brief" {
+		t.Errorf("provider got uncollected context: %+v", provider.context)
+	}
+	if len(timings) == 0 {
+		t.Error("OnCollect was not called with collector timings")
+	}
+
+	if _, err := engine.Suggest(context.Background(), SuggestInput{}); err == nil {
+		t.Error("Suggest() without context should error")
+	}
+}
+
+func TestEngine_SuggestDropsBlocked(t *testing.T) {
+	cfg := &config.Config{Safety: config.SafetyConfig{Denylist: []string{`^ls`}}}
+	engine := NewEngine(cfg, &fakeProvider{})
+
+	env := &ContextEnvelope{Shell: "bash", Line: "list files", CWD: t.TempDir()}
+	suggestions, err := engine.Suggest(context.Background(), SuggestInput{Context: env})
+	if err != nil {
+		t.Fatalf("Suggest() error = %v", err)
+	}
+	if len(suggestions) != 0 {
+		t.Errorf("got %v, want denylisted suggestion dropped", suggestions)
+	}
+}
+
+func TestEngine_FindingsSetRisk(t *testing.T) {
+	cfg := &config.Config{Safety: config.SafetyConfig{RequireConfirmPatterns: []string{`^ls`}}}
+	engine := NewEngine(cfg, &fakeProvider{})
+
+	env := &ContextEnvelope{Shell: "bash", Line: "list files", CWD: t.TempDir()}
+	suggestions, err := engine.Suggest(context.Background(), SuggestInput{Context: env})
+	if err != nil {
+		t.Fatalf("Suggest() error = %v", err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Risk != RiskHigh || len(suggestions[0].Findings) != 1 {
+		t.Fatalf("got %+v, want one high-risk suggestion with a finding", suggestions)
+	}
+	if finding := suggestions[0].Findings[0]; finding.Source != SourceConfig || finding.Rule != "confirm:^ls" {
+		t.Errorf("finding = %+v, want the config pattern", finding)
+	}
+
+	env = &ContextEnvelope{Shell: "bash", Line: "ls -la", CWD: t.TempDir()}
+	explanation, err := engine.Explain(context.Background(), ExplainInput{Context: env})
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+	if explanation.Risk != RiskHigh || len(explanation.Findings) != 1 {
+		t.Errorf("got %+v, want the model's low risk raised to high by the finding", explanation)
+	}
+}
+
+func TestEngine_SuggestReportsOverrides(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	cfg := &config.Config{Safety: config.SafetyConfig{Rules: map[string]config.RuleOverride{"mv": {Disable: true}}}}
+	engine := NewEngine(cfg, &fakeProvider{suggestions: []Suggestion{{Command: "mv a b"}}})
+
+	env := &ContextEnvelope{Shell: "bash", Line: "rename a", CWD: t.TempDir()}
+	suggestions, err := engine.Suggest(context.Background(), SuggestInput{Context: env})
+	if err != nil {
+		t.Fatalf("Suggest() error = %v", err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Risk != RiskLow || len(suggestions[0].Overrides) != 1 || suggestions[0].Overrides[0].Rule != "mv" {
+		t.Fatalf("got %+v, want the disabled mv rule reported", suggestions)
+	}
+	if _, err := os.Stat(OverrideLogPath()); !os.IsNotExist(err) {
+		t.Errorf("suggesting wrote the override log: %v", err)
+	}
+}
+
+func TestEngine_Complete(t *testing.T) {
+	history := []HistoryEntry{{Command: "git status"}}
+
+	tests := []struct {
+		name       string
+		line       string
+		suffix     string
+		denylist   []string
+		wantSuffix string
+		wantSource string
+		wantRisk   RiskLevel
+	}{
+		{"from history", "git st", "", nil, "atus", "history", RiskLow},
+		{"from provider", "docker ", "ps -a", nil, "ps -a", "llm", RiskLow},
+		{"blocked", "rm ", "-rf /", []string{`rm\s+-rf`}, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Safety: config.SafetyConfig{Denylist: tt.denylist}}
+			engine := NewEngine(cfg, &fakeProvider{suffix: tt.suffix})
+
+			env := &ContextEnvelope{Shell: "bash", Line: tt.line, CWD: t.TempDir(), History: history}
+			completion, err := engine.Complete(context.Background(), CompleteInput{Context: env})
+			if err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			if completion.Suffix != tt.wantSuffix {
+				t.Errorf("Suffix = %q, want %q", completion.Suffix, tt.wantSuffix)
+			}
+			if completion.Source != tt.wantSource {
+				t.Errorf("Source = %q, want %q", completion.Source, tt.wantSource)
+			}
+			if completion.Risk != tt.wantRisk {
+				t.Errorf("Risk = %q, want %q", completion.Risk, tt.wantRisk)
+			}
+		})
+	}
+}
+
+func TestEngine_CompleteProviderError(t *testing.T) {
+	cfg := &config.Config{}
+	engine := NewEngine(cfg, &fakeProvider{err: errors.New("no API key")})
+
+	env := &ContextEnvelope{Shell: "bash", Line: "docker ", CWD: t.TempDir()}
+	if _, err := engine.Complete(context.Background(), CompleteInput{Context: env}); err == nil {
+		t.Error("Complete() should return the provider error when history has no match")
+	}
+}
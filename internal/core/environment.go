@@ -0,0 +1,91 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// collectKubeContext returns the current kube context: the current-context of
+// the first file in $KUBECONFIG that sets one, or of ~/.kube/config
+func collectKubeContext() string {
+	paths := filepath.SplitList(os.Getenv("KUBECONFIG"))
+	if len(paths) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		paths = []string{filepath.Join(home, ".kube", "config")}
+	}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if context := parseCurrentContext(string(data)); context != "" {
+			return context
+		}
+	}
+	return ""
+}
+
+// parseCurrentContext finds the top-level current-context key of a kubeconfig
+// without a YAML parser
+func parseCurrentContext(kubeconfig string) string {
+	for _, line := range strings.Split(kubeconfig, "\n") {
+		value, ok := strings.CutPrefix(line, "current-context:")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		return strings.Trim(value, `"'`)
+	}
+	return ""
+}
+
+// collectAWSProfile returns the AWS profile the AWS CLI and SDKs would use
+func collectAWSProfile() string {
+	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return os.Getenv("AWS_DEFAULT_PROFILE")
+}
+
+// readGitBranch returns the branch checked out in the repository containing
+// dir by reading .git/HEAD, or empty when HEAD is detached or unknown
+func readGitBranch(dir string) string {
+	root := findRepoRoot(dir)
+	if root == "" {
+		return ""
+	}
+
+	gitDir := filepath.Join(root, ".git")
+	if data, err := os.ReadFile(gitDir); err == nil {
+		// A worktree or submodule: .git is a file pointing at the git directory
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+		if !ok {
+			return ""
+		}
+		gitDir = strings.TrimSpace(target)
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(root, gitDir)
+		}
+	}
+
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	branch, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+	if !ok {
+		return ""
+	}
+	return branch
+}
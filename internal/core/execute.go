@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+// Execution policies for safety.default_execution
+const (
+	ExecPasteOnly       = "paste_only"        // only print the command
+	ExecConfirm         = "confirm"           // confirm every command before running it
+	ExecConfirmHighRisk = "confirm_high_risk" // run low and medium risk, confirm high risk
+	ExecAutoLowRisk     = "auto_low_risk"     // run low risk, confirm the rest
+)
+
+// ExecAction is what linesense run does with the chosen command
+type ExecAction string
+
+// Execution actions
+const (
+	ActionPrint   ExecAction = "print"   // print the command without running it
+	ActionConfirm ExecAction = "confirm" // run it once the user types "yes"
+	ActionRetype  ExecAction = "retype"  // run it once the user types the command again
+	ActionRun     ExecAction = "run"     // run it
+)
+
+// ErrBlocked is returned for commands that match the safety denylist
+var ErrBlocked = errors.New("command matches the safety denylist")
+
+// ExecActionFor returns what policy says to do with a command of the given
+// risk. An empty policy is paste_only. High-risk commands are never run
+// without being typed again.
+func ExecActionFor(policy string, risk RiskLevel) (ExecAction, error) {
+	switch policy {
+	case "", ExecPasteOnly:
+		return ActionPrint, nil
+	case ExecConfirm:
+		if risk == RiskHigh {
+			return ActionRetype, nil
+		}
+		return ActionConfirm, nil
+	case ExecConfirmHighRisk:
+		if risk == RiskHigh {
+			return ActionRetype, nil
+		}
+		return ActionRun, nil
+	case ExecAutoLowRisk:
+		switch risk {
+		case RiskHigh:
+			return ActionRetype, nil
+		case RiskLow:
+			return ActionRun, nil
+		}
+		return ActionConfirm, nil
+	}
+	return "", fmt.Errorf("unknown execution policy %q (want %s, %s, %s or %s)", policy, ExecPasteOnly, ExecConfirm, ExecConfirmHighRisk, ExecAutoLowRisk)
+}
+
+// CheckExecutable returns ErrBlocked when command matches the denylist. It
+// fails closed: a denylist entry that isn't a valid regular expression
+// blocks every command, since it can't be told what it was meant to block.
+func CheckExecutable(command string, cfg *config.SafetyConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	for _, pattern := range cfg.Denylist {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid denylist pattern %q: %w", pattern, err)
+		}
+	}
+	if IsBlocked(command, cfg) {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// ShellCommand prepares command to run with shell (bash, zsh or fish) in
+// cwd, the way the user's shell would run it. Commands that match the
+// denylist are refused: this is the only way linesense runs commands, and
+// no policy or option skips the check.
+func ShellCommand(ctx context.Context, command, shell, cwd string, cfg *config.SafetyConfig) (*exec.Cmd, error) {
+	if err := CheckExecutable(command, cfg); err != nil {
+		return nil, err
+	}
+
+	path, err := shellPath(shell)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(cwd); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("working directory %s doesn't exist", cwd)
+	}
+
+	cmd := exec.CommandContext(ctx, path, "-c", command)
+	cmd.Dir = cwd
+	cmd.Env = append(os.Environ(), "PWD="+cwd)
+	return cmd, nil
+}
+
+// shellPath finds the executable for shell, preferring $SHELL when it is
+// the same shell
+func shellPath(shell string) (string, error) {
+	if shell == "" {
+		shell = "sh"
+	}
+	if login := os.Getenv("SHELL"); login != "" && filepath.Base(login) == shell {
+		return login, nil
+	}
+	path, err := exec.LookPath(shell)
+	if err != nil {
+		return "", fmt.Errorf("failed to find %s: %w", shell, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+func TestExecActionFor(t *testing.T) {
+	tests := []struct {
+		policy string
+		risk   RiskLevel
+		want   ExecAction
+	}{
+		{"", RiskHigh, ActionPrint},
+		{ExecPasteOnly, RiskLow, ActionPrint},
+		{ExecConfirm, RiskLow, ActionConfirm},
+		{ExecConfirm, RiskMedium, ActionConfirm},
+		{ExecConfirm, RiskHigh, ActionRetype},
+		{ExecConfirmHighRisk, RiskLow, ActionRun},
+		{ExecConfirmHighRisk, RiskMedium, ActionRun},
+		{ExecConfirmHighRisk, RiskHigh, ActionRetype},
+		{ExecAutoLowRisk, RiskLow, ActionRun},
+		{ExecAutoLowRisk, RiskMedium, ActionConfirm},
+		{ExecAutoLowRisk, RiskHigh, ActionRetype},
+	}
+
+	for _, tt := range tests {
+		got, err := ExecActionFor(tt.policy, tt.risk)
+		if err != nil || got != tt.want {
+			t.Errorf("ExecActionFor(%q, %v) = %v, %v, want %v", tt.policy, tt.risk, got, err, tt.want)
+		}
+	}
+
+	if _, err := ExecActionFor("always", RiskLow); err == nil {
+		t.Error("ExecActionFor(\"always\") succeeded, want an error")
+	}
+}
+
+func TestShellCommand(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	t.Setenv("SHELL", "")
+	dir := t.TempDir()
+	cfg := &config.SafetyConfig{Denylist: []string{`rm\s+-rf\s+/`}}
+
+	cmd, err := ShellCommand(context.Background(), "pwd; echo $((1 + 2))", "bash", dir, cfg)
+	if err != nil {
+		t.Fatalf("ShellCommand() error = %v", err)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	want, _ := filepath.EvalSymlinks(dir)
+	if got := strings.Fields(out.String()); len(got) != 2 || got[0] != want || got[1] != "3" {
+		t.Errorf("output = %q, want %s and 3", out.String(), want)
+	}
+
+	// The denylist can't be got around by quoting
+	for _, command := range []string{"rm -rf /", `r""m -rf /`, "sudo rm -rf /"} {
+		if _, err := ShellCommand(context.Background(), command, "bash", dir, cfg); !errors.Is(err, ErrBlocked) {
+			t.Errorf("ShellCommand(%q) error = %v, want ErrBlocked", command, err)
+		}
+	}
+
+	// An invalid denylist pattern blocks everything
+	invalid := &config.SafetyConfig{Denylist: []string{`rm (`}}
+	if _, err := ShellCommand(context.Background(), "ls", "bash", dir, invalid); err == nil {
+		t.Error("ShellCommand() with an invalid denylist succeeded, want an error")
+	}
+
+	if _, err := ShellCommand(context.Background(), "ls", "bash", filepath.Join(dir, "missing"), cfg); err == nil {
+		t.Error("ShellCommand() in a missing directory succeeded, want an error")
+	}
+}
@@ -1,16 +1,42 @@
 package core
 
 import (
+	"context"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
+// recentCommitCount is how many commit subjects are collected from the log
+const recentCommitCount = 5
+
 // CollectGitInfo gathers git repository information from the current directory
 func CollectGitInfo(cwd string) (*GitInfo, error) {
-	// Check if we're in a git repository
-	cmd := exec.Command("git", "rev-parse", "--is-inside-work-tree")
-	cmd.Dir = cwd
-	if err := cmd.Run(); err != nil {
+	return CollectGitInfoContext(context.Background(), cwd)
+}
+
+// CollectGitInfoContext is like CollectGitInfo but kills any running git
+// process once ctx is done
+func CollectGitInfoContext(ctx context.Context, cwd string) (*GitInfo, error) {
+	info, err := collectGitRepo(ctx, cwd)
+	if info == nil || err != nil {
+		return info, err
+	}
+	if status, err := collectGitStatus(ctx, cwd); err == nil {
+		status.applyTo(info)
+	}
+	return info, nil
+}
+
+// collectGitRepo gathers the git context that is cheap even in large
+// repositories: everything but the working tree status. It returns nil
+// outside a git repository.
+func collectGitRepo(ctx context.Context, cwd string) (*GitInfo, error) {
+	// Check if we're in a git repository and locate its git directory
+	repoInfo, err := gitCommand(ctx, cwd, "rev-parse", "--is-inside-work-tree", "--absolute-git-dir")
+	if err != nil {
 		// Not a git repository, return nil (not an error)
 		return nil, nil
 	}
@@ -19,27 +45,86 @@ func CollectGitInfo(cwd string) (*GitInfo, error) {
 		IsRepo: true,
 	}
 
-	// Get current branch name
-	if branch, err := gitCommand(cwd, "rev-parse", "--abbrev-ref", "HEAD"); err == nil {
+	var gitDir string
+	if lines := strings.Split(strings.TrimSpace(repoInfo), "\n"); len(lines) == 2 {
+		gitDir = strings.TrimSpace(lines[1])
+	}
+
+	// Get the branch, which is also known before the first commit; HEAD is
+	// detached when it isn't a symbolic ref
+	if branch, err := gitCommand(ctx, cwd, "symbolic-ref", "--short", "-q", "HEAD"); err == nil {
 		info.Branch = strings.TrimSpace(branch)
+	} else if ctx.Err() == nil {
+		info.Detached = true
+	}
+
+	// Detect an in-progress rebase, merge, cherry-pick, etc.
+	if gitDir != "" {
+		info.Operation = detectGitOperation(gitDir)
+	}
+
+	// A detached HEAD has no branch name, so name it after the commit instead
+	if info.Detached {
+		if name := rebaseHeadName(gitDir); name != "" {
+			info.Branch = name
+		} else if sha, err := gitCommand(ctx, cwd, "rev-parse", "--short", "HEAD"); err == nil {
+			info.Branch = strings.TrimSpace(sha)
+		}
 	}
 
-	// Get status summary
-	if status, err := gitCommand(cwd, "status", "--porcelain"); err == nil {
-		info.StatusSummary = summarizeGitStatus(status)
+	// Count stash entries (fails when there is no stash)
+	if count, err := gitCommand(ctx, cwd, "rev-list", "--walk-reflogs", "--count", "refs/stash"); err == nil {
+		info.StashCount, _ = strconv.Atoi(strings.TrimSpace(count))
+	}
+
+	// Get recent commit subjects and the tags pointing at HEAD
+	if log, err := gitCommand(ctx, cwd, "log", "-n", strconv.Itoa(recentCommitCount), "--format=%D%x1f%s"); err == nil {
+		info.RecentCommits, info.Tags = parseGitLog(log)
 	}
 
 	// Get remote URLs
-	if remotes, err := gitCommand(cwd, "remote", "-v"); err == nil {
+	if remotes, err := gitCommand(ctx, cwd, "remote", "-v"); err == nil {
 		info.Remotes = parseGitRemotes(remotes)
 	}
 
 	return info, nil
 }
 
+// gitStatus is the part of the git context that comes from the working tree
+// status, which can take seconds in large repositories
+type gitStatus struct {
+	header    GitInfo // branch, upstream and ahead/behind from the status header
+	summary   string
+	conflicts []string
+}
+
+// collectGitStatus runs `git status` once for the upstream tracking, the
+// status summary and the conflicted paths
+func collectGitStatus(ctx context.Context, cwd string) (*gitStatus, error) {
+	status, err := gitCommand(ctx, cwd, "status", "--porcelain", "--branch")
+	if err != nil {
+		return nil, err
+	}
+	header, porcelain := splitGitStatusHeader(status)
+	s := &gitStatus{summary: summarizeGitStatus(porcelain), conflicts: parseGitConflicts(porcelain)}
+	parseGitBranchHeader(header, &s.header)
+	return s, nil
+}
+
+// applyTo adds the status to info. The branch is only taken from the status
+// when info doesn't have one, as when the rest of the git context is missing.
+func (s *gitStatus) applyTo(info *GitInfo) {
+	if info.Branch == "" && !info.Detached {
+		info.Branch, info.Detached = s.header.Branch, s.header.Detached
+	}
+	info.Upstream, info.Ahead, info.Behind = s.header.Upstream, s.header.Ahead, s.header.Behind
+	info.StatusSummary = s.summary
+	info.Conflicts = s.conflicts
+}
+
 // gitCommand executes a git command and returns its output
-func gitCommand(cwd string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
+func gitCommand(ctx context.Context, cwd string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = cwd
 	output, err := cmd.Output()
 	if err != nil {
@@ -48,6 +133,175 @@ func gitCommand(cwd string, args ...string) (string, error) {
 	return string(output), nil
 }
 
+// splitGitStatusHeader separates the "## ..." branch header produced by
+// `git status --porcelain --branch` from the file status lines
+func splitGitStatusHeader(status string) (string, string) {
+	if !strings.HasPrefix(status, "## ") {
+		return "", status
+	}
+	header, rest, _ := strings.Cut(status, "\n")
+	return header, rest
+}
+
+// parseGitBranchHeader fills branch, upstream and ahead/behind information
+// from a porcelain branch header such as "## main...origin/main [ahead 1, behind 2]"
+func parseGitBranchHeader(header string, info *GitInfo) {
+	header = strings.TrimPrefix(header, "## ")
+	if header == "" {
+		return
+	}
+
+	// Detached HEAD: "## HEAD (no branch)"
+	if strings.HasPrefix(header, "HEAD (no branch)") {
+		info.Detached = true
+		return
+	}
+
+	// Unborn branch: "## No commits yet on main" (older git: "## Initial commit on main")
+	for _, prefix := range []string{"No commits yet on ", "Initial commit on "} {
+		if strings.HasPrefix(header, prefix) {
+			info.Branch = strings.TrimPrefix(header, prefix)
+			return
+		}
+	}
+
+	// Split off the "[ahead N, behind M]" / "[gone]" suffix
+	tracking := ""
+	if i := strings.Index(header, " ["); i >= 0 && strings.HasSuffix(header, "]") {
+		tracking = header[i+2 : len(header)-1]
+		header = header[:i]
+	}
+
+	branch, upstream, _ := strings.Cut(header, "...")
+	info.Branch = branch
+	info.Upstream = upstream
+
+	for _, part := range strings.Split(tracking, ", ") {
+		fields := strings.Fields(part)
+		if len(fields) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "ahead":
+			info.Ahead = n
+		case "behind":
+			info.Behind = n
+		}
+	}
+}
+
+// isGitConflictStatus reports whether a porcelain XY code denotes an unmerged path
+func isGitConflictStatus(status string) bool {
+	switch status {
+	case "DD", "AU", "UD", "UA", "DU", "AA", "UU":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseGitConflicts returns the paths with unresolved merge conflicts
+func parseGitConflicts(porcelain string) []string {
+	var conflicts []string
+	for _, line := range strings.Split(porcelain, "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		if isGitConflictStatus(line[0:2]) {
+			conflicts = append(conflicts, unquoteGitPath(line[3:]))
+		}
+	}
+	return conflicts
+}
+
+// unquoteGitPath undoes the C-style quoting git applies to paths with spaces,
+// quotes or non-ASCII characters, so they can be given back to git as is
+func unquoteGitPath(path string) string {
+	if !strings.HasPrefix(path, `"`) {
+		return path
+	}
+	if unquoted, err := strconv.Unquote(path); err == nil {
+		return unquoted
+	}
+	return path
+}
+
+// detectGitOperation reports which multi-step git operation is in progress,
+// based on the marker files git leaves in its directory
+func detectGitOperation(gitDir string) string {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(gitDir, name))
+		return err == nil
+	}
+
+	switch {
+	case exists("rebase-merge"):
+		return "rebase"
+	case exists(filepath.Join("rebase-apply", "applying")):
+		return "am"
+	case exists("rebase-apply"):
+		return "rebase"
+	case exists("MERGE_HEAD"):
+		return "merge"
+	case exists("CHERRY_PICK_HEAD"):
+		return "cherry-pick"
+	case exists("REVERT_HEAD"):
+		return "revert"
+	case exists("BISECT_LOG"):
+		return "bisect"
+	default:
+		return ""
+	}
+}
+
+// rebaseHeadName returns the branch being rebased, if a rebase is in progress
+func rebaseHeadName(gitDir string) string {
+	if gitDir == "" {
+		return ""
+	}
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		content, err := os.ReadFile(filepath.Join(gitDir, dir, "head-name"))
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSpace(string(content))
+		if name != "" && name != "detached HEAD" {
+			return strings.TrimPrefix(name, "refs/heads/")
+		}
+	}
+	return ""
+}
+
+// parseGitLog extracts commit subjects and HEAD's tags from
+// `git log --format=%D%x1f%s` output
+func parseGitLog(logOutput string) ([]string, []string) {
+	var subjects, tags []string
+
+	for i, line := range strings.Split(strings.TrimSpace(logOutput), "\n") {
+		refs, subject, found := strings.Cut(line, "\x1f")
+		if !found {
+			continue
+		}
+		subjects = append(subjects, subject)
+
+		// Only the first entry is HEAD
+		if i != 0 {
+			continue
+		}
+		for _, ref := range strings.Split(refs, ", ") {
+			if tag, ok := strings.CutPrefix(ref, "tag: "); ok {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return subjects, tags
+}
+
 // summarizeGitStatus creates a human-readable summary of git status
 func summarizeGitStatus(porcelain string) string {
 	if strings.TrimSpace(porcelain) == "" {
@@ -59,6 +313,7 @@ func summarizeGitStatus(porcelain string) string {
 	added := 0
 	deleted := 0
 	untracked := 0
+	conflicted := 0
 
 	for _, line := range lines {
 		if len(line) < 2 {
@@ -66,6 +321,8 @@ func summarizeGitStatus(porcelain string) string {
 		}
 		status := line[0:2]
 		switch {
+		case isGitConflictStatus(status):
+			conflicted++
 		case strings.HasPrefix(status, "??"):
 			untracked++
 		case strings.HasPrefix(status, "A") || strings.HasPrefix(status, " A"):
@@ -78,6 +335,9 @@ func summarizeGitStatus(porcelain string) string {
 	}
 
 	var parts []string
+	if conflicted > 0 {
+		parts = append(parts, "conflicted")
+	}
 	if modified > 0 {
 		parts = append(parts, "modified")
 	}
@@ -1,17 +1,43 @@
 package core
 
 import (
-	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/traves/linesense/internal/config"
 )
 
+// historyBlockSize is the chunk size used when reading history files backwards
+const historyBlockSize = 32 * 1024
+
 // CollectHistory reads recent commands from shell history
 func CollectHistory(shell string, limit int) ([]HistoryEntry, error) {
-	historyPath, err := getHistoryPath(shell)
-	if err != nil {
-		return nil, err
+	return CollectHistoryFile(shell, "", limit)
+}
+
+// CollectHistoryFile reads recent commands from the given history file. If
+// path is empty, the history the LineSense shell hooks recorded for shell is
+// preferred, since it also carries exit codes and working directories, and
+// the shell's default history location is read when there is none.
+func CollectHistoryFile(shell, path string, limit int) ([]HistoryEntry, error) {
+	historyPath := path
+	if historyPath == "" {
+		if history, err := CollectManagedHistory(shell, limit); err == nil && len(history) > 0 {
+			return history, nil
+		}
+
+		var err error
+		historyPath, err = getHistoryPath(shell)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Check if history file exists
@@ -27,37 +53,339 @@ func CollectHistory(shell string, limit int) ([]HistoryEntry, error) {
 	}
 	defer file.Close()
 
-	// Read all lines
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+	reader, err := newReverseLineReader(file, historyBlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if shell == "bash" {
+		return tailBashHistory(reader, limit)
+	}
+	return tailHistory(reader, shell, limit)
+}
+
+// ManagedHistoryPath returns the JSONL history written by the shell hooks
+func ManagedHistoryPath() string {
+	return filepath.Join(config.GetConfigDir(), "history.jsonl")
+}
+
+// managedHistoryRecord is one line of the managed history file
+type managedHistoryRecord struct {
+	Command   string `json:"command"`
+	ExitCode  *int   `json:"exit_code"`
+	CWD       string `json:"cwd"`
+	Duration  *int   `json:"duration"`  // seconds
+	Timestamp int64  `json:"timestamp"` // Unix time the command started
+	Shell     string `json:"shell"`     // shell that ran the command, empty in older files
+}
+
+// CollectManagedHistory reads the last limit commands recorded by the
+// LineSense shell hooks for shell, or for any shell if shell is empty. A
+// missing file yields no entries; malformed lines are skipped.
+func CollectManagedHistory(shell string, limit int) ([]HistoryEntry, error) {
+	file, err := os.Open(ManagedHistoryPath())
+	if os.IsNotExist(err) {
+		return []HistoryEntry{}, nil
 	}
-	if err := scanner.Err(); err != nil {
+	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	// Get last N lines
-	start := 0
-	if len(lines) > limit {
-		start = len(lines) - limit
+	reader, err := newReverseLineReader(file, historyBlockSize)
+	if err != nil {
+		return nil, err
 	}
-	lines = lines[start:]
 
-	// Parse into HistoryEntry
-	var entries []HistoryEntry
-	for _, line := range lines {
-		entry := parseHistoryLine(shell, line)
+	entries := []HistoryEntry{}
+	for len(entries) < limit {
+		line, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var record managedHistoryRecord
+		if json.Unmarshal([]byte(line), &record) != nil || strings.TrimSpace(record.Command) == "" {
+			continue
+		}
+		if shell != "" && record.Shell != "" && record.Shell != shell {
+			continue
+		}
+
+		entry := HistoryEntry{
+			Command:  record.Command,
+			ExitCode: record.ExitCode,
+			CWD:      record.CWD,
+			Duration: record.Duration,
+		}
+		if record.Timestamp > 0 {
+			timestamp := formatHistoryTimestamp(record.Timestamp)
+			entry.Timestamp = &timestamp
+		}
+		entries = append(entries, entry)
+	}
+
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// hasManagedHistory reports whether the shell hooks recorded any commands
+// for shell
+func hasManagedHistory(shell string) bool {
+	history, err := CollectManagedHistory(shell, 1)
+	return err == nil && len(history) > 0
+}
+
+// LastFailedCommand returns the most recent entry that exited with a non-zero
+// status. Entries without a recorded exit code are skipped.
+func LastFailedCommand(history []HistoryEntry) (HistoryEntry, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if code := history[i].ExitCode; code != nil && *code != 0 {
+			return history[i], true
+		}
+	}
+	return HistoryEntry{}, false
+}
+
+// CompleteFromHistory returns the rest of the most recent single-line history
+// entry that starts with line, the way shell autosuggestions do
+func CompleteFromHistory(history []HistoryEntry, line string) (string, bool) {
+	if line == "" {
+		return "", false
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		command := history[i].Command
+		if len(command) > len(line) && strings.HasPrefix(command, line) && !strings.Contains(command, "\n") {
+			return command[len(line):], true
+		}
+	}
+	return "", false
+}
+
+// tailHistory reads the last limit entries of a history file. The reader
+// walks backwards from the end of the file in fixed-size blocks, so the cost
+// depends on limit rather than on the size of the file.
+func tailHistory(reader *reverseLineReader, shell string, limit int) ([]HistoryEntry, error) {
+	joins := historyLineJoins(shell)
+	entries := []HistoryEntry{}
+
+	// pending holds the physical lines of the entry currently being assembled,
+	// in file order. An entry is complete once we read the line before it and
+	// that line does not join onto it.
+	var pending []string
+	emit := func() {
+		if pending == nil {
+			return
+		}
+		entry := parseHistoryLine(shell, strings.Join(pending, "\n"))
+		pending = nil
 		if entry.Command != "" {
 			entries = append(entries, entry)
 		}
 	}
 
+	for len(entries) < limit {
+		line, err := reader.Next()
+		if err == io.EOF {
+			emit()
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if pending != nil && joins(line, pending[0]) {
+			pending = append([]string{line}, pending...)
+			continue
+		}
+		emit()
+		pending = []string{line}
+	}
+
+	// Entries were collected newest first
+	slices.Reverse(entries)
 	return entries, nil
 }
 
+// tailBashHistory reads the last limit entries of a bash history file.
+// When HISTTIMEFORMAT is set, bash writes a "#<unix time>" comment line before
+// each entry, and every line up to the next timestamp belongs to that entry
+// (multiline commands are stored this way with lithist). Without timestamps
+// each line is an entry of its own.
+func tailBashHistory(reader *reverseLineReader, limit int) ([]HistoryEntry, error) {
+	entries := []HistoryEntry{}
+
+	// run holds the lines read since the last timestamp, in file order
+	var run []string
+
+	// emitLines adds each line of run as its own entry, newest first
+	emitLines := func() {
+		for i := len(run) - 1; i >= 0 && len(entries) < limit; i-- {
+			if entry := parseHistoryLine("bash", run[i]); entry.Command != "" {
+				entries = append(entries, entry)
+			}
+		}
+		run = nil
+	}
+
+	for len(entries) < limit {
+		line, err := reader.Next()
+		if err == io.EOF {
+			// Lines before the first timestamp were written without one
+			emitLines()
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if unix, ok := parseBashTimestamp(line); ok {
+			entry := parseHistoryLine("bash", strings.Join(run, "\n"))
+			run = nil
+			if entry.Command != "" {
+				timestamp := formatHistoryTimestamp(unix)
+				entry.Timestamp = &timestamp
+				entries = append(entries, entry)
+			}
+			continue
+		}
+
+		run = append([]string{line}, run...)
+
+		// A run longer than the whole limit cannot be a single timestamped
+		// entry, so this part of the file has no timestamps
+		if len(run) > limit {
+			emitLines()
+		}
+	}
+
+	// Entries were collected newest first
+	slices.Reverse(entries)
+	return entries, nil
+}
+
+// parseBashTimestamp recognizes the "#1700000000" comment lines bash writes
+// before each history entry when HISTTIMEFORMAT is set
+func parseBashTimestamp(line string) (int64, bool) {
+	digits, ok := strings.CutPrefix(line, "#")
+	if !ok || digits == "" {
+		return 0, false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	unix, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return unix, true
+}
+
+// historyLineJoins returns a function reporting whether a physical line of
+// the given shell's history file belongs to the same entry as the line after it
+func historyLineJoins(shell string) func(line, next string) bool {
+	switch shell {
+	case "zsh":
+		// Zsh writes multiline commands with a trailing backslash on every
+		// line but the last
+		return func(line, _ string) bool {
+			return strings.HasSuffix(line, "\\") && !strings.HasSuffix(line, "\\\\")
+		}
+	case "fish":
+		// Every fish entry starts with "- cmd:"; the indented "when:" and
+		// "paths:" lines that follow belong to it
+		return func(_, next string) bool {
+			return !strings.HasPrefix(next, "- cmd:")
+		}
+	default:
+		return func(string, string) bool { return false }
+	}
+}
+
+// reverseLineReader returns the lines of a file from last to first
+type reverseLineReader struct {
+	file      io.ReaderAt
+	blockSize int64
+	offset    int64  // start of the region that has not been read yet
+	buf       []byte // read but not yet returned; its first line may be partial
+	done      bool
+	bytesRead int64
+}
+
+// newReverseLineReader creates a reader positioned at the end of file
+func newReverseLineReader(file *os.File, blockSize int64) (*reverseLineReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reverseLineReader{
+		file:      file,
+		blockSize: blockSize,
+		offset:    info.Size(),
+	}
+
+	// Ignore the newline terminating the last line
+	if r.offset > 0 {
+		last := make([]byte, 1)
+		if _, err := file.ReadAt(last, r.offset-1); err != nil {
+			return nil, err
+		}
+		if last[0] == '\n' {
+			r.offset--
+		}
+	}
+
+	return r, nil
+}
+
+// Next returns the previous line of the file, or io.EOF once the start of
+// the file has been reached
+func (r *reverseLineReader) Next() (string, error) {
+	for {
+		if r.done {
+			return "", io.EOF
+		}
+
+		// Everything after the last newline in buf is a complete line,
+		// because the bytes following it have already been returned
+		if i := bytes.LastIndexByte(r.buf, '\n'); i >= 0 {
+			line := r.buf[i+1:]
+			r.buf = r.buf[:i]
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+
+		if r.offset == 0 {
+			r.done = true
+			return strings.TrimSuffix(string(r.buf), "\r"), nil
+		}
+
+		// Read the previous block and prepend it to the carried-over bytes
+		size := min(r.blockSize, r.offset)
+		r.offset -= size
+		block := make([]byte, size+int64(len(r.buf)))
+		if _, err := r.file.ReadAt(block[:size], r.offset); err != nil && err != io.EOF {
+			return "", err
+		}
+		copy(block[size:], r.buf)
+		r.buf = block
+		r.bytesRead += size
+	}
+}
+
 // getHistoryPath returns the path to the shell history file
 func getHistoryPath(shell string) (string, error) {
+	// Fish does not use HISTFILE, so an inherited value would point at
+	// another shell's history
+	if shell == "fish" {
+		return getFishHistoryPath()
+	}
+
 	// Check HISTFILE environment variable first
 	if histFile := os.Getenv("HISTFILE"); histFile != "" {
 		return histFile, nil
@@ -81,22 +409,47 @@ func getHistoryPath(shell string) (string, error) {
 	}
 }
 
-// parseHistoryLine parses a single history line based on shell type
+// getFishHistoryPath returns $XDG_DATA_HOME/fish/<session>_history, where
+// the session name comes from the fish_history variable (default "fish")
+func getFishHistoryPath() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataDir = filepath.Join(home, ".local", "share")
+	}
+
+	session := os.Getenv("fish_history")
+	if session == "" {
+		session = "fish"
+	}
+
+	return filepath.Join(dataDir, "fish", session+"_history"), nil
+}
+
+// parseHistoryLine parses a single history entry based on shell type.
+// Multiline entries are passed as their physical lines joined by newlines.
 func parseHistoryLine(shell string, line string) HistoryEntry {
+	if shell == "zsh" {
+		line = unmetafyZsh(line)
+		// Zsh ends every line of a multiline command but the last with a backslash
+		line = strings.ReplaceAll(line, "\\\n", "\n")
+	}
+
 	line = strings.TrimSpace(line)
 	if line == "" {
 		return HistoryEntry{}
 	}
 
 	switch shell {
+	case "fish":
+		return parseFishEntry(line)
 	case "zsh":
 		// Zsh extended history format: ": timestamp:duration;command"
-		if strings.HasPrefix(line, ":") {
-			parts := strings.SplitN(line[1:], ";", 2)
-			if len(parts) == 2 {
-				command := strings.TrimSpace(parts[1])
-				return HistoryEntry{Command: command}
-			}
+		if entry, ok := parseZshExtendedLine(line); ok {
+			return entry
 		}
 		// Fallthrough to simple format
 		fallthrough
@@ -107,3 +460,119 @@ func parseHistoryLine(shell string, line string) HistoryEntry {
 		return HistoryEntry{Command: line}
 	}
 }
+
+// parseZshExtendedLine parses ": <timestamp>:<duration>;<command>", the format
+// zsh writes when EXTENDED_HISTORY is set
+func parseZshExtendedLine(line string) (HistoryEntry, bool) {
+	rest, ok := strings.CutPrefix(line, ":")
+	if !ok {
+		return HistoryEntry{}, false
+	}
+
+	meta, command, ok := strings.Cut(strings.TrimLeft(rest, " "), ";")
+	if !ok {
+		return HistoryEntry{}, false
+	}
+	startStr, durationStr, ok := strings.Cut(meta, ":")
+	if !ok {
+		return HistoryEntry{}, false
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return HistoryEntry{}, false
+	}
+	duration, err := strconv.Atoi(durationStr)
+	if err != nil {
+		return HistoryEntry{}, false
+	}
+
+	timestamp := formatHistoryTimestamp(start)
+	return HistoryEntry{
+		Command:   strings.TrimSpace(command),
+		Timestamp: &timestamp,
+		Duration:  &duration,
+	}, true
+}
+
+// parseFishEntry parses one entry of fish's YAML-like history format: a
+// "- cmd: <command>" line followed by indented "when: <unix time>" and
+// "paths:" lines
+func parseFishEntry(entry string) HistoryEntry {
+	var result HistoryEntry
+
+	for _, line := range strings.Split(entry, "\n") {
+		if cmd, ok := strings.CutPrefix(line, "- cmd: "); ok {
+			result.Command = strings.TrimSpace(unescapeFishHistory(cmd))
+			continue
+		}
+		if when, ok := strings.CutPrefix(strings.TrimSpace(line), "when: "); ok {
+			if unix, err := strconv.ParseInt(strings.TrimSpace(when), 10, 64); err == nil {
+				timestamp := formatHistoryTimestamp(unix)
+				result.Timestamp = &timestamp
+			}
+		}
+	}
+
+	if result.Command == "" {
+		return HistoryEntry{}
+	}
+	return result
+}
+
+// unescapeFishHistory decodes the escaping fish applies to commands in its
+// history file, where a newline is written as backslash-n and a backslash
+// is doubled
+func unescapeFishHistory(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'n':
+				sb.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				sb.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// formatHistoryTimestamp converts a Unix timestamp to the ISO 8601 form used
+// in HistoryEntry
+func formatHistoryTimestamp(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
+
+// zshMeta is the byte zsh uses to escape special bytes in its history file
+const zshMeta = 0x83
+
+// unmetafyZsh reverses zsh's "metafied" encoding, in which certain bytes
+// (including parts of multibyte UTF-8 characters) are written as Meta
+// followed by the original byte XOR 32
+func unmetafyZsh(s string) string {
+	i := strings.IndexByte(s, zshMeta)
+	if i < 0 {
+		return s
+	}
+
+	buf := []byte(s[:i])
+	for ; i < len(s); i++ {
+		if s[i] == zshMeta && i+1 < len(s) {
+			i++
+			buf = append(buf, s[i]^32)
+			continue
+		}
+		buf = append(buf, s[i])
+	}
+	return string(buf)
+}
@@ -0,0 +1,480 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain points the config directory at an empty location so that history
+// recorded by a developer's own shell hooks does not leak into the tests
+func TestMain(m *testing.M) {
+	configDir, err := os.MkdirTemp("", "linesense-config")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XDG_CONFIG_HOME", configDir)
+
+	code := m.Run()
+	os.RemoveAll(configDir)
+	os.Exit(code)
+}
+
+// writeHistoryFile creates a bash history file with n numbered commands
+func writeHistoryFile(tb testing.TB, n int) string {
+	tb.Helper()
+
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, "echo command number %d\n", i)
+	}
+
+	histFile := filepath.Join(tb.TempDir(), ".bash_history")
+	if err := os.WriteFile(histFile, []byte(sb.String()), 0644); err != nil {
+		tb.Fatalf("Failed to write test history: %v", err)
+	}
+	return histFile
+}
+
+func TestReverseLineReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"trailing newline", "one\ntwo\nthree\n", []string{"three", "two", "one"}},
+		{"no trailing newline", "one\ntwo", []string{"two", "one"}},
+		{"crlf", "one\r\ntwo\r\n", []string{"two", "one"}},
+		{"blank lines", "one\n\ntwo\n", []string{"two", "", "one"}},
+		{"empty", "", []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history")
+			os.WriteFile(path, []byte(tt.content), 0644)
+			file, _ := os.Open(path)
+			defer file.Close()
+
+			// A tiny block size exercises lines spanning several blocks
+			reader, err := newReverseLineReader(file, 3)
+			if err != nil {
+				t.Fatalf("newReverseLineReader() error = %v", err)
+			}
+
+			var got []string
+			for {
+				line, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next() error = %v", err)
+				}
+				got = append(got, line)
+			}
+
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTailHistory_ReadsOnlyTail(t *testing.T) {
+	histFile := writeHistoryFile(t, 200000)
+
+	file, err := os.Open(histFile)
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	defer file.Close()
+
+	reader, err := newReverseLineReader(file, historyBlockSize)
+	if err != nil {
+		t.Fatalf("newReverseLineReader() error = %v", err)
+	}
+
+	history, err := tailHistory(reader, "bash", 50)
+	if err != nil {
+		t.Fatalf("tailHistory() error = %v", err)
+	}
+
+	if len(history) != 50 {
+		t.Fatalf("History length = %d, want 50", len(history))
+	}
+	if history[49].Command != "echo command number 199999" {
+		t.Errorf("Last entry = %q, want the newest command", history[49].Command)
+	}
+	if history[0].Command != "echo command number 199950" {
+		t.Errorf("First entry = %q, want the 50th newest command", history[0].Command)
+	}
+
+	// 50 short lines fit in a single block, regardless of the file size
+	if reader.bytesRead > historyBlockSize {
+		t.Errorf("Read %d bytes, want at most one %d byte block", reader.bytesRead, historyBlockSize)
+	}
+}
+
+func TestTailHistory_ZshMultiline(t *testing.T) {
+	histFile := filepath.Join(t.TempDir(), ".zsh_history")
+	histContent := ": 1700000000:0;ls\n: 1700000001:0;for f in *; do\\\n  echo $f\\\ndone\n: 1700000002:0;pwd\n"
+	os.WriteFile(histFile, []byte(histContent), 0644)
+
+	file, _ := os.Open(histFile)
+	defer file.Close()
+	reader, _ := newReverseLineReader(file, 8)
+
+	history, err := tailHistory(reader, "zsh", 2)
+	if err != nil {
+		t.Fatalf("tailHistory() error = %v", err)
+	}
+
+	if len(history) != 2 {
+		t.Fatalf("History length = %d, want 2", len(history))
+	}
+	if !strings.HasPrefix(history[0].Command, "for f in *; do") || !strings.Contains(history[0].Command, "done") {
+		t.Errorf("Multiline entry = %q, want the whole for loop", history[0].Command)
+	}
+	if history[1].Command != "pwd" {
+		t.Errorf("Last entry = %q, want pwd", history[1].Command)
+	}
+}
+
+// BenchmarkCollectHistory shows that reading the last entries takes the same
+// time regardless of how large the history file is
+func BenchmarkCollectHistory(b *testing.B) {
+	for _, size := range []int{1000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("lines=%d", size), func(b *testing.B) {
+			histFile := writeHistoryFile(b, size)
+			b.Setenv("HISTFILE", histFile)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := CollectHistory("bash", 100); err != nil {
+					b.Fatalf("CollectHistory() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseHistoryLine_ZshExtended(t *testing.T) {
+	tests := []struct {
+		name          string
+		line          string
+		wantCommand   string
+		wantTimestamp string
+		wantDuration  int
+	}{
+		{"extended", ": 1700000000:3;make test", "make test", "2023-11-14T22:13:20Z", 3},
+		{"extended no duration", ": 1700000000:0;ls", "ls", "2023-11-14T22:13:20Z", 0},
+		{"multiline", ": 1700000000:1;echo one\\\necho two", "echo one\necho two", "2023-11-14T22:13:20Z", 1},
+		{"metafied utf-8", ": 1700000000:0;echo a \xe2\x83\xa6\x83\xb2 b", "echo a → b", "2023-11-14T22:13:20Z", 0},
+		{"simple", "git status", "git status", "", 0},
+		{"not extended", ": malformed", ": malformed", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := parseHistoryLine("zsh", tt.line)
+
+			if entry.Command != tt.wantCommand {
+				t.Errorf("Command = %q, want %q", entry.Command, tt.wantCommand)
+			}
+
+			if tt.wantTimestamp == "" {
+				if entry.Timestamp != nil {
+					t.Errorf("Timestamp = %q, want nil", *entry.Timestamp)
+				}
+				return
+			}
+			if entry.Timestamp == nil || *entry.Timestamp != tt.wantTimestamp {
+				t.Errorf("Timestamp = %v, want %q", entry.Timestamp, tt.wantTimestamp)
+			}
+			if entry.Duration == nil || *entry.Duration != tt.wantDuration {
+				t.Errorf("Duration = %v, want %d", entry.Duration, tt.wantDuration)
+			}
+		})
+	}
+}
+
+func TestUnmetafyZsh(t *testing.T) {
+	// "ф" is 0xd1 0x84; zsh stores 0x84 as Meta (0x83) followed by 0x84^32
+	if got := unmetafyZsh("\xd1\x83\xa4"); got != "ф" {
+		t.Errorf("unmetafyZsh() = %q, want ф", got)
+	}
+	if got := unmetafyZsh("plain ascii"); got != "plain ascii" {
+		t.Errorf("unmetafyZsh() = %q, want unchanged input", got)
+	}
+}
+
+func TestCollectHistoryFile_BashTimestamps(t *testing.T) {
+	histFile := filepath.Join(t.TempDir(), "custom_history")
+	histContent := "old untimestamped command\n#1700000000\nls -la\n#1700000060\nfor f in *; do\necho $f\ndone\n#1700000120\ngit status\n"
+	os.WriteFile(histFile, []byte(histContent), 0644)
+
+	history, err := CollectHistoryFile("bash", histFile, 10)
+	if err != nil {
+		t.Fatalf("CollectHistoryFile() error = %v", err)
+	}
+
+	want := []struct {
+		command   string
+		timestamp string
+	}{
+		{"old untimestamped command", ""},
+		{"ls -la", "2023-11-14T22:13:20Z"},
+		{"for f in *; do\necho $f\ndone", "2023-11-14T22:14:20Z"},
+		{"git status", "2023-11-14T22:15:20Z"},
+	}
+
+	if len(history) != len(want) {
+		t.Fatalf("History length = %d, want %d: %+v", len(history), len(want), history)
+	}
+	for i, w := range want {
+		if history[i].Command != w.command {
+			t.Errorf("entry %d Command = %q, want %q", i, history[i].Command, w.command)
+		}
+		if strings.HasPrefix(history[i].Command, "#") {
+			t.Errorf("entry %d is a timestamp comment, not a command", i)
+		}
+		got := ""
+		if history[i].Timestamp != nil {
+			got = *history[i].Timestamp
+		}
+		if got != w.timestamp {
+			t.Errorf("entry %d Timestamp = %q, want %q", i, got, w.timestamp)
+		}
+	}
+}
+
+func TestCollectHistoryFile_BashLimitWithoutTimestamps(t *testing.T) {
+	histFile := writeHistoryFile(t, 1000)
+
+	history, err := CollectHistoryFile("bash", histFile, 3)
+	if err != nil {
+		t.Fatalf("CollectHistoryFile() error = %v", err)
+	}
+
+	if len(history) != 3 {
+		t.Fatalf("History length = %d, want 3", len(history))
+	}
+	if history[2].Command != "echo command number 999" {
+		t.Errorf("Last entry = %q, want the newest command", history[2].Command)
+	}
+}
+
+func TestCollectHistoryFile_Fish(t *testing.T) {
+	histFile := filepath.Join(t.TempDir(), "fish_history")
+	histContent := `- cmd: ls -la
+  when: 1700000000
+- cmd: cat README.md
+  when: 1700000060
+  paths:
+    - README.md
+- cmd: echo "one\ntwo" \\\\ done
+  when: 1700000120
+`
+	os.WriteFile(histFile, []byte(histContent), 0644)
+
+	history, err := CollectHistoryFile("fish", histFile, 10)
+	if err != nil {
+		t.Fatalf("CollectHistoryFile() error = %v", err)
+	}
+
+	want := []string{"ls -la", "cat README.md", "echo \"one\ntwo\" \\\\ done"}
+	if len(history) != len(want) {
+		t.Fatalf("History length = %d, want %d: %+v", len(history), len(want), history)
+	}
+	for i, command := range want {
+		if history[i].Command != command {
+			t.Errorf("entry %d Command = %q, want %q", i, history[i].Command, command)
+		}
+	}
+	if history[1].Timestamp == nil || *history[1].Timestamp != "2023-11-14T22:14:20Z" {
+		t.Errorf("Timestamp = %v, want 2023-11-14T22:14:20Z", history[1].Timestamp)
+	}
+
+	// The limit counts entries, not the lines that make them up
+	history, _ = CollectHistoryFile("fish", histFile, 1)
+	if len(history) != 1 || history[0].Command != want[2] {
+		t.Errorf("Limited history = %+v, want only the newest entry", history)
+	}
+}
+
+func TestGetHistoryPath_FishIgnoresHISTFILE(t *testing.T) {
+	t.Setenv("HISTFILE", "/tmp/.bash_history")
+	t.Setenv("XDG_DATA_HOME", "/data")
+	t.Setenv("fish_history", "")
+
+	path, err := getHistoryPath("fish")
+	if err != nil {
+		t.Fatalf("getHistoryPath() error = %v", err)
+	}
+	if path != "/data/fish/fish_history" {
+		t.Errorf("getHistoryPath(fish) = %q, want /data/fish/fish_history", path)
+	}
+
+	t.Setenv("fish_history", "work")
+	path, _ = getHistoryPath("fish")
+	if path != "/data/fish/work_history" {
+		t.Errorf("getHistoryPath(fish) = %q, want /data/fish/work_history", path)
+	}
+}
+
+func TestCollectManagedHistory(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := os.MkdirAll(filepath.Dir(ManagedHistoryPath()), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	histContent := `{"command":"make build","exit_code":0,"cwd":"/repo","duration":12,"timestamp":1700000000}
+not json
+{"command":"","exit_code":0}
+{"command":"mkae test","exit_code":127,"cwd":"/repo","duration":0,"timestamp":1700000060}
+{"command":"echo \"a\\nb\"","exit_code":1,"cwd":"/tmp","timestamp":1700000120}
+`
+	os.WriteFile(ManagedHistoryPath(), []byte(histContent), 0644)
+
+	history, err := CollectManagedHistory("", 10)
+	if err != nil {
+		t.Fatalf("CollectManagedHistory() error = %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("History length = %d, want 3: %+v", len(history), history)
+	}
+
+	failed := history[1]
+	if failed.Command != "mkae test" || failed.ExitCode == nil || *failed.ExitCode != 127 {
+		t.Errorf("entry 1 = %+v, want mkae test with exit code 127", failed)
+	}
+	if failed.CWD != "/repo" {
+		t.Errorf("CWD = %q, want /repo", failed.CWD)
+	}
+	if failed.Timestamp == nil || *failed.Timestamp != "2023-11-14T22:14:20Z" {
+		t.Errorf("Timestamp = %v, want 2023-11-14T22:14:20Z", failed.Timestamp)
+	}
+	if history[0].Duration == nil || *history[0].Duration != 12 {
+		t.Errorf("Duration = %v, want 12", history[0].Duration)
+	}
+	if history[2].Command != "echo \"a\\nb\"" {
+		t.Errorf("Command = %q, want escaped quotes and backslash preserved", history[2].Command)
+	}
+
+	// The managed history takes precedence over the shell's default history
+	t.Setenv("HISTFILE", writeHistoryFile(t, 5))
+	history, err = CollectHistoryFile("bash", "", 2)
+	if err != nil {
+		t.Fatalf("CollectHistoryFile() error = %v", err)
+	}
+	if len(history) != 2 || history[0].Command != "mkae test" {
+		t.Errorf("CollectHistoryFile() = %+v, want the last 2 managed entries", history)
+	}
+}
+
+func TestCollectHistoryFile_ManagedHistoryPrecedence(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := os.MkdirAll(filepath.Dir(ManagedHistoryPath()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	histContent := `{"command":"git status","exit_code":0,"shell":"bash"}
+{"command":"ls **/*.go","exit_code":0,"shell":"zsh"}
+`
+	os.WriteFile(ManagedHistoryPath(), []byte(histContent), 0644)
+	histFile := writeHistoryFile(t, 3)
+	t.Setenv("HISTFILE", histFile)
+
+	tests := []struct {
+		name  string
+		shell string
+		path  string
+		want  string // last command
+	}{
+		{"explicit path wins", "bash", histFile, "echo command number 2"},
+		{"other shells filtered", "bash", "", "git status"},
+		{"entries of the shell only", "zsh", "", "ls **/*.go"},
+		{"no managed entries for the shell", "ksh", "", "echo command number 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history, err := CollectHistoryFile(tt.shell, tt.path, 10)
+			if err != nil {
+				t.Fatalf("CollectHistoryFile() error = %v", err)
+			}
+			if len(history) == 0 || history[len(history)-1].Command != tt.want {
+				t.Errorf("CollectHistoryFile() = %+v, want last command %q", history, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectManagedHistory_Missing(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	history, err := CollectManagedHistory("", 10)
+	if err != nil {
+		t.Fatalf("CollectManagedHistory() error = %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("History length = %d, want 0", len(history))
+	}
+
+	// Without managed history the shell's history file is used
+	history, _ = CollectHistoryFile("bash", writeHistoryFile(t, 5), 3)
+	if len(history) != 3 {
+		t.Errorf("History length = %d, want 3", len(history))
+	}
+}
+
+func TestLastFailedCommand(t *testing.T) {
+	failed, succeeded := 2, 0
+	history := []HistoryEntry{
+		{Command: "make tset", ExitCode: &failed},
+		{Command: "gti status", ExitCode: &failed},
+		{Command: "ls", ExitCode: &succeeded},
+		{Command: "echo unknown"},
+	}
+
+	entry, ok := LastFailedCommand(history)
+	if !ok || entry.Command != "gti status" {
+		t.Errorf("LastFailedCommand() = %q, %v, want gti status", entry.Command, ok)
+	}
+
+	if _, ok := LastFailedCommand(history[2:]); ok {
+		t.Error("LastFailedCommand() should not find a failure without non-zero exit codes")
+	}
+}
+
+func TestCompleteFromHistory(t *testing.T) {
+	history := []HistoryEntry{
+		{Command: "git status"},
+		{Command: "git stash pop"},
+		{Command: "for f in *; do\necho $f; done"},
+		{Command: "git st"},
+	}
+
+	tests := []struct {
+		line   string
+		want   string
+		wantOk bool
+	}{
+		{"git st", "ash pop", true},
+		{"git sta", "sh pop", true},
+		{"git status", "", false},
+		{"for f", "", false},
+		{"docker", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := CompleteFromHistory(history, tt.line)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("CompleteFromHistory(%q) = %q, %v, want %q, %v", tt.line, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
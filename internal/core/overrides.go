@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+// Override actions
+const (
+	OverrideAllowlist = "allowlist" // the command matched safety.allowlist
+	OverrideDisable   = "disable"   // the rule is disabled
+	OverrideDowngrade = "downgrade" // the rule's severity is lowered
+)
+
+// OverrideEvent records one finding loosened by the allowlist or a rule
+// override. Events are appended to the override log when the command is
+// accepted or run, so that what was loosened, and where, can be audited.
+// Timestamp, User and Host are filled in when the event is logged.
+type OverrideEvent struct {
+	Timestamp string    `json:"timestamp,omitempty"` // RFC 3339
+	User      string    `json:"user,omitempty"`
+	Host      string    `json:"host,omitempty"`
+	CWD       string    `json:"cwd"`
+	Command   string    `json:"command"`
+	Rule      string    `json:"rule"`
+	Source    string    `json:"source"`
+	Action    string    `json:"action"` // "allowlist" | "disable" | "downgrade"
+	From      RiskLevel `json:"from"`
+	To        RiskLevel `json:"to,omitempty"`      // empty when the finding was dropped
+	Scope     string    `json:"scope"`             // "global" or "project:<root>"
+	Pattern   string    `json:"pattern,omitempty"` // the allowlist entry that matched
+}
+
+// OverrideLogPath returns the log of applied safety overrides
+func OverrideLogPath() string {
+	return filepath.Join(config.GetConfigDir(), "safety_overrides.jsonl")
+}
+
+// LogOverrides appends events to the override log, stamped with the time,
+// user and host
+func LogOverrides(events []OverrideEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	username, host := currentUser(), hostname()
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		event.Timestamp, event.User, event.Host = now, username, host
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to encode override event: %w", err)
+		}
+	}
+
+	path := OverrideLogPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open override log: %w", err)
+	}
+	defer file.Close()
+
+	// One write per batch keeps concurrent writers' lines whole
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write override log: %w", err)
+	}
+	return nil
+}
+
+// applyOverrides loosens findings according to the allowlist and rule
+// overrides in cfg, global and for the project containing input.CWD, and
+// returns an event for every finding it loosened
+func applyOverrides(cfg *config.SafetyConfig, input RiskInput, findings []Finding) ([]Finding, []OverrideEvent) {
+	if cfg == nil || len(findings) == 0 {
+		return findings, nil
+	}
+
+	root, project, inProject := cfg.ProjectFor(input.CWD)
+	projectScope := "project:" + root
+
+	newEvent := func(finding Finding, action, scope string) OverrideEvent {
+		return OverrideEvent{
+			CWD:     input.CWD,
+			Command: input.Command,
+			Rule:    finding.Rule,
+			Source:  finding.Source,
+			Action:  action,
+			From:    finding.Severity,
+			Scope:   scope,
+		}
+	}
+
+	var (
+		events []OverrideEvent
+		kept   []Finding
+	)
+
+	// An allowlisted command keeps none of its findings
+	pattern, scope := matchAllowlist(input.Command, cfg.Allowlist, "global")
+	if pattern == "" && inProject {
+		pattern, scope = matchAllowlist(input.Command, project.Allowlist, projectScope)
+	}
+	if pattern != "" {
+		for _, finding := range findings {
+			event := newEvent(finding, OverrideAllowlist, scope)
+			event.Pattern = pattern
+			events = append(events, event)
+		}
+	} else {
+		for _, finding := range findings {
+			override, ok := cfg.Rules[finding.Rule]
+			scope := "global"
+			if projectOverride, found := project.Rules[finding.Rule]; inProject && found {
+				override, ok, scope = projectOverride, true, projectScope
+			}
+			if !ok {
+				kept = append(kept, finding)
+				continue
+			}
+
+			switch to := RiskLevel(override.Downgrade); {
+			case override.Disable:
+				events = append(events, newEvent(finding, OverrideDisable, scope))
+			case (to == RiskLow || to == RiskMedium) && riskRank[to] < riskRank[finding.Severity]:
+				event := newEvent(finding, OverrideDowngrade, scope)
+				event.To = to
+				events = append(events, event)
+
+				finding.Override = fmt.Sprintf("downgraded from %s (%s)", finding.Severity, scope)
+				finding.Severity = to
+				kept = append(kept, finding)
+			default:
+				kept = append(kept, finding)
+			}
+		}
+	}
+
+	if len(events) == 0 {
+		return findings, nil
+	}
+	return kept, events
+}
+
+// matchAllowlist returns the first allowlist entry matching the whole of
+// command, case-insensitively, and scope
+func matchAllowlist(command string, allowlist []string, scope string) (string, string) {
+	for _, pattern := range allowlist {
+		re, err := regexp.Compile(`(?i)^(?:` + pattern + `)$`)
+		if err == nil && re.MatchString(command) {
+			return pattern, scope
+		}
+	}
+	return "", ""
+}
+
+// currentUser returns the name of the user running linesense
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// hostname returns the machine's host name, or empty if it is unknown
+func hostname() string {
+	host, _ := os.Hostname()
+	return host
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+func TestRiskChain_Overrides(t *testing.T) {
+	cfg := &config.SafetyConfig{
+		Allowlist: []string{`sudo make deploy`},
+		Rules: map[string]config.RuleOverride{
+			"mv":                {Disable: true},
+			"rm-recursive-root": {Downgrade: "medium"},
+			"kill":              {Downgrade: "high"}, // never raises
+		},
+		Projects: map[string]config.ProjectSafetyConfig{
+			"/srv/app": {
+				Allowlist: []string{`sudo \./scripts/reset-db\.sh`},
+				Rules:     map[string]config.RuleOverride{"mv": {Downgrade: "low"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		command    string
+		cwd        string
+		want       RiskLevel
+		wantEvents []string // actions logged
+	}{
+		{"disabled rule", "mv a b", "/tmp", RiskLow, []string{OverrideDisable}},
+		{"downgraded rule", "rm -rf /", "", RiskMedium, []string{OverrideDowngrade}}, // no cwd, so no target count
+		{"downgrade can't raise", "kill 1234", "/tmp", RiskMedium, nil},
+		{"project override wins", "mv a b", "/srv/app/web", RiskLow, []string{OverrideDowngrade}},
+		{"allowlisted", "sudo make deploy", "/tmp", RiskLow, []string{OverrideAllowlist}},
+		{"allowlist matches the whole line", "sudo make deploy; sudo reboot", "/tmp", RiskMedium, nil},
+		{"project allowlist", "sudo ./scripts/reset-db.sh", "/srv/app", RiskLow, []string{OverrideAllowlist}},
+		{"project allowlist only applies inside", "sudo ./scripts/reset-db.sh", "/tmp", RiskMedium, nil},
+		{"no overrides apply", "chmod 777 x", "/tmp", RiskHigh, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			risk, findings, logged := DefaultRiskChain(cfg).ClassifyOverrides(context.Background(), RiskInput{Command: tt.command, CWD: tt.cwd})
+			if risk != tt.want {
+				t.Errorf("risk = %v, want %v (findings %+v)", risk, tt.want, findings)
+			}
+			if len(logged) != len(tt.wantEvents) {
+				t.Fatalf("logged %+v, want actions %v", logged, tt.wantEvents)
+			}
+			for i, action := range tt.wantEvents {
+				if logged[i].Action != action || logged[i].Command != tt.command {
+					t.Errorf("event %d = %+v, want a %s event for %q", i, logged[i], action, tt.command)
+				}
+			}
+		})
+	}
+}
+
+func TestRiskChain_AllowlistDropsFindings(t *testing.T) {
+	cfg := &config.SafetyConfig{Allowlist: []string{`sudo systemctl restart nginx`}}
+	risk, findings, logged := DefaultRiskChain(cfg).ClassifyOverrides(context.Background(), RiskInput{Command: "sudo systemctl restart nginx"})
+	if risk != RiskLow || len(findings) != 0 {
+		t.Errorf("got %v %+v, want low with no findings", risk, findings)
+	}
+	if len(logged) != 2 || logged[0].Action != OverrideAllowlist || logged[0].Pattern != cfg.Allowlist[0] || logged[0].Scope != "global" {
+		t.Errorf("logged %+v, want an allowlist event per finding", logged)
+	}
+}
+
+func TestLogOverrides(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	// Classifying alone writes nothing
+	cfg := &config.SafetyConfig{Rules: map[string]config.RuleOverride{"mv": {Disable: true}}}
+	risk, _, events := DefaultRiskChain(cfg).ClassifyOverrides(context.Background(), RiskInput{Command: "mv a b"})
+	if risk != RiskLow {
+		t.Fatalf("risk = %v, want low", risk)
+	}
+	if _, err := os.Stat(OverrideLogPath()); !os.IsNotExist(err) {
+		t.Fatalf("classifying wrote the override log: %v", err)
+	}
+
+	if err := LogOverrides(events); err != nil {
+		t.Fatalf("LogOverrides() error = %v", err)
+	}
+	file, err := os.Open(OverrideLogPath())
+	if err != nil {
+		t.Fatalf("override log not written: %v", err)
+	}
+	defer file.Close()
+
+	info, _ := file.Stat()
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("override log mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		t.Fatal("override log is empty")
+	}
+	var event OverrideEvent
+	if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+		t.Fatalf("invalid override log line: %v", err)
+	}
+	if event.Rule != "mv" || event.Action != OverrideDisable || event.From != RiskMedium || event.Scope != "global" || event.User == "" || event.Timestamp == "" {
+		t.Errorf("event = %+v", event)
+	}
+}
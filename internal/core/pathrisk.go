@@ -0,0 +1,478 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// DefaultMaxTargets is how many files a destructive command may affect
+// before it is high risk, unless safety.max_targets says otherwise
+const DefaultMaxTargets = 100
+
+// countBudget and countLimit bound the work spent counting the files under
+// a command's targets, for all of them together; counts that hit either are
+// lower bounds
+const (
+	countBudget = 200 * time.Millisecond
+	countLimit  = 10000
+)
+
+// systemParents are directories whose direct children are system directories
+var systemParents = []string{"/usr", "/var", "/etc", "/boot", "/lib", "/System", "/Library"}
+
+// isSystemPath reports whether the absolute path p is below one of the
+// systemParents, however deep
+func isSystemPath(p string) bool {
+	p = filepath.Clean(p)
+	for _, parent := range systemParents {
+		if p != parent && isWithin(p, parent) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathContext resolves the paths in a command line against the directory
+// it runs in. Resolution is read-only: globs are expanded and directories
+// walked, nothing is created or changed.
+type pathContext struct {
+	ctx        context.Context
+	cwd        string // empty once a cd to an unknown directory is seen
+	home       string
+	repoRoot   string // root of the git repository containing the working directory
+	maxTargets int
+	// counting is set when the files under the targets are counted, until
+	// deadline
+	counting bool
+	deadline time.Time
+}
+
+// newPathContext creates a path context for commands run in cwd, or returns
+// nil when cwd is unknown. Affected files are only counted with count.
+func newPathContext(ctx context.Context, cwd string, maxTargets int, count bool) *pathContext {
+	if cwd == "" || !filepath.IsAbs(cwd) {
+		return nil
+	}
+	if maxTargets <= 0 {
+		maxTargets = DefaultMaxTargets
+	}
+	home, _ := os.UserHomeDir()
+	cwd = filepath.Clean(cwd)
+	p := &pathContext{ctx: ctx, cwd: cwd, home: home, repoRoot: findRepoRoot(cwd), maxTargets: maxTargets, counting: count}
+	if count {
+		p.deadline = time.Now().Add(countBudget)
+	}
+	return p
+}
+
+// targetOp describes the paths a destructive command operates on
+type targetOp struct {
+	verb      string // what the command does to its targets, e.g. "recursively deletes"
+	words     []shellWord
+	recursive bool      // whether everything under a target directory is affected
+	outside   RiskLevel // severity when a target is outside the repository
+	reported  bool      // a critical target was already reported by a syntactic rule
+	// count overrides how affected files are counted, e.g. untracked files
+	// for git clean
+	count func() int
+}
+
+// checkTargets resolves the targets of the command just classified and
+// escalates when one is a home or system directory, lies outside the
+// repository, or, when counting, more than maxTargets files are affected.
+// The number of files is recorded on the command's finding only.
+func (a *riskAnalyzer) checkTargets(node syntax.Node, op targetOp) {
+	if a.paths == nil || len(a.hits) == 0 {
+		return
+	}
+	p := a.paths
+	base := len(a.hits) - 1
+
+	var (
+		targets   []string
+		protected string
+		outside   string
+	)
+	for _, word := range op.words {
+		resolved, ok := p.resolve(word)
+		if !ok {
+			continue
+		}
+		targets = append(targets, resolved...)
+
+		// "dir/*" targets everything in dir
+		candidates := resolved
+		if word.glob && strings.HasSuffix(word.value, "/*") {
+			if dir, ok := p.resolve(shellWord{value: strings.TrimSuffix(word.value, "/*"), static: word.static}); ok {
+				candidates = append(candidates, dir...)
+			}
+		}
+		for _, path := range candidates {
+			if kind := p.protectedKind(path); kind != "" && protected == "" {
+				protected = p.display(path) + " (" + kind + ")"
+			}
+			if outside == "" && !p.insideRepo(path) {
+				outside = p.display(path)
+			}
+		}
+	}
+
+	var count int
+	switch {
+	case !p.counting:
+	case op.count != nil:
+		count = op.count()
+	default:
+		count = p.count(targets, op.recursive)
+	}
+	a.hits[base].targets = count
+
+	if protected != "" && !op.reported {
+		a.hit(node, "target-protected", RiskHigh, op.verb+" "+protected)
+	}
+	if outside != "" {
+		a.hit(node, "target-outside-repo", op.outside, fmt.Sprintf("%s %s, outside the repository %s", op.verb, outside, p.display(p.repoRoot)))
+	}
+	if count > p.maxTargets {
+		a.hit(node, "target-count", RiskHigh, fmt.Sprintf("%s %s files, more than %d", op.verb, formatCount(count), p.maxTargets))
+	}
+}
+
+// checkRsync flags --delete, which removes files from the destination
+func (a *riskAnalyzer) checkRsync(args []shellWord, node syntax.Node) {
+	deletes := false
+	for _, arg := range args {
+		if arg.value == "--del" || strings.HasPrefix(arg.value, "--delete") {
+			deletes = true
+		}
+	}
+	if !deletes || hasShortFlag(args, 'n') || hasArg(args, "--dry-run") {
+		return
+	}
+
+	a.hit(node, "rsync-delete", RiskMedium, "deletes files in the destination that aren't in the source")
+	operands := positional(args)
+	if len(operands) < 2 {
+		return
+	}
+	dest := operands[len(operands)-1]
+	if isRemotePath(dest.value) {
+		return
+	}
+	a.checkTargets(node, targetOp{verb: "may delete files in", words: []shellWord{dest}, recursive: true, outside: RiskHigh})
+}
+
+// checkGit classifies git clean, which deletes untracked files
+func (a *riskAnalyzer) checkGit(args []shellWord, node syntax.Node) {
+	// Skip global options; -C changes the directory git runs in
+	dir, dirKnown := shellWord{}, false
+	for len(args) > 0 && strings.HasPrefix(args[0].value, "-") {
+		switch args[0].value {
+		case "-C":
+			if len(args) > 1 {
+				dir, dirKnown = args[1], true
+			}
+			args = args[1:]
+		case "-c", "--git-dir", "--work-tree", "--namespace", "--exec-path":
+			args = args[1:]
+		}
+		if len(args) > 0 {
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 || args[0].value != "clean" {
+		return
+	}
+	args = args[1:]
+
+	interactive := hasShortFlag(args, 'i') || hasArg(args, "--interactive")
+	force := hasShortFlag(args, 'f') || hasArg(args, "--force")
+	if hasShortFlag(args, 'n') || hasArg(args, "--dry-run") || !force && !interactive {
+		return
+	}
+
+	ignored, onlyIgnored := hasShortFlag(args, 'x'), hasShortFlag(args, 'X')
+	switch {
+	case onlyIgnored:
+		a.hit(node, "git-clean", RiskMedium, "deletes ignored files")
+	case ignored:
+		a.hit(node, "git-clean", RiskMedium, "deletes untracked and ignored files, such as build output and .env files")
+	default:
+		a.hit(node, "git-clean", RiskMedium, "deletes untracked files")
+	}
+
+	if a.paths == nil {
+		return
+	}
+	p := *a.paths
+	if dirKnown {
+		resolved, ok := p.resolve(dir)
+		if !ok || len(resolved) != 1 {
+			return
+		}
+		p.cwd = resolved[0]
+	}
+
+	pathspecs := positional(args)
+	if len(pathspecs) == 0 {
+		pathspecs = []shellWord{{value: ".", static: true}}
+	}
+	count := func() int { return p.countUntracked(pathspecs, ignored, onlyIgnored) }
+
+	saved := a.paths
+	a.paths = &p
+	a.checkTargets(node, targetOp{verb: "deletes files under", words: pathspecs, recursive: true, outside: RiskHigh, count: count})
+	a.paths = saved
+}
+
+// findStartingPoints returns the paths find searches, which come before the
+// first expression, or "." when there are none
+func findStartingPoints(args []shellWord) []shellWord {
+	var points []shellWord
+	for _, arg := range args {
+		if strings.HasPrefix(arg.value, "-") || arg.value == "(" || arg.value == "!" {
+			break
+		}
+		points = append(points, arg)
+	}
+	if len(points) == 0 {
+		points = []shellWord{{value: ".", static: true}}
+	}
+	return points
+}
+
+// chdir follows a cd in the command line, so later relative paths resolve
+// against the new directory
+func (p *pathContext) chdir(operands []shellWord) {
+	if len(operands) == 0 {
+		p.cwd = p.home
+		return
+	}
+	resolved, ok := p.resolve(operands[0])
+	if !ok || len(resolved) != 1 {
+		p.cwd = ""
+		return
+	}
+	p.cwd = resolved[0]
+}
+
+// resolve turns a word into absolute paths: ~ and $HOME are expanded,
+// relative paths are joined to the working directory and unquoted globs
+// are expanded. ok is false when the word depends on other run-time state.
+func (p *pathContext) resolve(word shellWord) ([]string, bool) {
+	value := word.value
+	var home bool
+	switch {
+	case value == "~" || strings.HasPrefix(value, "~/"):
+		value, home = value[1:], true
+	case value == "$HOME" || strings.HasPrefix(value, "$HOME/"):
+		value, home = value[len("$HOME"):], true
+	case !word.static:
+		return nil, false
+	}
+	if home {
+		// Anything else unknown, like $HOME/$DIR, can't be resolved
+		if p.home == "" || !word.static && strings.Contains(value, "$") {
+			return nil, false
+		}
+		value = p.home + value
+	}
+
+	if !filepath.IsAbs(value) {
+		if p.cwd == "" {
+			return nil, false
+		}
+		value = filepath.Join(p.cwd, value)
+	}
+	value = filepath.Clean(value)
+
+	if !word.glob {
+		return []string{value}, true
+	}
+	matches, err := filepath.Glob(value)
+	if err != nil {
+		return nil, false
+	}
+
+	// The shell doesn't match hidden files unless the pattern starts with a dot
+	showHidden := strings.HasPrefix(filepath.Base(value), ".")
+	var visible []string
+	for _, match := range matches {
+		if showHidden || !strings.HasPrefix(filepath.Base(match), ".") {
+			visible = append(visible, match)
+		}
+	}
+	return visible, true
+}
+
+// count returns the number of files and directories in paths, including
+// everything under directories when recursive. Counting stops at countLimit
+// or at the deadline.
+func (p *pathContext) count(paths []string, recursive bool) int {
+	limit := max(countLimit, p.maxTargets+1)
+	deadline := p.deadline
+	seen := make(map[string]bool)
+
+	n := 0
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if !recursive || !info.IsDir() {
+			n++
+		} else {
+			_ = filepath.WalkDir(path, func(_ string, _ fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				n++
+				if n >= limit || time.Now().After(deadline) || p.ctx.Err() != nil {
+					return fs.SkipAll
+				}
+				return nil
+			})
+		}
+		if n >= limit || time.Now().After(deadline) {
+			break
+		}
+	}
+	return n
+}
+
+// formatCount formats a file count, marking counts that hit countLimit as
+// lower bounds
+func formatCount(n int) string {
+	if n >= countLimit {
+		return fmt.Sprintf("at least %d", n)
+	}
+	return fmt.Sprint(n)
+}
+
+// countUntracked asks git how many files git clean would consider under
+// pathspecs
+func (p *pathContext) countUntracked(pathspecs []shellWord, ignored, onlyIgnored bool) int {
+	ctx, cancel := context.WithDeadline(p.ctx, p.deadline)
+	defer cancel()
+
+	args := []string{"-C", p.cwd, "ls-files", "-z", "--others"}
+	switch {
+	case onlyIgnored:
+		args = append(args, "--ignored", "--exclude-standard")
+	case !ignored:
+		args = append(args, "--exclude-standard")
+	}
+	args = append(args, "--")
+	for _, spec := range pathspecs {
+		if !spec.static {
+			return 0
+		}
+		args = append(args, spec.value)
+	}
+
+	out, err := exec.CommandContext(ctx, "git", args...).Output()
+	if err != nil {
+		return 0
+	}
+	return bytes.Count(out, []byte{0})
+}
+
+// protectedKind describes path when it is the root, home or a system
+// directory, or a parent of the home directory
+func (p *pathContext) protectedKind(path string) string {
+	switch {
+	case path == "/":
+		return "the root directory"
+	case p.home != "" && path == p.home:
+		return "the home directory"
+	case p.home != "" && strings.HasPrefix(p.home, path+"/"):
+		return "contains the home directory"
+	case strings.Count(path, "/") == 1:
+		return "a system directory"
+	}
+	for _, parent := range systemParents {
+		if filepath.Dir(path) == parent {
+			return "a system directory"
+		}
+	}
+	return ""
+}
+
+// insideRepo reports whether path is inside the repository, or there is no
+// repository to be outside of. Temporary directories always count as inside.
+func (p *pathContext) insideRepo(path string) bool {
+	if p.repoRoot == "" || isWithin(path, p.repoRoot) {
+		return true
+	}
+	for _, tmp := range []string{os.TempDir(), "/tmp", "/var/tmp"} {
+		if path != tmp && isWithin(path, tmp) {
+			return true
+		}
+	}
+	return false
+}
+
+// display shortens paths in the home directory to ~/...
+func (p *pathContext) display(path string) string {
+	if p.home != "" && (path == p.home || strings.HasPrefix(path, p.home+"/")) {
+		return "~" + path[len(p.home):]
+	}
+	return path
+}
+
+// findRepoRoot returns the root of the git repository containing dir, or
+// empty when there is none
+func findRepoRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// isWithin reports whether path is root or inside it
+func isWithin(path, root string) bool {
+	return path == root || root == "/" || strings.HasPrefix(path, root+"/")
+}
+
+// isRemotePath reports whether an rsync operand names another host, like
+// host:dir or rsync://host/dir
+func isRemotePath(p string) bool {
+	if strings.Contains(p, "://") {
+		return true
+	}
+	colon := strings.IndexByte(p, ':')
+	return colon > 0 && !strings.Contains(p[:colon], "/")
+}
+
+// hasGlobChars reports whether a literal has unescaped *, ? or [
+func hasGlobChars(lit string) bool {
+	for i := 0; i < len(lit); i++ {
+		switch lit[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
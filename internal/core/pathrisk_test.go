@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuiltinClassifier_Targets(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	// A repository with 3 files in build/, and 150 ignored ones in many/
+	repo := t.TempDir()
+	writeFiles := func(dir string, n int) {
+		if err := os.MkdirAll(filepath.Join(repo, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			if err := os.WriteFile(filepath.Join(repo, dir, fmt.Sprintf("f%d.txt", i)), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeFiles("build", 3)
+	writeFiles("many", 150)
+	if err := os.WriteFile(filepath.Join(repo, ".gitignore"), []byte("many/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hasGit := exec.Command("git", "init", "-q", repo).Run() == nil
+	if !hasGit {
+		if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		command     string
+		maxTargets  int
+		needsGit    bool
+		want        RiskLevel
+		wantRule    string
+		wantTargets int // -1 when the count depends on the machine
+	}{
+		{"recursive delete in repo", "rm -rf build", 0, false, RiskMedium, "rm", 4},
+		{"too many files", "rm -rf many", 0, false, RiskHigh, "target-count", 151},
+		{"max_targets raised", "rm -rf many", 1000, false, RiskMedium, "rm", 151},
+		{"glob", "rm many/*.txt", 0, false, RiskHigh, "target-count", 150},
+		{"glob without matches", "rm build/*.o", 0, false, RiskMedium, "rm", 0},
+		{"quoted glob", `rm "many/*.txt"`, 0, false, RiskMedium, "rm", 0},
+		{"tilde", "rm -rf ~", 0, false, RiskHigh, "rm-recursive-root", 1},
+		{"quoted $HOME", `rm -rf "$HOME"`, 0, false, RiskHigh, "rm-recursive-root", 1},
+		{"parent of home", `rm -rf "$HOME/.."`, 0, false, RiskHigh, "target-protected", -1},
+		{"cd to a system directory", "cd / && rm -rf usr", 0, false, RiskHigh, "target-protected", -1},
+		{"cd to an unknown directory", "cd $DIR && rm -rf usr", 0, false, RiskMedium, "rm", 0},
+		{"system directory contents", "rm -rf /usr/local/*", 0, false, RiskHigh, "target-protected", -1},
+		{"recursive delete outside repo", "rm -r /opt/linesense-missing/x", 0, false, RiskHigh, "target-outside-repo", 0},
+		{"delete outside repo", "rm /opt/linesense-missing/x", 0, false, RiskMedium, "target-outside-repo", 0},
+		{"mv outside repo", "mv build /opt/linesense-missing", 0, false, RiskMedium, "target-outside-repo", 4},
+		{"chmod -R", "chmod -R 755 many", 0, false, RiskHigh, "target-count", 151},
+		{"chmod mode isn't a target", "chmod -R 755 build", 0, false, RiskMedium, "chmod", 4},
+		{"find -delete", "find many -name '*.txt' -delete", 0, false, RiskHigh, "target-count", 151},
+		{"rsync --delete", "rsync -a --delete build/ many/", 0, false, RiskHigh, "target-count", 151},
+		{"rsync dry run", "rsync -an --delete build/ many/", 0, false, RiskLow, "", 0},
+		{"rsync to a remote host", "rsync -a --delete build/ host:/srv", 0, false, RiskMedium, "rsync-delete", 0},
+		{"git clean", "git clean -fd", 0, true, RiskMedium, "git-clean", 4},
+		{"git clean -x", "git clean -fdx", 0, true, RiskHigh, "target-count", 154},
+		{"git clean dry run", "git clean -nd", 0, false, RiskLow, "", 0},
+		{"git clean without -f", "git clean -d", 0, false, RiskLow, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.needsGit && !hasGit {
+				t.Skip("git is not installed")
+			}
+
+			findings := BuiltinClassifier{MaxTargets: tt.maxTargets}.Classify(context.Background(), RiskInput{Command: tt.command, CWD: repo, CountTargets: true})
+			if risk := MaxSeverity(findings); risk != tt.want {
+				t.Errorf("risk = %v, want %v (findings %+v)", risk, tt.want, findings)
+			}
+			if tt.wantRule == "" {
+				return
+			}
+
+			// The count is reported once, on the command's own finding
+			found, counted := false, 0
+			for _, finding := range findings {
+				found = found || finding.Rule == tt.wantRule
+				if finding.Targets != 0 {
+					counted++
+					if tt.wantTargets >= 0 && finding.Targets != tt.wantTargets {
+						t.Errorf("%s targets = %d, want %d", finding.Rule, finding.Targets, tt.wantTargets)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("findings = %+v, want a %s finding", findings, tt.wantRule)
+			}
+			if counted > 1 {
+				t.Errorf("findings = %+v, want the targets on one finding", findings)
+			}
+		})
+	}
+
+	// Without CountTargets, targets are resolved but not counted
+	findings := BuiltinClassifier{}.Classify(context.Background(), RiskInput{Command: "rm -rf many", CWD: repo})
+	if len(findings) != 1 || findings[0].Rule != "rm" || findings[0].Targets != 0 {
+		t.Errorf("findings = %+v, want one rm finding without targets", findings)
+	}
+}
+
+func TestBuiltinClassifier_NoCWD(t *testing.T) {
+	findings := BuiltinClassifier{}.Classify(context.Background(), RiskInput{Command: "rm -rf build"})
+	if len(findings) != 1 || findings[0].Rule != "rm" || findings[0].Targets != 0 {
+		t.Errorf("findings = %+v, want one rm finding without targets", findings)
+	}
+}
+
+func TestMatchPatterns_Home(t *testing.T) {
+	// Unparseable, so the regular expressions apply
+	for _, command := range []string{"rm -rf ~ (", `rm -rf "$HOME" (`, "rm -fr ${HOME}/ ("} {
+		if risk := MaxSeverity(matchPatterns(command)); risk != RiskHigh {
+			t.Errorf("matchPatterns(%q) = %v, want high", command, risk)
+		}
+	}
+}
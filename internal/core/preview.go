@@ -0,0 +1,338 @@
+package core
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/traves/linesense/internal/config"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// previewer rewrites a command into its tool's dry run through p, and
+// reports whether it could
+type previewer func(p *preview) bool
+
+// previewers is the dry-run knowledge base, keyed by command name
+var previewers = map[string]previewer{
+	"rsync":            previewRsync,
+	"git":              previewGit,
+	"terraform":        previewTerraform,
+	"tofu":             previewTerraform,
+	"kubectl":          previewKubectl,
+	"helm":             previewHelm,
+	"apt-get":          previewApt,
+	"apt":              previewApt,
+	"make":             previewMake,
+	"find":             previewFind,
+	"ansible-playbook": previewAnsible,
+}
+
+// preview is a command being rewritten. words are the command's words
+// after wrappers such as sudo, and args their resolved values.
+type preview struct {
+	src   string
+	words []*syntax.Word
+	args  []shellWord
+	edits []previewEdit
+}
+
+// previewEdit replaces src[start:end] with text
+type previewEdit struct {
+	start, end int
+	text       string
+}
+
+// PreviewCommand returns a variant of command that uses the tool's own
+// dry-run mode to show what it would do without doing it, such as
+// `rsync -n` or `terraform plan`. It returns "" when command isn't a single
+// call to a tool in the knowledge base, or is already a dry run.
+func PreviewCommand(command string) string {
+	words, args, ok := singleCall(command)
+	if !ok {
+		return ""
+	}
+	rewrite, ok := previewers[path.Base(args[0].value)]
+	if !ok {
+		return ""
+	}
+	p := &preview{src: command, words: words, args: args}
+	if !rewrite(p) || len(p.edits) == 0 {
+		return ""
+	}
+	return p.apply()
+}
+
+// singleCall parses command as a single simple command and returns its words
+// after wrappers such as sudo, with their resolved values. ok is false for
+// anything else, such as pipelines, lists or a command name only known at
+// run time.
+func singleCall(command string) ([]*syntax.Word, []shellWord, bool) {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(command), "")
+	if err != nil || len(file.Stmts) != 1 {
+		return nil, nil, false
+	}
+	stmt := file.Stmts[0]
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok || stmt.Background || stmt.Negated || len(call.Args) == 0 {
+		return nil, nil, false
+	}
+
+	a := &riskAnalyzer{vars: make(map[string]string)}
+	args := make([]shellWord, len(call.Args))
+	for i, word := range call.Args {
+		args[i] = a.resolveWord(word)
+	}
+	rest, _ := unwrapCommand(args)
+	if len(rest) == 0 || !rest[0].static {
+		return nil, nil, false
+	}
+	return call.Args[len(args)-len(rest):], rest, true
+}
+
+// PreviewFor returns the dry run offered alongside a medium- or high-risk
+// suggestion, or "" for low risk or when the dry run is denylisted
+func PreviewFor(suggestion Suggestion, cfg *config.SafetyConfig) string {
+	if suggestion.Risk == RiskLow {
+		return ""
+	}
+	preview := PreviewCommand(suggestion.Command)
+	if preview == "" || IsBlocked(preview, cfg) {
+		return ""
+	}
+	return preview
+}
+
+// apply returns src with the edits made, last first so that earlier offsets
+// stay valid
+func (p *preview) apply() string {
+	sort.SliceStable(p.edits, func(i, j int) bool { return p.edits[i].start > p.edits[j].start })
+	out := p.src
+	for _, edit := range p.edits {
+		out = out[:edit.start] + edit.text + out[edit.end:]
+	}
+	return out
+}
+
+// insertAfter adds text as a new word after word i
+func (p *preview) insertAfter(i int, text string) {
+	end := int(p.words[i].End().Offset())
+	p.edits = append(p.edits, previewEdit{start: end, end: end, text: " " + text})
+}
+
+// appendOption adds text as an option at the end of the command, or before
+// a -- that ends its options
+func (p *preview) appendOption(text string) {
+	for i, arg := range p.args {
+		if arg.value == "--" && i > 0 {
+			p.insertAfter(i-1, text)
+			return
+		}
+	}
+	p.insertAfter(len(p.words)-1, text)
+}
+
+// replace replaces word i with text
+func (p *preview) replace(i int, text string) {
+	p.edits = append(p.edits, previewEdit{start: int(p.words[i].Pos().Offset()), end: int(p.words[i].End().Offset()), text: text})
+}
+
+// remove drops word i and the blanks before it
+func (p *preview) remove(i int) {
+	start, end := int(p.words[i].Pos().Offset()), int(p.words[i].End().Offset())
+	for start > 0 && (p.src[start-1] == ' ' || p.src[start-1] == '\t') {
+		start--
+	}
+	p.edits = append(p.edits, previewEdit{start: start, end: end})
+}
+
+// subcommandIndex returns the index of the first argument after the command
+// name that isn't an option or the value of one in valueFlags, or -1
+func subcommandIndex(args []shellWord, valueFlags map[string]bool) int {
+	for i := 1; i < len(args); i++ {
+		arg := args[i].value
+		switch {
+		case arg == "--":
+			return -1
+		case valueFlags[arg]:
+			i++
+		case !strings.HasPrefix(arg, "-"):
+			return i
+		}
+	}
+	return -1
+}
+
+// has reports whether any argument equals one of values
+func (p *preview) has(values ...string) bool {
+	for _, value := range values {
+		if hasArg(p.args, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// previewRsync adds -n (--dry-run)
+func previewRsync(p *preview) bool {
+	if hasShortFlag(p.args[1:], 'n') || p.has("--dry-run") {
+		return false
+	}
+	p.insertAfter(0, "-n")
+	return true
+}
+
+// previewGit adds -n to git clean and --dry-run to git push and git rm
+func previewGit(p *preview) bool {
+	sub := subcommandIndex(p.args, gitValueFlags)
+	if sub < 0 {
+		return false
+	}
+	options := p.args[sub+1:]
+	dryRun := hasShortFlag(options, 'n') || hasArg(options, "--dry-run")
+
+	switch p.args[sub].value {
+	case "clean":
+		if dryRun {
+			return false
+		}
+		p.insertAfter(sub, "-n")
+	case "push", "rm":
+		if dryRun {
+			return false
+		}
+		p.insertAfter(sub, "--dry-run")
+	default:
+		return false
+	}
+	return true
+}
+
+// gitValueFlags are git's global options that take their value as the next
+// argument
+var gitValueFlags = map[string]bool{"-C": true, "-c": true, "--git-dir": true, "--work-tree": true}
+
+// terraformValueFlags are the options of apply and destroy that may take
+// their value as the next argument
+var terraformValueFlags = map[string]bool{
+	"-var": true, "-var-file": true, "-target": true, "-replace": true, "-parallelism": true,
+	"-lock-timeout": true, "-state": true, "-state-out": true, "-backup": true,
+}
+
+// previewTerraform turns apply into plan, destroy into plan -destroy, and
+// applying a saved plan into showing it
+func previewTerraform(p *preview) bool {
+	sub := subcommandIndex(p.args, nil)
+	if sub < 0 {
+		return false
+	}
+
+	switch p.args[sub].value {
+	case "apply":
+		if len(operandsAfterFlags(p.args[sub+1:], terraformValueFlags)) > 0 {
+			// A saved plan: options of apply don't apply to show
+			p.replace(sub, "show")
+			for i := sub + 1; i < len(p.args); i++ {
+				if !strings.HasPrefix(p.args[i].value, "-") {
+					continue
+				}
+				p.remove(i)
+				if terraformValueFlags[p.args[i].value] && i+1 < len(p.args) {
+					i++
+					p.remove(i)
+				}
+			}
+			return true
+		}
+		p.replace(sub, "plan")
+	case "destroy":
+		p.replace(sub, "plan -destroy")
+	default:
+		return false
+	}
+
+	for i := sub + 1; i < len(p.args); i++ {
+		switch p.args[i].value {
+		case "-auto-approve", "--auto-approve", "-auto-approve=true", "--auto-approve=true":
+			p.remove(i)
+		}
+	}
+	return true
+}
+
+// kubectlDryRunVerbs are the kubectl commands that take --dry-run
+var kubectlDryRunVerbs = map[string]bool{
+	"apply": true, "create": true, "delete": true, "replace": true, "patch": true, "scale": true,
+	"label": true, "annotate": true, "set": true, "expose": true, "run": true, "autoscale": true,
+	"drain": true, "cordon": true, "uncordon": true, "taint": true,
+}
+
+// previewKubectl adds --dry-run=server, which the API server validates
+// without persisting anything
+func previewKubectl(p *preview) bool {
+	sub := subcommandIndex(p.args, kubectlValueFlags)
+	if sub < 0 || !kubectlDryRunVerbs[p.args[sub].value] || isDryRun(p.args) {
+		return false
+	}
+	p.appendOption("--dry-run=server")
+	return true
+}
+
+// previewHelm adds --dry-run to commands that change a release
+func previewHelm(p *preview) bool {
+	sub := subcommandIndex(p.args, map[string]bool{"-n": true, "--namespace": true, "--kube-context": true, "--kubeconfig": true})
+	if sub < 0 || isDryRun(p.args) {
+		return false
+	}
+	switch p.args[sub].value {
+	case "install", "upgrade", "uninstall", "delete", "del", "un", "rollback":
+		p.appendOption("--dry-run")
+		return true
+	}
+	return false
+}
+
+// previewApt adds -s (--simulate) to commands that install or remove
+// packages
+func previewApt(p *preview) bool {
+	sub := subcommandIndex(p.args, map[string]bool{"-o": true, "-c": true, "-t": true})
+	if sub < 0 || hasShortFlag(p.args[1:], 's') || p.has("--simulate", "--dry-run", "--just-print", "--no-act", "--recon") {
+		return false
+	}
+	switch p.args[sub].value {
+	case "install", "reinstall", "remove", "purge", "upgrade", "dist-upgrade", "full-upgrade", "autoremove", "autopurge":
+		p.insertAfter(0, "-s")
+		return true
+	}
+	return false
+}
+
+// previewMake adds -n, which prints the recipes instead of running them
+func previewMake(p *preview) bool {
+	if hasShortFlag(p.args[1:], 'n') || p.has("--dry-run", "--just-print", "--recon") {
+		return false
+	}
+	p.insertAfter(0, "-n")
+	return true
+}
+
+// previewFind drops -delete, so that find lists what it would delete
+func previewFind(p *preview) bool {
+	found := false
+	for i, arg := range p.args {
+		if i > 0 && arg.value == "-delete" {
+			p.remove(i)
+			found = true
+		}
+	}
+	return found
+}
+
+// previewAnsible adds --check, which reports what would change
+func previewAnsible(p *preview) bool {
+	if p.has("--check", "-C") {
+		return false
+	}
+	p.appendOption("--check")
+	return true
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+func TestPreviewCommand(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"rsync -av --delete src/ host:/srv/app/", "rsync -n -av --delete src/ host:/srv/app/"},
+		{"rsync -avn src/ dest/", ""},
+		{"git clean -fdx", "git clean -n -fdx"},
+		{"git -C repo clean -fd", "git -C repo clean -n -fd"},
+		{"git push --force origin main", "git push --dry-run --force origin main"},
+		{"git rm -r --cached build", "git rm --dry-run -r --cached build"},
+		{"git status", ""},
+		{"terraform apply -auto-approve", "terraform plan"},
+		{"terraform -chdir=infra apply -var 'env=prod' -auto-approve", "terraform -chdir=infra plan -var 'env=prod'"},
+		{"terraform apply -auto-approve tfplan", "terraform show tfplan"},
+		{"tofu destroy -target=aws_instance.web", "tofu plan -destroy -target=aws_instance.web"},
+		{"terraform plan", ""},
+		{"kubectl delete pod web-1", "kubectl delete pod web-1 --dry-run=server"},
+		{"kubectl -n web apply -f app.yaml", "kubectl -n web apply -f app.yaml --dry-run=server"},
+		{"kubectl run debug --image=busybox -- sleep 3600", "kubectl run debug --image=busybox --dry-run=server -- sleep 3600"},
+		{"kubectl apply --dry-run=client -f app.yaml", ""},
+		{"kubectl get pods", ""},
+		{"helm upgrade web ./chart", "helm upgrade web ./chart --dry-run"},
+		{"sudo apt-get install -y nginx", "sudo apt-get -s install -y nginx"},
+		{"apt remove nginx", "apt -s remove nginx"},
+		{"apt-get update", ""},
+		{"make install", "make -n install"},
+		{"make -n install", ""},
+		{`find . -name "*.tmp" -delete`, `find . -name "*.tmp"`},
+		{"find . -name '*.tmp'", ""},
+		{"ansible-playbook site.yml", "ansible-playbook site.yml --check"},
+		{"rm -rf build", ""},
+		{"make install && make clean", ""},
+		{"make install &", ""},
+		{"not valid (", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := PreviewCommand(tt.command); got != tt.want {
+				t.Errorf("PreviewCommand(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviewFor(t *testing.T) {
+	cfg := &config.SafetyConfig{Denylist: []string{`helm .*--dry-run`}}
+
+	tests := []struct {
+		name       string
+		suggestion Suggestion
+		want       string
+	}{
+		{"medium risk", Suggestion{Command: "git clean -fd", Risk: RiskMedium}, "git clean -n -fd"},
+		{"low risk", Suggestion{Command: "make install", Risk: RiskLow}, ""},
+		{"denylisted preview", Suggestion{Command: "helm upgrade web ./chart", Risk: RiskHigh}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PreviewFor(tt.suggestion, cfg); got != tt.want {
+				t.Errorf("PreviewFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pluginTimeout bounds how long a risk plugin may take for one command
+const pluginTimeout = 2 * time.Second
+
+// pluginRequest is written to a risk plugin's stdin
+type pluginRequest struct {
+	Command     string    `json:"command"`
+	CWD         string    `json:"cwd,omitempty"`
+	ModelRisk   RiskLevel `json:"model_risk,omitempty"`
+	KubeContext string    `json:"kube_context,omitempty"`
+	AWSProfile  string    `json:"aws_profile,omitempty"`
+	GitBranch   string    `json:"git_branch,omitempty"`
+	Hostname    string    `json:"hostname,omitempty"`
+}
+
+// pluginResponse is read from a risk plugin's stdout
+type pluginResponse struct {
+	Findings []Finding `json:"findings"`
+}
+
+// PluginClassifier runs an external program to classify commands. The
+// program gets {"command", "cwd", "model_risk", "kube_context", "aws_profile",
+// "git_branch", "hostname"} as JSON on stdin and prints
+// {"findings": [{"rule", "span", "severity", "reason"}]} on stdout. A plugin
+// that fails, times out or prints invalid JSON is reported as a medium-risk
+// finding rather than ignored.
+type PluginClassifier struct {
+	path string
+	name string
+}
+
+// NewPluginClassifier creates a classifier for the plugin at path ("~/" is
+// expanded)
+func NewPluginClassifier(path string) *PluginClassifier {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	return &PluginClassifier{path: path, name: filepath.Base(path)}
+}
+
+// Name returns the plugin's file name
+func (p *PluginClassifier) Name() string { return p.name }
+
+// Classify runs the plugin for input. Rule IDs are prefixed with the plugin
+// name and the source is always "plugin".
+func (p *PluginClassifier) Classify(ctx context.Context, input RiskInput) []Finding {
+	findings, err := p.run(ctx, input)
+	if err != nil {
+		return []Finding{{
+			Rule:     p.name + ":plugin-error",
+			Span:     Span{0, len(input.Command)},
+			Source:   SourcePlugin,
+			Severity: RiskMedium,
+			Reason:   fmt.Sprintf("risk plugin %s failed: %v", p.name, err),
+		}}
+	}
+
+	var valid []Finding
+	for _, finding := range findings {
+		if finding.Severity != RiskMedium && finding.Severity != RiskHigh {
+			continue
+		}
+		if finding.Span.Start < 0 || finding.Span.End > len(input.Command) || finding.Span.Start > finding.Span.End {
+			finding.Span = Span{0, len(input.Command)}
+		}
+		if finding.Reason == "" {
+			finding.Reason = "flagged by risk plugin " + p.name
+		}
+		finding.Rule = p.name + ":" + finding.Rule
+		finding.Source = SourcePlugin
+		valid = append(valid, finding)
+	}
+	return valid
+}
+
+// run executes the plugin and decodes its findings
+func (p *PluginClassifier) run(ctx context.Context, input RiskInput) ([]Finding, error) {
+	ctx, cancel := context.WithTimeout(ctx, pluginTimeout)
+	defer cancel()
+
+	request, err := json.Marshal(pluginRequest{
+		Command:     input.Command,
+		CWD:         input.CWD,
+		ModelRisk:   input.ModelRisk,
+		KubeContext: input.KubeContext,
+		AWSProfile:  input.AWSProfile,
+		GitBranch:   input.GitBranch,
+		Hostname:    input.Hostname,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("timed out after %s", pluginTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	var response pluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return nil, fmt.Errorf("invalid output: %w", err)
+	}
+	return response.Findings, nil
+}
@@ -1,7 +1,10 @@
 package core
 
 import (
+	"context"
+	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/traves/linesense/internal/config"
@@ -16,40 +19,75 @@ const (
 	RiskHigh   RiskLevel = "high"
 )
 
-// Built-in high-risk patterns (always checked)
-var builtinHighRiskPatterns = []string{
-	`rm\s+-rf\s+/`,     // rm -rf /
-	`dd\s+if=`,         // dd commands
-	`mkfs`,             // filesystem formatting
-	`>\s*/dev/`,        // writing to device files
-	`chmod\s+777`,      // overly permissive permissions
-	`chmod\s+-R\s+777`, // recursive 777
-	`curl.*\|\s*bash`,  // curl to bash
-	`wget.*\|\s*sh`,    // wget to shell
-	`:\(\)\{.*\};:`,    // fork bomb (escaped parens and braces)
-	`killall\s+-9`,     // force kill all
-}
-
-// Built-in medium-risk patterns
-var builtinMediumRiskPatterns = []string{
-	`sudo`,             // elevated privileges
-	`rm\s+`,            // file removal
-	`mv\s+`,            // file move
-	`chmod`,            // permission changes
-	`chown`,            // ownership changes
-	`kill`,             // process termination
-	`pkill`,            // process killing
-	`systemctl`,        // system service management
-	`reboot`,           // system reboot
-	`shutdown`,         // system shutdown
-	`iptables`,         // firewall changes
-	`apt-get\s+remove`, // package removal
-	`yum\s+remove`,     // package removal
+// Sources of the rules behind a finding
+const (
+	SourceBuiltin = "builtin" // rules shipped with linesense
+	SourceConfig  = "config"  // safety.require_confirm_patterns
+	SourceProject = "project" // safety.projects.<root>.require_confirm_patterns
+	SourceModel   = "model"   // the risk the model reported in an explanation
+	SourcePlugin  = "plugin"  // safety.risk_plugins
+)
+
+// Span is a byte range [Start, End) of a command line
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Finding explains one reason a command was classified above low risk
+type Finding struct {
+	Rule     string    `json:"rule"` // e.g. "rm-recursive-root" or "confirm:terraform apply"
+	Span     Span      `json:"span"` // the part of the command the rule matched
+	Source   string    `json:"source"`
+	Severity RiskLevel `json:"severity"`
+	Reason   string    `json:"reason"`
+	Targets  int       `json:"targets,omitempty"`  // files the command affects, when its paths could be resolved
+	Override string    `json:"override,omitempty"` // set when a rule override lowered Severity
+}
+
+// patternRule is a regular expression rule for commands that can't be parsed
+type patternRule struct {
+	rule    string
+	pattern string
+	reason  string
+}
+
+// Built-in high-risk patterns, used when a command can't be parsed as shell
+// syntax
+var builtinHighRiskPatterns = []patternRule{
+	{"rm-recursive-root", `rm\s+-[a-z]*r[a-z]*\s+("|')?(/|~|\$\{?home\b)`, "recursively deletes from the filesystem root or the home directory"},
+	{"dd", `dd\s+if=`, "copies raw data with dd"},
+	{"format-disk", `mkfs`, "formats a filesystem"},
+	{"device-redirect", `>\s*/dev/`, "writes to a device file"},
+	{"chmod-777", `chmod\s+777`, "makes files writable by everyone"},
+	{"chmod-777", `chmod\s+-R\s+777`, "recursively makes files writable by everyone"},
+	{"remote-script", `curl.*\|\s*bash`, "runs a downloaded script"},
+	{"remote-script", `wget.*\|\s*sh`, "runs a downloaded script"},
+	{"fork-bomb", `:\(\)\{.*\};:`, "defines a fork bomb"},
+	{"kill-all", `killall\s+-9`, "force-kills processes by name"},
+}
+
+// Built-in medium-risk patterns, used when a command can't be parsed
+var builtinMediumRiskPatterns = []patternRule{
+	{"privileged", `sudo`, "runs with elevated privileges"},
+	{"rm", `rm\s+`, "deletes files"},
+	{"mv", `mv\s+`, "moves or overwrites files"},
+	{"chmod", `chmod`, "changes file permissions"},
+	{"chown", `chown`, "changes file ownership"},
+	{"kill", `kill`, "terminates processes"},
+	{"kill", `pkill`, "terminates processes"},
+	{"service", `systemctl`, "manages system services"},
+	{"power", `reboot`, "reboots the machine"},
+	{"power", `shutdown`, "shuts down the machine"},
+	{"firewall", `iptables`, "changes firewall rules"},
+	{"package-remove", `apt-get\s+remove`, "removes packages"},
+	{"package-remove", `yum\s+remove`, "removes packages"},
 }
 
 // ApplySafetyFilters filters and classifies suggestions based on safety rules
 func ApplySafetyFilters(suggestions []Suggestion, cfg *config.SafetyConfig) []Suggestion {
 	var filtered []Suggestion
+	chain := DefaultRiskChain(cfg)
 
 	for _, suggestion := range suggestions {
 		// Check if command is blocked
@@ -58,8 +96,7 @@ func ApplySafetyFilters(suggestions []Suggestion, cfg *config.SafetyConfig) []Su
 		}
 
 		// Classify risk for remaining commands
-		risk := ClassifyRisk(suggestion.Command, cfg)
-		suggestion.Risk = risk
+		suggestion.Risk, suggestion.Findings = chain.Classify(context.Background(), RiskInput{Command: suggestion.Command})
 
 		filtered = append(filtered, suggestion)
 	}
@@ -67,53 +104,140 @@ func ApplySafetyFilters(suggestions []Suggestion, cfg *config.SafetyConfig) []Su
 	return filtered
 }
 
-// ClassifyRisk determines the risk level of a command
+// ClassifyRisk determines the risk level of a command with the default
+// classifier chain
 func ClassifyRisk(command string, cfg *config.SafetyConfig) RiskLevel {
-	commandLower := strings.ToLower(command)
+	risk, _ := DefaultRiskChain(cfg).Classify(context.Background(), RiskInput{Command: command})
+	return risk
+}
+
+// AnalyzeRisk explains why a command run in cwd is risky, using the default
+// classifier chain. The command is parsed as shell syntax and each simple
+// command is checked on its own, after quotes, escapes and wrappers such as
+// sudo, env and xargs are seen through, so `echo "rm -rf /"` is harmless
+// while `r""m -rf /` is not. Patterns from require_confirm_patterns, and from
+// the project containing cwd, are matched against the whole line and make it
+// high risk. Findings are ordered from most to least severe.
+func AnalyzeRisk(command, cwd string, cfg *config.SafetyConfig) []Finding {
+	_, findings := DefaultRiskChain(cfg).Classify(context.Background(), RiskInput{Command: command, CWD: cwd})
+	return findings
+}
+
+// matchPatterns classifies a command that isn't valid shell syntax with
+// regular expressions over the whole line. Medium-risk patterns are only
+// reported when no high-risk pattern matches.
+func matchPatterns(command string) []Finding {
+	findings := matchRules(command, builtinHighRiskPatterns, RiskHigh)
+	if len(findings) == 0 {
+		findings = matchRules(command, builtinMediumRiskPatterns, RiskMedium)
+	}
+	return findings
+}
 
-	// Check high-risk patterns first
-	for _, pattern := range builtinHighRiskPatterns {
-		matched, err := regexp.MatchString(pattern, commandLower)
-		if err == nil && matched {
-			return RiskHigh
+// matchRules returns a builtin finding for every rule matching command
+func matchRules(command string, rules []patternRule, level RiskLevel) []Finding {
+	var findings []Finding
+	for _, rule := range rules {
+		if loc := matchIgnoreCase(rule.pattern, command); loc != nil {
+			findings = append(findings, Finding{
+				Rule:     rule.rule,
+				Span:     Span{loc[0], loc[1]},
+				Source:   SourceBuiltin,
+				Severity: level,
+				Reason:   rule.reason,
+			})
 		}
 	}
+	return findings
+}
 
-	// Check config-defined high-risk patterns
-	if cfg != nil {
-		for _, pattern := range cfg.RequireConfirmPatterns {
-			matched, err := regexp.MatchString(pattern, commandLower)
-			if err == nil && matched {
-				return RiskHigh
-			}
+// matchConfirmPatterns returns a high-risk finding for every user pattern
+// matching command. Invalid patterns are ignored.
+func matchConfirmPatterns(command string, patterns []string, source, origin string) []Finding {
+	var findings []Finding
+	for _, pattern := range patterns {
+		if loc := matchIgnoreCase(pattern, command); loc != nil {
+			findings = append(findings, Finding{
+				Rule:     "confirm:" + pattern,
+				Span:     Span{loc[0], loc[1]},
+				Source:   source,
+				Severity: RiskHigh,
+				Reason:   fmt.Sprintf("matches %q from %s", pattern, origin),
+			})
+		}
+	}
+	return findings
+}
+
+// matchIgnoreCase returns the location of the first case-insensitive match
+// of pattern in s, or nil
+func matchIgnoreCase(pattern, s string) []int {
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil
+	}
+	return re.FindStringIndex(s)
+}
+
+// sortFindings drops duplicate findings and orders the rest by severity,
+// then by position
+func sortFindings(findings []Finding) []Finding {
+	seen := make(map[Finding]bool)
+	unique := findings[:0]
+	for _, finding := range findings {
+		if !seen[finding] {
+			seen[finding] = true
+			unique = append(unique, finding)
 		}
 	}
 
-	// Check medium-risk patterns
-	for _, pattern := range builtinMediumRiskPatterns {
-		matched, err := regexp.MatchString(pattern, commandLower)
-		if err == nil && matched {
-			return RiskMedium
+	sort.SliceStable(unique, func(i, j int) bool {
+		if unique[i].Severity != unique[j].Severity {
+			return riskRank[unique[i].Severity] > riskRank[unique[j].Severity]
 		}
+		return unique[i].Span.Start < unique[j].Span.Start
+	})
+	if len(unique) == 0 {
+		return nil
 	}
+	return unique
+}
+
+// riskRank orders risk levels from least to most severe
+var riskRank = map[RiskLevel]int{RiskLow: 0, RiskMedium: 1, RiskHigh: 2}
 
-	// Default to low risk
-	return RiskLow
+// maxRisk returns the more severe of two risk levels
+func maxRisk(a, b RiskLevel) RiskLevel {
+	if riskRank[b] > riskRank[a] {
+		return b
+	}
+	return a
 }
 
-// IsBlocked returns true if the command should be blocked entirely
+// IsBlocked returns true if the command should be blocked entirely. The
+// denylist is matched against the line as written and against each simple
+// command in it as the shell would run it, so that quoting such as r""m or
+// wrappers such as sudo don't get around it.
 func IsBlocked(command string, cfg *config.SafetyConfig) bool {
-	if cfg == nil {
+	if cfg == nil || len(cfg.Denylist) == 0 {
 		return false
 	}
 
-	commandLower := strings.ToLower(command)
+	forms := []string{command}
+	if calls, ok := simpleCommands(command); ok {
+		forms = append(forms, calls...)
+	}
 
 	// Check against denylist patterns
 	for _, pattern := range cfg.Denylist {
-		matched, err := regexp.MatchString(pattern, commandLower)
-		if err == nil && matched {
-			return true
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		for _, form := range forms {
+			if re.MatchString(strings.ToLower(form)) {
+				return true
+			}
 		}
 	}
 
@@ -34,6 +34,48 @@ func TestClassifyRisk(t *testing.T) {
 		{"echo", "echo hello", RiskLow},
 		{"pwd", "pwd", RiskLow},
 		{"grep", "grep pattern file.txt", RiskLow},
+
+		// Parsed as shell syntax rather than matched as text
+		{"quoted rm", `echo "rm -rf /"`, RiskLow},
+		{"mkfs as grep pattern", "grep -r mkfs docs/", RiskLow},
+		{"commit message", `git commit -m "rm -rf /"`, RiskLow},
+		{"redirect to null", "make > /dev/null 2>&1", RiskLow},
+		{"read-only systemctl", "systemctl status nginx", RiskLow},
+		{"command lookup", "command -v rm", RiskLow},
+		{"relative rm -rf", "rm -rf ./build", RiskMedium},
+		{"empty quotes in name", `r""m -rf /`, RiskHigh},
+		{"escaped name", `r\m -rf /*`, RiskHigh},
+		{"ANSI-C quoted name", `$'\x72m' -rf /`, RiskHigh},
+		{"printf substitution", "$(printf rm) -rf /", RiskHigh},
+		{"backquoted echo", "`echo rm` -rf /", RiskHigh},
+		{"variable", "x=rm; $x -rf /", RiskHigh},
+		{"dynamic name", "$EDITOR notes.txt", RiskMedium},
+		{"sudo wrapper", "sudo -u root rm -rf /etc", RiskHigh},
+		{"env wrapper", "env FOO=1 rm -rf ~", RiskHigh},
+		{"nested wrappers", "nohup nice -n 5 rm -rf /usr", RiskHigh},
+		{"privileged delete under /var", "sudo rm -rf /var/log/old", RiskHigh},
+		{"privileged delete deep under /usr", "sudo rm -rf /usr/local/lib/python3", RiskHigh},
+		{"unprivileged delete under /var", "rm -rf /var/log/old", RiskMedium},
+		{"privileged delete without force", "sudo rm -r /var/log/old", RiskMedium},
+		{"xargs", "find . -name '*.o' | xargs rm -f", RiskMedium},
+		{"find -exec", `find . -exec rm -rf / \;`, RiskHigh},
+		{"xargs rm under root", "find / -name x | xargs rm -rf", RiskHigh},
+		{"xargs rm of unknown files", "cat list.txt | xargs rm -f", RiskHigh},
+		{"xargs rm from a file", "xargs -a list.txt rm -rf", RiskHigh},
+		{"find -exec rm under a top-level directory", "find /var -name '*.log' -exec rm -f {} +", RiskHigh},
+		{"find -exec rm below cwd", `find . -name '*.o' -exec rm -f {} \;`, RiskMedium},
+		{"subshell", "(cd /tmp && rm -rf /)", RiskHigh},
+		{"command substitution", "echo $(rm -rf /)", RiskHigh},
+		{"eval", `eval "rm -rf /"`, RiskHigh},
+		{"bash -c", "bash -c 'mkfs /dev/sda'", RiskHigh},
+		{"home via variable", `rm -r "$HOME"`, RiskHigh},
+		{"device redirect", "cat image.iso > /dev/sda", RiskHigh},
+		{"tee to device", "echo 1 | sudo tee /dev/sda", RiskHigh},
+		{"pipe to sudo bash", "curl -fsSL https://example.com/i.sh | sudo bash", RiskHigh},
+		{"process substitution", "bash <(curl -s https://example.com/i.sh)", RiskHigh},
+		{"world-writable symbolic mode", "chmod a+rwx script.sh", RiskHigh},
+		{"kill everything", "kill -9 -1", RiskHigh},
+		{"unparseable", "rm -rf / (", RiskHigh},
 	}
 
 	for _, tt := range tests {
@@ -46,6 +88,92 @@ func TestClassifyRisk(t *testing.T) {
 	}
 }
 
+func TestAnalyzeRisk(t *testing.T) {
+	cfg := &config.SafetyConfig{
+		RequireConfirmPatterns: []string{`terraform\s+apply`},
+		Projects: map[string]config.ProjectSafetyConfig{
+			"/srv/app": {RequireConfirmPatterns: []string{`deploy`}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		cwd     string
+		want    []Finding
+	}{
+		{
+			name:    "harmless command",
+			command: "ls -la",
+			want:    nil,
+		},
+		{
+			name:    "builtin rule",
+			command: "cd /tmp && rm -rf /",
+			want: []Finding{
+				{Rule: "rm-recursive-root", Span: Span{11, 19}, Source: SourceBuiltin, Severity: RiskHigh, Reason: "recursively deletes /"},
+			},
+		},
+		{
+			name:    "ordered by severity",
+			command: "sudo ls; dd if=/dev/zero of=/dev/sda",
+			want: []Finding{
+				{Rule: "dd-device", Span: Span{9, 36}, Source: SourceBuiltin, Severity: RiskHigh},
+				{Rule: "privileged", Span: Span{0, 7}, Source: SourceBuiltin, Severity: RiskMedium},
+			},
+		},
+		{
+			name:    "config pattern matches case-insensitively",
+			command: "TERRAFORM apply",
+			want: []Finding{
+				{Rule: "confirm:terraform\\s+apply", Span: Span{0, 15}, Source: SourceConfig, Severity: RiskHigh},
+			},
+		},
+		{
+			name:    "project pattern inside the project",
+			command: "make deploy",
+			cwd:     "/srv/app/web",
+			want: []Finding{
+				{Rule: "confirm:deploy", Span: Span{5, 11}, Source: SourceProject, Severity: RiskHigh},
+			},
+		},
+		{
+			name:    "project pattern outside the project",
+			command: "make deploy",
+			cwd:     "/home/user",
+			want:    nil,
+		},
+		{
+			name:    "unparseable command falls back to patterns",
+			command: "rm -rf / (",
+			want: []Finding{
+				{Rule: "rm-recursive-root", Span: Span{0, 8}, Source: SourceBuiltin, Severity: RiskHigh},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AnalyzeRisk(tt.command, tt.cwd, cfg)
+			if len(got) != len(tt.want) {
+				t.Fatalf("AnalyzeRisk(%q) = %+v, want %d findings", tt.command, got, len(tt.want))
+			}
+			for i, want := range tt.want {
+				g := got[i]
+				if g.Rule != want.Rule || g.Span != want.Span || g.Source != want.Source || g.Severity != want.Severity {
+					t.Errorf("finding %d = %+v, want %+v", i, g, want)
+				}
+				if want.Reason != "" && g.Reason != want.Reason {
+					t.Errorf("finding %d reason = %q, want %q", i, g.Reason, want.Reason)
+				}
+				if g.Reason == "" {
+					t.Errorf("finding %d has no reason", i)
+				}
+			}
+		})
+	}
+}
+
 func TestIsBlocked(t *testing.T) {
 	cfg := &config.SafetyConfig{
 		Denylist: []string{
@@ -63,6 +191,9 @@ func TestIsBlocked(t *testing.T) {
 		{"blocked dd", "dd if=/dev/zero of=/dev/sda", true},
 		{"allowed ls", "ls -la", false},
 		{"allowed rm file", "rm myfile.txt", false},
+		{"quoted name", `r""m -rf /`, true},
+		{"variable", "x=rm; $x -rf /", true},
+		{"escaped in eval", `eval "r\m -rf /"`, true},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,406 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+// riskEnv is where a command runs, for matching it against
+// safety.sensitive_environments
+type riskEnv struct {
+	environments []config.SensitiveEnvironment
+	kubeContext  string
+	awsProfile   string
+	gitBranch    string
+	hostname     string
+}
+
+// newRiskEnv describes where input runs, or returns nil when no sensitive
+// environments are configured. The git branch and host name are looked up
+// when input doesn't have them.
+func newRiskEnv(environments []config.SensitiveEnvironment, input RiskInput) *riskEnv {
+	if len(environments) == 0 {
+		return nil
+	}
+
+	e := &riskEnv{
+		environments: environments,
+		kubeContext:  input.KubeContext,
+		awsProfile:   input.AWSProfile,
+		gitBranch:    input.GitBranch,
+		hostname:     input.Hostname,
+	}
+	if e.gitBranch == "" && filepath.IsAbs(input.CWD) {
+		e.gitBranch = readGitBranch(input.CWD)
+	}
+	if e.hostname == "" {
+		e.hostname = hostname()
+	}
+	return e
+}
+
+// matching returns the names of the environments with a pattern matching
+// value. Host names are matched case-insensitively.
+func (e *riskEnv) matching(value string, patterns func(config.SensitiveEnvironment) []string, foldCase bool) []string {
+	if value == "" {
+		return nil
+	}
+	if foldCase {
+		value = strings.ToLower(value)
+	}
+
+	var names []string
+	for _, environment := range e.environments {
+		for _, pattern := range patterns(environment) {
+			if foldCase {
+				pattern = strings.ToLower(pattern)
+			}
+			if ok, _ := path.Match(pattern, value); ok {
+				name := environment.Name
+				if name == "" {
+					name = pattern
+				}
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func kubeContextPatterns(e config.SensitiveEnvironment) []string { return e.KubeContexts }
+func awsProfilePatterns(e config.SensitiveEnvironment) []string  { return e.AWSProfiles }
+func gitBranchPatterns(e config.SensitiveEnvironment) []string   { return e.GitBranches }
+func hostnamePatterns(e config.SensitiveEnvironment) []string    { return e.Hostnames }
+
+// checkSensitive escalates a simple command that changes state in a
+// sensitive environment: a kubectl or helm change in a sensitive kube
+// context, an AWS, Terraform, Pulumi or CDK change under a sensitive AWS
+// profile, a history rewrite on a sensitive git branch, or anything the
+// rules flagged since before on a sensitive host.
+func (a *riskAnalyzer) checkSensitive(words []shellWord, assigns []*syntax.Assign, node syntax.Node, before int) {
+	e := a.env
+	if e == nil {
+		return
+	}
+
+	// Anything but sudo itself changes a sensitive host
+	changesHost := false
+	for _, h := range a.hits[before:] {
+		changesHost = changesHost || h.rule != "privileged"
+	}
+
+	args, _ := unwrapCommand(words)
+	if len(args) > 0 && args[0].static {
+		name := path.Base(args[0].value)
+		rest := args[1:]
+		switch name {
+		case "kubectl", "oc":
+			if verb, ok := kubectlChange(rest); ok {
+				context := e.kubeContext
+				if value, ok := flagValue(rest, "--context"); ok {
+					context = value
+				}
+				a.hitSensitive(node, name+" "+verb, "kube context", context, kubeContextPatterns)
+			}
+		case "helm":
+			if verb, ok := helmChange(rest); ok {
+				context := e.kubeContext
+				if value, ok := flagValue(rest, "--kube-context"); ok {
+					context = value
+				}
+				a.hitSensitive(node, "helm "+verb, "kube context", context, kubeContextPatterns)
+			}
+		case "aws", "terraform", "tofu", "pulumi", "cdk":
+			if verb, ok := cloudChange(name, rest); ok {
+				profile := e.awsProfile
+				if value, ok := a.inlineAssign(words, args, assigns, "AWS_PROFILE"); ok {
+					profile = value
+				}
+				if value, ok := flagValue(rest, "--profile"); ok && name == "aws" {
+					profile = value
+				}
+				a.hitSensitive(node, name+" "+verb, "AWS profile", profile, awsProfilePatterns)
+			}
+		case "git":
+			if what, branches := gitRewrite(rest, e.gitBranch); what != "" {
+				for _, branch := range branches {
+					a.hitSensitive(node, what, "git branch", branch, gitBranchPatterns)
+				}
+			}
+		}
+	}
+
+	if changesHost {
+		for _, environment := range e.matching(e.hostname, hostnamePatterns, true) {
+			a.hit(node, "sensitive-environment", RiskHigh, fmt.Sprintf("changes the machine in sensitive environment %s (host %s)", environment, e.hostname))
+		}
+	}
+}
+
+// hitSensitive records a finding for every sensitive environment value
+// belongs to
+func (a *riskAnalyzer) hitSensitive(node syntax.Node, what, kind, value string, patterns func(config.SensitiveEnvironment) []string) {
+	for _, environment := range a.env.matching(value, patterns, false) {
+		a.hit(node, "sensitive-environment", RiskHigh, fmt.Sprintf("%s in sensitive environment %s (%s %s)", what, environment, kind, value))
+	}
+}
+
+// kubectlReadOnly are kubectl commands that don't change the cluster
+var kubectlReadOnly = map[string]bool{
+	"get": true, "describe": true, "logs": true, "top": true, "explain": true,
+	"api-resources": true, "api-versions": true, "version": true, "cluster-info": true,
+	"config": true, "diff": true, "auth": true, "wait": true, "events": true,
+	"completion": true, "plugin": true, "port-forward": true, "proxy": true,
+	"options": true, "help": true, "kustomize": true,
+}
+
+// kubectlValueFlags are kubectl global options that take a separate value
+var kubectlValueFlags = map[string]bool{
+	"-n": true, "--namespace": true, "--context": true, "--cluster": true, "--user": true,
+	"-s": true, "--server": true, "--kubeconfig": true, "--token": true, "--as": true,
+	"--request-timeout": true,
+}
+
+// kubectlChange returns the kubectl command when it changes the cluster
+func kubectlChange(args []shellWord) (string, bool) {
+	operands := operandsAfterFlags(args, kubectlValueFlags)
+	if len(operands) == 0 || kubectlReadOnly[operands[0]] || isDryRun(args) {
+		return "", false
+	}
+	verb := operands[0]
+	if verb == "rollout" && len(operands) > 1 {
+		if operands[1] == "status" || operands[1] == "history" {
+			return "", false
+		}
+		verb += " " + operands[1]
+	}
+	return verb, true
+}
+
+// helmChange returns the helm command when it changes a release
+func helmChange(args []shellWord) (string, bool) {
+	operands := operandsAfterFlags(args, map[string]bool{"-n": true, "--namespace": true, "--kube-context": true, "--kubeconfig": true})
+	if len(operands) == 0 || isDryRun(args) {
+		return "", false
+	}
+	switch operands[0] {
+	case "install", "upgrade", "uninstall", "delete", "del", "un", "rollback":
+		return operands[0], true
+	}
+	return "", false
+}
+
+// awsReadOnlyPrefixes are the AWS CLI operations that only read
+var awsReadOnlyPrefixes = []string{
+	"describe-", "get-", "list-", "batch-get-", "head-", "lookup-", "search-", "filter-", "validate-",
+}
+
+// cloudChange returns the aws, terraform, tofu, pulumi or cdk command when
+// it changes infrastructure
+func cloudChange(name string, args []shellWord) (string, bool) {
+	if isDryRun(args) || hasArg(args, "--dryrun") {
+		return "", false
+	}
+
+	switch name {
+	case "aws":
+		operands := operandsAfterFlags(args, map[string]bool{"--profile": true, "--region": true, "--output": true, "--endpoint-url": true, "--query": true})
+		if len(operands) < 2 {
+			return "", false
+		}
+		service, op := operands[0], operands[1]
+		switch {
+		case service == "sts" || service == "configure" || service == "help":
+			return "", false
+		case op == "ls" || op == "wait" || op == "help" || op == "presign" || op == "tail" || op == "query" || op == "scan":
+			return "", false
+		}
+		for _, prefix := range awsReadOnlyPrefixes {
+			if strings.HasPrefix(op, prefix) {
+				return "", false
+			}
+		}
+		return service + " " + op, true
+	case "terraform", "tofu":
+		operands := operandsAfterFlags(args, nil)
+		if len(operands) == 0 {
+			return "", false
+		}
+		switch operands[0] {
+		case "apply", "destroy", "import", "taint", "untaint", "force-unlock":
+			return operands[0], true
+		case "state", "workspace":
+			if len(operands) > 1 && (operands[1] == "rm" || operands[1] == "mv" || operands[1] == "push" || operands[1] == "replace-provider" || operands[1] == "delete") {
+				return operands[0] + " " + operands[1], true
+			}
+		}
+	case "pulumi":
+		operands := operandsAfterFlags(args, map[string]bool{"-s": true, "--stack": true, "-C": true, "--cwd": true})
+		if len(operands) == 0 {
+			return "", false
+		}
+		switch operands[0] {
+		case "up", "update", "destroy", "import", "refresh", "cancel":
+			return operands[0], true
+		case "stack", "state":
+			if len(operands) > 1 && (operands[1] == "rm" || operands[1] == "delete") {
+				return operands[0] + " " + operands[1], true
+			}
+		}
+	case "cdk":
+		if operands := operandsAfterFlags(args, map[string]bool{"--profile": true}); len(operands) > 0 && (operands[0] == "deploy" || operands[0] == "destroy") {
+			return operands[0], true
+		}
+	}
+	return "", false
+}
+
+// gitRewrite describes a git command that rewrites or deletes history, and
+// returns the branches it does so on. current is the checked-out branch.
+func gitRewrite(args []shellWord, current string) (string, []string) {
+	operands := operandsAfterFlags(args, map[string]bool{"-C": true, "-c": true, "--git-dir": true, "--work-tree": true})
+	if len(operands) == 0 {
+		return "", nil
+	}
+	// The subcommand's own arguments
+	for len(args) > 0 && args[0].value != operands[0] {
+		args = args[1:]
+	}
+	args = args[1:]
+	currentOnly := []string{current}
+
+	switch operands[0] {
+	case "push":
+		force := hasShortFlag(args, 'f') || hasArg(args, "--force") || hasArgPrefix(args, "--force-with-lease")
+		remove := hasShortFlag(args, 'd') || hasArg(args, "--delete")
+
+		var branches []string
+		refspecs := operandsAfterFlags(args, map[string]bool{"-o": true, "--push-option": true, "--repo": true})
+		if len(refspecs) > 0 {
+			refspecs = refspecs[1:] // the remote
+		}
+		for _, refspec := range refspecs {
+			if strings.HasPrefix(refspec, "+") {
+				force = true
+			}
+			if i := strings.LastIndexByte(refspec, ':'); i >= 0 {
+				remove = remove || i == 0
+				refspec = refspec[i+1:]
+			}
+			branches = append(branches, strings.TrimPrefix(strings.TrimPrefix(refspec, "+"), "refs/heads/"))
+		}
+		if len(branches) == 0 {
+			branches = currentOnly
+		}
+
+		switch {
+		case remove:
+			return "git push --delete", branches
+		case force:
+			return "git push --force", branches
+		}
+	case "reset":
+		if hasArg(args, "--hard") {
+			return "git reset --hard", currentOnly
+		}
+	case "rebase":
+		for _, arg := range args {
+			switch arg.value {
+			case "--continue", "--abort", "--skip", "--quit", "--edit-todo", "--show-current-patch":
+				return "", nil
+			}
+		}
+		return "git rebase", currentOnly
+	case "commit":
+		if hasArg(args, "--amend") {
+			return "git commit --amend", currentOnly
+		}
+	case "filter-branch", "filter-repo":
+		return "git " + operands[0], currentOnly
+	case "branch":
+		if hasArg(args, "-D") || hasArg(args, "-d") || hasArg(args, "--delete") {
+			return "git branch --delete", operandsAfterFlags(args, nil)
+		}
+	}
+	return "", nil
+}
+
+// operandsAfterFlags returns the values of the arguments that aren't options
+// or the values of the options in valueFlags
+func operandsAfterFlags(args []shellWord, valueFlags map[string]bool) []string {
+	var operands []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i].value
+		switch {
+		case arg == "--":
+			for _, rest := range args[i+1:] {
+				operands = append(operands, rest.value)
+			}
+			return operands
+		case valueFlags[arg]:
+			i++
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			operands = append(operands, arg)
+		}
+	}
+	return operands
+}
+
+// flagValue returns the value of a long option given as "--name value" or
+// "--name=value"
+func flagValue(args []shellWord, name string) (string, bool) {
+	for i, arg := range args {
+		if value, ok := strings.CutPrefix(arg.value, name+"="); ok {
+			return value, true
+		}
+		if arg.value == name && i+1 < len(args) {
+			return args[i+1].value, true
+		}
+	}
+	return "", false
+}
+
+// hasArgPrefix reports whether an argument starts with prefix
+func hasArgPrefix(args []shellWord, prefix string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg.value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDryRun reports whether a --dry-run option, other than --dry-run=none,
+// is set
+func isDryRun(args []shellWord) bool {
+	for _, arg := range args {
+		if arg.value == "--dry-run" || strings.HasPrefix(arg.value, "--dry-run=") && arg.value != "--dry-run=none" {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineAssign returns the value a command sets for an environment variable,
+// as in NAME=value cmd or env NAME=value cmd. words are the command's words
+// and args what is left of them after wrappers.
+func (a *riskAnalyzer) inlineAssign(words, args []shellWord, assigns []*syntax.Assign, name string) (string, bool) {
+	for _, word := range words[:len(words)-len(args)] {
+		if value, ok := strings.CutPrefix(word.value, name+"="); ok {
+			return value, true
+		}
+	}
+	for _, assign := range assigns {
+		if assign.Name != nil && assign.Name.Value == name && assign.Value != nil {
+			return a.resolveWord(assign.Value).value, true
+		}
+	}
+	return "", false
+}
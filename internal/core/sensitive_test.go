@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+func TestBuiltinClassifier_SensitiveEnvironments(t *testing.T) {
+	classifier := BuiltinClassifier{Environments: []config.SensitiveEnvironment{
+		{Name: "prod", KubeContexts: []string{"prod-*"}, AWSProfiles: []string{"prod"}, Hostnames: []string{"*.prod.example.com"}},
+		{Name: "protected", GitBranches: []string{"main", "release/*"}},
+	}}
+	prod := RiskInput{KubeContext: "prod-eu", AWSProfile: "prod", GitBranch: "main", Hostname: "web1.prod.example.com"}
+	dev := RiskInput{KubeContext: "dev", AWSProfile: "dev", GitBranch: "feature", Hostname: "laptop"}
+
+	tests := []struct {
+		name       string
+		command    string
+		env        RiskInput
+		want       RiskLevel
+		wantReason string
+	}{
+		{"kubectl delete in prod", "kubectl delete pod web-1", prod, RiskHigh, "kubectl delete in sensitive environment prod (kube context prod-eu)"},
+		{"kubectl delete in dev", "kubectl delete pod web-1", dev, RiskLow, ""},
+		{"kubectl get in prod", "kubectl -n web get pods", prod, RiskLow, ""},
+		{"kubectl dry run", "kubectl apply --dry-run=server -f app.yaml", prod, RiskLow, ""},
+		{"kubectl rollout status", "kubectl rollout status deploy/web", prod, RiskLow, ""},
+		{"kubectl rollout restart", "kubectl rollout restart deploy/web", prod, RiskHigh, "kubectl rollout restart"},
+		{"--context selects prod", "kubectl --context prod-us scale deploy/web --replicas=0", dev, RiskHigh, "(kube context prod-us)"},
+		{"--context selects dev", "kubectl --context=dev delete pod web-1", prod, RiskLow, ""},
+		{"helm upgrade", "helm upgrade web ./chart", prod, RiskHigh, "helm upgrade"},
+		{"aws delete", "aws s3 rm s3://bucket/key", prod, RiskHigh, "aws s3 rm in sensitive environment prod (AWS profile prod)"},
+		{"aws describe", "aws ec2 describe-instances", prod, RiskLow, ""},
+		{"aws --profile", "aws --profile prod ec2 terminate-instances --instance-ids i-1", dev, RiskHigh, "aws ec2 terminate-instances"},
+		{"inline AWS_PROFILE", "AWS_PROFILE=prod terraform apply", dev, RiskHigh, "terraform apply"},
+		{"env AWS_PROFILE", "env AWS_PROFILE=prod terraform destroy", dev, RiskHigh, "terraform destroy"},
+		{"terraform plan", "terraform plan", prod, RiskLow, ""},
+		{"force push on main", "git push --force", prod, RiskHigh, "git push --force in sensitive environment protected (git branch main)"},
+		{"force push on a feature branch", "git push -f", dev, RiskLow, ""},
+		{"force push to a release branch", "git push origin +release/1.2", dev, RiskHigh, "(git branch release/1.2)"},
+		{"delete a remote branch", "git push origin --delete main", dev, RiskHigh, "git push --delete"},
+		{"plain push on main", "git push", prod, RiskLow, ""},
+		{"reset --hard on main", "git reset --hard HEAD~1", prod, RiskHigh, "git reset --hard"},
+		{"rebase --continue", "git rebase --continue", prod, RiskLow, ""},
+		{"rm on a sensitive host", "rm old.log", prod, RiskHigh, "changes the machine in sensitive environment prod (host web1.prod.example.com)"},
+		{"rm elsewhere", "rm old.log", dev, RiskMedium, ""},
+		{"sudo read on a sensitive host", "sudo ls /root", prod, RiskMedium, ""},
+		{"read-only on a sensitive host", "tail -f /var/log/syslog", prod, RiskLow, ""},
+		{"in a pipeline", "cat pods.txt | xargs kubectl delete pod", prod, RiskHigh, "kubectl delete"},
+		{"in eval", `eval "kubectl delete ns web"`, prod, RiskHigh, "kubectl delete"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.env
+			input.Command = tt.command
+			findings := classifier.Classify(context.Background(), input)
+			if risk := MaxSeverity(findings); risk != tt.want {
+				t.Errorf("risk = %v, want %v (findings %+v)", risk, tt.want, findings)
+			}
+
+			var sensitive []string
+			for _, finding := range findings {
+				if finding.Rule == "sensitive-environment" {
+					sensitive = append(sensitive, finding.Reason)
+				}
+			}
+			if tt.wantReason == "" && len(sensitive) != 0 {
+				t.Errorf("sensitive findings = %q, want none", sensitive)
+			}
+			if tt.wantReason != "" && (len(sensitive) == 0 || !strings.Contains(sensitive[0], tt.wantReason)) {
+				t.Errorf("sensitive findings = %q, want one containing %q", sensitive, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestCollectKubeContext(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty")
+	current := filepath.Join(dir, "config")
+	if err := os.WriteFile(empty, []byte("apiVersion: v1\nclusters: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kubeconfig := "apiVersion: v1\ncontexts:\n- name: dev\n  context:\n    current-context: nested\ncurrent-context: \"prod-eu\" # active\n"
+	if err := os.WriteFile(current, []byte(kubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("KUBECONFIG", empty+string(filepath.ListSeparator)+current)
+	if got := collectKubeContext(); got != "prod-eu" {
+		t.Errorf("collectKubeContext() = %q, want %q", got, "prod-eu")
+	}
+
+	t.Setenv("KUBECONFIG", empty)
+	if got := collectKubeContext(); got != "" {
+		t.Errorf("collectKubeContext() = %q, want none", got)
+	}
+}
+
+func TestReadGitBranch(t *testing.T) {
+	repo := t.TempDir()
+	sub := filepath.Join(repo, "src", "pkg")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		head string
+		want string
+	}{
+		{"ref: refs/heads/main\n", "main"},
+		{"ref: refs/heads/release/1.2\n", "release/1.2"},
+		{"4b825dc642cb6eb9a060e54bf8d69288fbee4904\n", ""}, // detached
+	}
+
+	for _, tt := range tests {
+		if err := os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte(tt.head), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := readGitBranch(sub); got != tt.want {
+			t.Errorf("readGitBranch() with HEAD %q = %q, want %q", tt.head, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,946 @@
+package core
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// maxEvalDepth bounds how deeply eval and sh -c strings are parsed again
+const maxEvalDepth = 3
+
+// riskHit is one reason a command line was classified above low risk
+type riskHit struct {
+	rule   string // short identifier, e.g. "rm-recursive-root"
+	level  RiskLevel
+	reason string
+	pos    int // byte offsets of the offending part of the command line
+	end    int
+	// targets is the number of files the command affects, when its target
+	// paths could be resolved
+	targets int
+}
+
+// shellWord is a command word resolved as far as static analysis allows
+type shellWord struct {
+	value  string // the expanded value, or a placeholder such as "$HOME"
+	static bool   // false when the value depends on run-time state
+	glob   bool   // true when the word has unquoted *, ? or [ characters
+}
+
+// riskAnalyzer classifies a parsed command line one simple command at a time
+type riskAnalyzer struct {
+	vars  map[string]string // literal variable assignments seen so far
+	hits  []riskHit
+	depth int
+	// paths resolves the files commands operate on; nil when the working
+	// directory is unknown
+	paths *pathContext
+	// env is where the command line runs; nil when no sensitive
+	// environments are configured
+	env *riskEnv
+	// calls collects every simple command as the shell would run it, for
+	// matching against the denylist; nil when not needed
+	calls *[]string
+	// span overrides the reported position for strings parsed again
+	// (eval, sh -c), whose offsets refer to the inner string
+	span *[2]int
+	// findFeeds maps pipeline stages that read the output of find to the
+	// directories it searches
+	findFeeds map[*syntax.CallExpr][]shellWord
+	// runArgs is set while checking a command run by xargs or find -exec,
+	// which adds arguments only known at run time
+	runArgs *runArgs
+}
+
+// runArgs describes the arguments xargs or find -exec adds to a command
+type runArgs struct {
+	// under are the directories find searches for them; nil when they come
+	// from anywhere else, like a file or another command
+	under []shellWord
+}
+
+// analyzeShell parses command as bash and returns every risky construct in
+// it. With paths, the files destructive commands operate on are resolved as
+// well; with env, commands that change a sensitive environment are
+// escalated. ok is false when the command can't be parsed.
+func analyzeShell(command string, paths *pathContext, env *riskEnv) (hits []riskHit, ok bool) {
+	a := &riskAnalyzer{vars: make(map[string]string), paths: paths, env: env}
+	if !a.analyze(command) {
+		return nil, false
+	}
+	return a.hits, true
+}
+
+// simpleCommands returns every simple command in command with quotes,
+// escapes and known variables resolved, both as written and without
+// wrappers such as sudo. ok is false when the command can't be parsed.
+func simpleCommands(command string) (calls []string, ok bool) {
+	a := &riskAnalyzer{vars: make(map[string]string), calls: &calls}
+	if !a.analyze(command) {
+		return nil, false
+	}
+	return calls, true
+}
+
+// analyze parses src and walks every statement in it
+func (a *riskAnalyzer) analyze(src string) bool {
+	file, err := syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(src), "")
+	if err != nil {
+		return false
+	}
+
+	// Inner pipelines are checked as part of the outermost one
+	seenPipes := make(map[*syntax.BinaryCmd]bool)
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.Stmt:
+			a.checkRedirects(n.Redirs)
+		case *syntax.BinaryCmd:
+			if (n.Op == syntax.Pipe || n.Op == syntax.PipeAll) && !seenPipes[n] {
+				a.checkPipeline(n, seenPipes)
+			}
+		case *syntax.FuncDecl:
+			a.checkFuncDecl(n)
+		case *syntax.DeclClause:
+			a.recordAssigns(n.Args)
+		case *syntax.CallExpr:
+			if len(n.Args) == 0 {
+				a.recordAssigns(n.Assigns)
+				return true
+			}
+			args, before := a.resolveArgs(n.Args), len(a.hits)
+			a.checkCall(args, n)
+			a.checkRemoteScript(n)
+			a.checkSensitive(args, n.Assigns, n, before)
+		}
+		return true
+	})
+	return true
+}
+
+// hit records a finding for node
+func (a *riskAnalyzer) hit(node syntax.Node, rule string, level RiskLevel, reason string) {
+	h := riskHit{rule: rule, level: level, reason: reason}
+	if a.span != nil {
+		h.pos, h.end = a.span[0], a.span[1]
+	} else {
+		h.pos, h.end = int(node.Pos().Offset()), int(node.End().Offset())
+	}
+	a.hits = append(a.hits, h)
+}
+
+// recordAssigns remembers literal assignments so that `x=rm; $x -rf /` is
+// seen through
+func (a *riskAnalyzer) recordAssigns(assigns []*syntax.Assign) {
+	for _, assign := range assigns {
+		if assign.Name == nil || assign.Value == nil || assign.Append {
+			continue
+		}
+		if w := a.resolveWord(assign.Value); w.static {
+			a.vars[assign.Name.Value] = w.value
+		} else {
+			delete(a.vars, assign.Name.Value)
+		}
+	}
+}
+
+// resolveArgs resolves the words of a simple command. Unquoted expansions
+// are split into fields, as the shell would.
+func (a *riskAnalyzer) resolveArgs(words []*syntax.Word) []shellWord {
+	args := make([]shellWord, 0, len(words))
+	for _, word := range words {
+		w := a.resolveWord(word)
+		if w.static && len(word.Parts) == 1 {
+			switch word.Parts[0].(type) {
+			case *syntax.CmdSubst, *syntax.ParamExp:
+				for _, field := range strings.Fields(w.value) {
+					args = append(args, shellWord{value: field, static: true})
+				}
+				continue
+			}
+		}
+		args = append(args, w)
+	}
+	return args
+}
+
+// resolveWord expands quotes, escapes, known variables and simple command
+// substitutions such as $(printf rm)
+func (a *riskAnalyzer) resolveWord(word *syntax.Word) shellWord {
+	return a.resolveParts(word.Parts, false)
+}
+
+func (a *riskAnalyzer) resolveParts(parts []syntax.WordPart, quoted bool) shellWord {
+	var b strings.Builder
+	static, glob := true, false
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(unescapeLit(p.Value, quoted))
+			glob = glob || !quoted && hasGlobChars(p.Value)
+		case *syntax.SglQuoted:
+			if p.Dollar {
+				b.WriteString(unescapeANSIC(p.Value))
+			} else {
+				b.WriteString(p.Value)
+			}
+		case *syntax.DblQuoted:
+			inner := a.resolveParts(p.Parts, true)
+			b.WriteString(inner.value)
+			static = static && inner.static
+		case *syntax.ParamExp:
+			name := ""
+			if p.Param != nil {
+				name = p.Param.Value
+			}
+			plain := p.Exp == nil && p.Repl == nil && p.Slice == nil && p.Index == nil && !p.Length && !p.Excl
+			if value, ok := a.vars[name]; ok && plain {
+				b.WriteString(value)
+			} else {
+				b.WriteString("$" + name)
+				static = false
+			}
+		case *syntax.CmdSubst:
+			if value, ok := a.evalSubst(p); ok {
+				b.WriteString(value)
+			} else {
+				b.WriteString("$(...)")
+				static = false
+			}
+		default:
+			b.WriteString("?")
+			static = false
+		}
+	}
+	return shellWord{value: b.String(), static: static, glob: glob}
+}
+
+// evalSubst computes the output of a command substitution that only echoes
+// or printfs literal text, the usual way of hiding a command name
+func (a *riskAnalyzer) evalSubst(subst *syntax.CmdSubst) (string, bool) {
+	if len(subst.Stmts) != 1 {
+		return "", false
+	}
+	call, ok := subst.Stmts[0].Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return "", false
+	}
+	args := a.resolveArgs(call.Args)
+	for _, arg := range args {
+		if !arg.static {
+			return "", false
+		}
+	}
+
+	var out string
+	switch args[0].value {
+	case "echo":
+		rest := args[1:]
+		for len(rest) > 0 && (rest[0].value == "-n" || rest[0].value == "-e" || rest[0].value == "-E") {
+			rest = rest[1:]
+		}
+		values := make([]string, len(rest))
+		for i, arg := range rest {
+			values[i] = arg.value
+		}
+		out = strings.Join(values, " ")
+	case "printf":
+		if len(args) < 2 {
+			return "", false
+		}
+		format := args[1].value
+		switch {
+		case format == "%s" || format == "%s\\n":
+			for _, arg := range args[2:] {
+				out += arg.value
+			}
+		case !strings.Contains(format, "%"):
+			out = unescapeANSIC(format)
+		default:
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	// Command substitution strips trailing newlines
+	return strings.TrimRight(out, "\n"), true
+}
+
+// checkRedirects flags output redirected straight to a device
+func (a *riskAnalyzer) checkRedirects(redirs []*syntax.Redirect) {
+	for _, r := range redirs {
+		switch r.Op {
+		case syntax.RdrOut, syntax.AppOut, syntax.RdrInOut, syntax.RdrClob, syntax.AppClob,
+			syntax.RdrAll, syntax.RdrAllClob, syntax.AppAll, syntax.AppAllClob:
+		default:
+			continue
+		}
+		if r.Word == nil {
+			continue
+		}
+		if target := a.resolveWord(r.Word).value; isDevicePath(target) {
+			a.hit(r, "device-redirect", RiskHigh, "writes directly to device "+target)
+		}
+	}
+}
+
+// checkPipeline flags downloads piped into a shell, like curl ... | bash
+func (a *riskAnalyzer) checkPipeline(pipe *syntax.BinaryCmd, seen map[*syntax.BinaryCmd]bool) {
+	var stages []*syntax.Stmt
+	var flatten func(stmt *syntax.Stmt)
+	flatten = func(stmt *syntax.Stmt) {
+		if b, ok := stmt.Cmd.(*syntax.BinaryCmd); ok && (b.Op == syntax.Pipe || b.Op == syntax.PipeAll) {
+			seen[b] = true
+			flatten(b.X)
+			flatten(b.Y)
+			return
+		}
+		stages = append(stages, stmt)
+	}
+	seen[pipe] = true
+	flatten(pipe.X)
+	flatten(pipe.Y)
+
+	// xargs after find runs commands on the files find finds
+	for i := 1; i < len(stages); i++ {
+		prev, ok := stages[i-1].Cmd.(*syntax.CallExpr)
+		call, next := stages[i].Cmd.(*syntax.CallExpr)
+		if !ok || !next || len(prev.Args) == 0 || a.stageCommand(stages[i-1]) != "find" {
+			continue
+		}
+		args, _ := unwrapCommand(a.resolveArgs(prev.Args))
+		if a.findFeeds == nil {
+			a.findFeeds = make(map[*syntax.CallExpr][]shellWord)
+		}
+		a.findFeeds[call] = findStartingPoints(args[1:])
+	}
+
+	downloaded := false
+	for _, stage := range stages {
+		name := a.stageCommand(stage)
+		if downloaders[name] {
+			downloaded = true
+		} else if downloaded && shellInterpreters[name] {
+			a.hit(pipe, "remote-script", RiskHigh, "pipes downloaded content into "+name)
+			return
+		}
+	}
+}
+
+// checkRemoteScript flags scripts downloaded and run on the spot, like
+// bash <(curl ...) or sh -c "$(wget -O- ...)"
+func (a *riskAnalyzer) checkRemoteScript(call *syntax.CallExpr) {
+	stmt := &syntax.Stmt{Cmd: call}
+	name := a.stageCommand(stmt)
+	if !shellInterpreters[name] {
+		return
+	}
+	for _, word := range call.Args[1:] {
+		fetches := false
+		syntax.Walk(word, func(node syntax.Node) bool {
+			if inner, ok := node.(*syntax.Stmt); ok && downloaders[a.stageCommand(inner)] {
+				fetches = true
+			}
+			return !fetches
+		})
+		if fetches {
+			a.hit(call, "remote-script", RiskHigh, name+" runs a script downloaded on the spot")
+			return
+		}
+	}
+}
+
+// stageCommand returns the name of the command a pipeline stage runs, after
+// wrappers such as sudo
+func (a *riskAnalyzer) stageCommand(stmt *syntax.Stmt) string {
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return ""
+	}
+	args, _ := unwrapCommand(a.resolveArgs(call.Args))
+	if len(args) == 0 {
+		return ""
+	}
+	return path.Base(args[0].value)
+}
+
+// checkFuncDecl flags fork bombs: functions that pipe into or background
+// calls to themselves
+func (a *riskAnalyzer) checkFuncDecl(fn *syntax.FuncDecl) {
+	if fn.Name == nil || fn.Body == nil {
+		return
+	}
+	calls, spawns := 0, false
+	syntax.Walk(fn.Body, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			if len(n.Args) > 0 && n.Args[0].Lit() == fn.Name.Value {
+				calls++
+			}
+		case *syntax.BinaryCmd:
+			spawns = spawns || n.Op == syntax.Pipe || n.Op == syntax.PipeAll
+		case *syntax.Stmt:
+			spawns = spawns || n.Background
+		}
+		return true
+	})
+	if calls > 0 && spawns {
+		a.hit(fn, "fork-bomb", RiskHigh, "function "+fn.Name.Value+" spawns copies of itself (fork bomb)")
+	}
+}
+
+// checkCall classifies one simple command
+func (a *riskAnalyzer) checkCall(args []shellWord, node syntax.Node) {
+	a.recordCall(args)
+	wrapped := args
+	args, privileged := unwrapCommand(args)
+	if privileged {
+		a.hit(node, "privileged", RiskMedium, "runs with elevated privileges")
+	}
+	if len(args) == 0 {
+		return
+	}
+	for _, w := range wrapped[:len(wrapped)-len(args)] {
+		if w.static && path.Base(w.value) == "xargs" {
+			call, _ := node.(*syntax.CallExpr)
+			defer a.withRunArgs(&runArgs{under: a.findFeeds[call]})()
+			break
+		}
+	}
+	if !args[0].static {
+		a.hit(node, "dynamic-command", RiskMedium, "runs a command whose name is only known at run time")
+		return
+	}
+
+	name := path.Base(args[0].value)
+	rest := args[1:]
+	if strings.HasPrefix(name, "mkfs.") {
+		name = "mkfs"
+	}
+
+	switch name {
+	case "eval":
+		a.checkNested(rest, node)
+	case "sh", "bash", "zsh", "dash", "ksh", "su":
+		if script, ok := optionValue(rest, "-c"); ok {
+			a.checkNested([]shellWord{script}, node)
+		}
+		if name == "su" {
+			a.hit(node, "privileged", RiskMedium, "runs with elevated privileges")
+		}
+	case "cd", "pushd":
+		if a.paths != nil {
+			a.paths.chdir(positional(rest))
+		}
+	case "rm":
+		a.checkRemove(rest, node, privileged)
+	case "dd":
+		for _, arg := range rest {
+			if strings.HasPrefix(arg.value, "of=") && isDevicePath(arg.value[3:]) {
+				a.hit(node, "dd-device", RiskHigh, "overwrites device "+arg.value[3:])
+				return
+			}
+		}
+		a.hit(node, "dd", RiskMedium, "copies raw data with dd")
+	case "tee":
+		for _, arg := range positional(rest) {
+			if isDevicePath(arg.value) {
+				a.hit(node, "device-redirect", RiskHigh, "writes directly to device "+arg.value)
+			}
+		}
+	case "mkfs", "mke2fs", "mkswap", "wipefs":
+		a.hit(node, "format-disk", RiskHigh, "formats a disk or partition")
+	case "chmod":
+		for _, arg := range rest {
+			if isWorldWritableMode(arg.value) {
+				a.hit(node, "chmod-777", RiskHigh, "makes files writable by everyone")
+				return
+			}
+		}
+		a.checkRecursiveOwnership(name, rest, node)
+	case "chown", "chgrp":
+		a.checkRecursiveOwnership(name, rest, node)
+	case "mv":
+		a.hit(node, "mv", RiskMedium, "moves or overwrites files")
+		a.checkTargets(node, targetOp{verb: "moves", words: positional(rest), recursive: true, outside: RiskMedium})
+	case "kill", "pkill", "killall":
+		if name == "killall" && hasSignalKill(rest) || name == "kill" && hasSignalKill(rest) && hasArg(rest, "-1") {
+			a.hit(node, "kill-all", RiskHigh, "force-kills every matching process")
+			return
+		}
+		a.hit(node, "kill", RiskMedium, "terminates processes")
+	case "systemctl":
+		if sub := firstPositional(rest); !readOnlySystemctl[sub] {
+			a.hit(node, "service", RiskMedium, "changes system services")
+		}
+	case "reboot", "shutdown", "halt", "poweroff":
+		a.hit(node, "power", RiskMedium, "restarts or stops the machine")
+	case "iptables", "ip6tables", "nft", "ufw":
+		a.hit(node, "firewall", RiskMedium, "changes firewall rules")
+	case "apt", "apt-get", "yum", "dnf":
+		switch firstPositional(rest) {
+		case "remove", "purge", "autoremove", "erase":
+			a.hit(node, "package-remove", RiskMedium, "removes packages")
+		}
+	case "find":
+		a.checkFind(rest, node)
+	case "rsync":
+		a.checkRsync(rest, node)
+	case "git":
+		a.checkGit(rest, node)
+	}
+
+}
+
+// recordCall adds a simple command to calls, when they are collected
+func (a *riskAnalyzer) recordCall(args []shellWord) {
+	if a.calls == nil || len(args) == 0 {
+		return
+	}
+	*a.calls = append(*a.calls, joinWords(args))
+	if unwrapped, _ := unwrapCommand(args); len(unwrapped) > 0 && len(unwrapped) < len(args) {
+		*a.calls = append(*a.calls, joinWords(unwrapped))
+	}
+}
+
+// checkNested parses the words run by eval or sh -c as a command line of
+// their own
+func (a *riskAnalyzer) checkNested(words []shellWord, node syntax.Node) {
+	for _, w := range words {
+		if !w.static {
+			a.hit(node, "dynamic-command", RiskMedium, "runs a command string that is only known at run time")
+			return
+		}
+	}
+	if a.depth >= maxEvalDepth {
+		return
+	}
+
+	nested := &riskAnalyzer{vars: a.vars, depth: a.depth + 1, span: a.span, paths: a.paths, env: a.env, calls: a.calls}
+	if nested.span == nil {
+		nested.span = &[2]int{int(node.Pos().Offset()), int(node.End().Offset())}
+	}
+	if !nested.analyze(joinWords(words)) {
+		a.hit(node, "dynamic-command", RiskMedium, "runs a command string that can't be analyzed")
+		return
+	}
+	a.hits = append(a.hits, nested.hits...)
+}
+
+// checkRemove classifies rm by its flags and targets, and whether it runs
+// with elevated privileges
+func (a *riskAnalyzer) checkRemove(args []shellWord, node syntax.Node, privileged bool) {
+	if hasArg(args, "--no-preserve-root") {
+		a.hit(node, "rm-recursive-root", RiskHigh, "deletes the root directory")
+		return
+	}
+
+	recursive := hasShortFlag(args, 'r') || hasShortFlag(args, 'R') || hasArg(args, "--recursive")
+	force := hasShortFlag(args, 'f') || hasArg(args, "--force")
+	if a.runArgs != nil && (recursive || force) && a.checkRunArgs(node) {
+		return
+	}
+
+	op := targetOp{verb: "deletes", words: positional(args), recursive: recursive, outside: RiskMedium}
+	if recursive {
+		op.verb, op.outside = "recursively deletes", RiskHigh
+		for _, target := range op.words {
+			if isCriticalPath(target.value) {
+				a.hit(node, "rm-recursive-root", RiskHigh, "recursively deletes "+target.value)
+				op.reported = true
+				a.checkTargets(node, op)
+				return
+			}
+		}
+
+		// Only root can delete system files, so sudo rm -rf of anything
+		// under /usr or /etc is as dangerous as deleting the directory
+		if privileged && force {
+			for _, target := range op.words {
+				if target.static && isSystemPath(target.value) {
+					a.hit(node, "rm-recursive-system", RiskHigh, "recursively deletes "+target.value+" with elevated privileges")
+					op.reported = true
+					a.checkTargets(node, op)
+					return
+				}
+			}
+		}
+	}
+	a.hit(node, "rm", RiskMedium, "deletes files")
+	a.checkTargets(node, op)
+}
+
+// checkRunArgs flags rm -r or -f run by xargs or find -exec on files that
+// can be anywhere: found under a top-level directory, or read from
+// somewhere find doesn't describe. It reports whether it found either.
+func (a *riskAnalyzer) checkRunArgs(node syntax.Node) bool {
+	if a.runArgs.under == nil {
+		a.hit(node, "rm-unknown-targets", RiskHigh, "deletes files whose names are only known at run time")
+		return true
+	}
+	for _, dir := range a.runArgs.under {
+		if !dir.static {
+			a.hit(node, "rm-unknown-targets", RiskHigh, "deletes files found under a directory only known at run time")
+			return true
+		}
+		if isCriticalPath(dir.value) {
+			a.hit(node, "rm-recursive-root", RiskHigh, "deletes files found under "+dir.value)
+			return true
+		}
+	}
+	return false
+}
+
+// withRunArgs sets the arguments xargs or find -exec adds to the command
+// being checked, and returns a function that restores the previous ones
+func (a *riskAnalyzer) withRunArgs(args *runArgs) func() {
+	prev := a.runArgs
+	a.runArgs = args
+	return func() { a.runArgs = prev }
+}
+
+// checkRecursiveOwnership classifies chmod, chown and chgrp
+func (a *riskAnalyzer) checkRecursiveOwnership(name string, args []shellWord, node syntax.Node) {
+	if !hasShortFlag(args, 'R') && !hasArg(args, "--recursive") {
+		a.hit(node, name, RiskMedium, "changes file permissions or ownership")
+		return
+	}
+
+	// The first operand is the mode or owner
+	var targets []shellWord
+	if operands := positional(args); len(operands) > 1 {
+		targets = operands[1:]
+	}
+	op := targetOp{verb: "recursively changes", words: targets, recursive: true, outside: RiskHigh}
+	for _, target := range targets {
+		if isCriticalPath(target.value) {
+			a.hit(node, name+"-recursive-root", RiskHigh, "recursively changes "+target.value)
+			op.reported = true
+			a.checkTargets(node, op)
+			return
+		}
+	}
+	a.hit(node, name, RiskMedium, "changes file permissions or ownership")
+	a.checkTargets(node, op)
+}
+
+// checkFind flags -delete and classifies the commands run by -exec
+func (a *riskAnalyzer) checkFind(args []shellWord, node syntax.Node) {
+	for i := 0; i < len(args); i++ {
+		switch args[i].value {
+		case "-delete":
+			a.hit(node, "find-delete", RiskMedium, "deletes the files it finds")
+			a.checkTargets(node, targetOp{verb: "deletes files under", words: findStartingPoints(args), recursive: true, outside: RiskHigh})
+		case "-exec", "-execdir", "-ok", "-okdir":
+			end := i + 1
+			for end < len(args) && args[end].value != ";" && args[end].value != "+" {
+				end++
+			}
+			restore := a.withRunArgs(&runArgs{under: findStartingPoints(args)})
+			a.checkCall(args[i+1:end], node)
+			restore()
+			i = end
+		}
+	}
+}
+
+// wrapper describes a command that runs the command following its options
+type wrapper struct {
+	argOpts    string // short options that take a value
+	operands   int    // operands before the command, like timeout's duration
+	privileged bool
+}
+
+var wrappers = map[string]wrapper{
+	"sudo":    {argOpts: "ugChprtTUD", privileged: true},
+	"doas":    {argOpts: "uC", privileged: true},
+	"env":     {argOpts: "uCS"},
+	"xargs":   {argOpts: "IiLlnPdEsa"},
+	"nice":    {argOpts: "n"},
+	"nohup":   {},
+	"time":    {argOpts: "fo"},
+	"command": {},
+	"builtin": {},
+	"exec":    {argOpts: "a"},
+	"timeout": {argOpts: "sk", operands: 1},
+	"stdbuf":  {argOpts: "ioe"},
+	"ionice":  {argOpts: "cnp"},
+}
+
+// longArgOpts lists wrapper long options that take a separate value
+var longArgOpts = map[string]bool{
+	"--user": true, "--group": true, "--chdir": true, "--unset": true, "--signal": true,
+	"--kill-after": true, "--max-args": true, "--max-procs": true, "--delimiter": true,
+	"--adjustment": true, "--arg-file": true, "--prompt": true, "--close-from": true,
+}
+
+// unwrapCommand strips wrappers such as sudo, env and xargs, returning the
+// command they run and whether any of them elevates privileges
+func unwrapCommand(args []shellWord) ([]shellWord, bool) {
+	privileged := false
+	for len(args) > 0 && args[0].static {
+		w, ok := wrappers[path.Base(args[0].value)]
+		if !ok {
+			break
+		}
+		privileged = privileged || w.privileged
+		name := path.Base(args[0].value)
+		args = args[1:]
+
+		// Options, and for env NAME=value assignments
+		for len(args) > 0 {
+			arg := args[0].value
+			if arg == "--" {
+				args = args[1:]
+				break
+			}
+			if name == "env" && strings.Contains(arg, "=") && !strings.HasPrefix(arg, "-") {
+				args = args[1:]
+				continue
+			}
+			if !strings.HasPrefix(arg, "-") || arg == "-" {
+				break
+			}
+			// command -v and -V only look the command up
+			if name == "command" && (arg == "-v" || arg == "-V") {
+				return nil, privileged
+			}
+			args = args[1:]
+			if longArgOpts[arg] && len(args) > 0 {
+				args = args[1:]
+				continue
+			}
+			if !strings.HasPrefix(arg, "--") {
+				for i := 1; i < len(arg); i++ {
+					if strings.IndexByte(w.argOpts, arg[i]) >= 0 {
+						if i == len(arg)-1 && len(args) > 0 {
+							args = args[1:]
+						}
+						break
+					}
+				}
+			}
+		}
+
+		for i := 0; i < w.operands && len(args) > 0; i++ {
+			args = args[1:]
+		}
+	}
+	return args, privileged
+}
+
+// downloaders fetch content that may end up executed
+var downloaders = map[string]bool{"curl": true, "wget": true, "fetch": true}
+
+// shellInterpreters run scripts read from stdin or a file
+var shellInterpreters = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "fish": true,
+	"python": true, "python3": true, "perl": true, "ruby": true, "node": true,
+}
+
+// readOnlySystemctl lists systemctl subcommands that change nothing
+var readOnlySystemctl = map[string]bool{
+	"status": true, "show": true, "cat": true, "list-units": true, "list-unit-files": true,
+	"list-timers": true, "is-active": true, "is-enabled": true, "is-failed": true, "": true,
+}
+
+// safeDevices can be written to without touching hardware
+var safeDevices = []string{"/dev/null", "/dev/zero", "/dev/stdout", "/dev/stderr", "/dev/stdin", "/dev/tty", "/dev/fd/", "/dev/pts/", "/dev/shm/", "/dev/tcp/", "/dev/udp/"}
+
+// isDevicePath reports whether p is a device file other than harmless ones
+// like /dev/null
+func isDevicePath(p string) bool {
+	if !strings.HasPrefix(p, "/dev/") {
+		return false
+	}
+	for _, safe := range safeDevices {
+		if p == safe || strings.HasSuffix(safe, "/") && strings.HasPrefix(p, safe) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCriticalPath reports whether p is the root directory, the home
+// directory, a top-level directory such as /etc, or everything in one of them
+func isCriticalPath(p string) bool {
+	p = strings.TrimSuffix(p, "*")
+	p = strings.TrimRight(p, "/")
+	switch p {
+	case "", "~", "$HOME":
+		return true
+	}
+	return strings.HasPrefix(p, "/") && strings.Count(p, "/") == 1
+}
+
+// isWorldWritableMode reports whether a chmod mode grants write access to
+// everyone, like 777 or a+rwx
+func isWorldWritableMode(mode string) bool {
+	if n, err := strconv.ParseUint(mode, 8, 32); err == nil && len(mode) >= 3 {
+		return n&0o002 != 0
+	}
+	for _, clause := range strings.Split(mode, ",") {
+		if i := strings.IndexAny(clause, "+="); i >= 0 {
+			who, perms := clause[:i], clause[i+1:]
+			if (who == "" || strings.ContainsAny(who, "ao")) && strings.Contains(perms, "w") && strings.Contains(perms, "x") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasSignalKill reports whether kill arguments send SIGKILL
+func hasSignalKill(args []shellWord) bool {
+	for i, arg := range args {
+		switch arg.value {
+		case "-9", "-KILL", "-SIGKILL":
+			return true
+		case "-s", "--signal":
+			if i+1 < len(args) && (args[i+1].value == "9" || strings.TrimPrefix(args[i+1].value, "SIG") == "KILL") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasShortFlag reports whether flag appears in a cluster of short options,
+// like r in -rf
+func hasShortFlag(args []shellWord, flag byte) bool {
+	for _, arg := range args {
+		if arg.value == "--" {
+			return false
+		}
+		if len(arg.value) > 1 && arg.value[0] == '-' && arg.value[1] != '-' && strings.IndexByte(arg.value[1:], flag) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasArg reports whether an argument equals value
+func hasArg(args []shellWord, value string) bool {
+	for _, arg := range args {
+		if arg.value == value {
+			return true
+		}
+	}
+	return false
+}
+
+// positional returns the arguments that aren't options
+func positional(args []shellWord) []shellWord {
+	var operands []shellWord
+	afterDashes := false
+	for _, arg := range args {
+		switch {
+		case afterDashes:
+			operands = append(operands, arg)
+		case arg.value == "--":
+			afterDashes = true
+		case !strings.HasPrefix(arg.value, "-") || arg.value == "-":
+			operands = append(operands, arg)
+		}
+	}
+	return operands
+}
+
+// firstPositional returns the first argument that isn't an option, such as
+// a subcommand
+func firstPositional(args []shellWord) string {
+	if operands := positional(args); len(operands) > 0 {
+		return operands[0].value
+	}
+	return ""
+}
+
+// optionValue returns the argument following option
+func optionValue(args []shellWord, option string) (shellWord, bool) {
+	for i, arg := range args {
+		if arg.value == option && i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return shellWord{}, false
+}
+
+// joinWords joins word values with spaces, as eval does
+func joinWords(words []shellWord) string {
+	values := make([]string, len(words))
+	for i, w := range words {
+		values[i] = w.value
+	}
+	return strings.Join(values, " ")
+}
+
+// unescapeLit removes the backslashes the shell would, so r\m reads as rm.
+// Inside double quotes a backslash only escapes $, `, ", \ and newline.
+func unescapeLit(s string, quoted bool) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			next := s[i+1]
+			if !quoted || strings.IndexByte("$`\"\\\n", next) >= 0 {
+				i++
+				if next != '\n' {
+					b.WriteByte(next)
+				}
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// unescapeANSIC expands the escapes in $'...' strings and printf formats
+func unescapeANSIC(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'x':
+			j := i + 1
+			for j < len(s) && j < i+3 && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			if n, err := strconv.ParseUint(s[i+1:j], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				i = j - 1
+			} else {
+				b.WriteString(`\x`)
+			}
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			n, _ := strconv.ParseUint(s[i:j], 8, 8)
+			b.WriteByte(byte(n))
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
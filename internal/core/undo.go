@@ -0,0 +1,374 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/traves/linesense/internal/config"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// undoRule works out how to reverse a command through c. ok is false when
+// the rule doesn't know the command.
+type undoRule func(c *undoCall) (hint UndoHint, ok bool)
+
+// undoRules are the local undo rules, keyed by command name
+var undoRules = map[string]undoRule{
+	"git":   undoGit,
+	"mv":    undoMv,
+	"chmod": undoChmod,
+}
+
+// undoCall is a command being reversed. words are the command's words
+// after wrappers such as sudo, and args their resolved values.
+type undoCall struct {
+	src   string
+	words []*syntax.Word
+	args  []shellWord
+	cwd   string
+}
+
+// UndoFor returns how to reverse command according to the local rules for
+// git, mv and chmod. ok is false when they don't know the command. cwd is
+// where the command runs; chmod reads the modes it would replace there.
+func UndoFor(command, cwd string) (UndoHint, bool) {
+	words, args, ok := singleCall(command)
+	if !ok {
+		return UndoHint{}, false
+	}
+	rule, ok := undoRules[path.Base(args[0].value)]
+	if !ok {
+		return UndoHint{}, false
+	}
+	return rule(&undoCall{src: command, words: words, args: args, cwd: cwd})
+}
+
+// setUndo attaches hint to suggestion, dropping an undo command that
+// matches the denylist
+func setUndo(suggestion *Suggestion, hint UndoHint, cfg *config.SafetyConfig) {
+	suggestion.Undo, suggestion.Irreversible = hint.Undo, hint.Irreversible
+	if suggestion.Undo != "" && IsBlocked(suggestion.Undo, cfg) {
+		suggestion.Undo = ""
+	}
+}
+
+// ApplyUndoRules attaches the local undo hint for suggestion's command, or
+// clears a hint that no longer applies, as after the command was edited
+func ApplyUndoRules(suggestion *Suggestion, cwd string, cfg *config.SafetyConfig) {
+	hint, _ := UndoFor(suggestion.Command, cwd)
+	setUndo(suggestion, hint, cfg)
+}
+
+// irreversible is the hint for commands that can't be undone
+var irreversible = UndoHint{Irreversible: true}
+
+// undo returns a hint with the undo command formed by the prefix of word i
+// followed by parts
+func (c *undoCall) undo(i int, parts ...string) (UndoHint, bool) {
+	return UndoHint{Undo: c.prefix(i) + strings.Join(parts, " ")}, true
+}
+
+// prefix returns the text before word i, such as "sudo " or "git -C repo "
+func (c *undoCall) prefix(i int) string {
+	return strings.TrimLeft(c.src[:c.words[i].Pos().Offset()], " \t")
+}
+
+// text returns word i as written
+func (c *undoCall) text(i int) string {
+	return c.src[c.words[i].Pos().Offset():c.words[i].End().Offset()]
+}
+
+// operands returns the indexes of the arguments from start on that aren't
+// options or the values of those in valueFlags
+func (c *undoCall) operands(start int, valueFlags map[string]bool) []int {
+	var indexes []int
+	for i := start; i < len(c.args); i++ {
+		arg := c.args[i].value
+		switch {
+		case arg == "--":
+			for j := i + 1; j < len(c.args); j++ {
+				indexes = append(indexes, j)
+			}
+			return indexes
+		case valueFlags[arg]:
+			i++
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// texts returns the words at indexes as written
+func (c *undoCall) texts(indexes []int) []string {
+	texts := make([]string, len(indexes))
+	for j, i := range indexes {
+		texts[j] = c.text(i)
+	}
+	return texts
+}
+
+// optionValue returns the index of the value of the first of options, given
+// as the next argument
+func (c *undoCall) optionValue(start int, options ...string) (int, bool) {
+	for i := start; i < len(c.args)-1; i++ {
+		for _, option := range options {
+			if c.args[i].value == option {
+				return i + 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// undoGit reverses git commands that create or move refs, and flags those
+// that throw work away
+func undoGit(c *undoCall) (UndoHint, bool) {
+	sub := subcommandIndex(c.args, gitValueFlags)
+	if sub < 0 {
+		return UndoHint{}, false
+	}
+	args := c.args[sub+1:]
+	operands := c.operands(sub+1, nil)
+
+	switch c.args[sub].value {
+	case "checkout", "switch":
+		if i, ok := c.optionValue(sub+1, "-b", "-c", "--create"); ok {
+			// Go back, then delete the new branch
+			return c.undo(sub, c.args[sub].value, "- &&", c.prefix(sub)+"branch -d", c.text(i))
+		}
+		if c.args[sub].value == "checkout" && (hasArg(args, "--") || hasArg(args, ".")) || hasArg(args, "--discard-changes") || hasShortFlag(args, 'f') || hasArg(args, "--force") {
+			return irreversible, true // discards uncommitted changes
+		}
+		if c.args[sub].value == "switch" && len(operands) == 1 {
+			return c.undo(sub, "switch -")
+		}
+	case "branch":
+		if i, ok := c.optionValue(sub+1, "-m", "-M", "--move"); ok && i+1 < len(c.args) {
+			return c.undo(sub, "branch -m", c.text(i+1), c.text(i))
+		}
+		if len(args) == len(operands) && len(operands) >= 1 && len(operands) <= 2 {
+			return c.undo(sub, "branch -d", c.text(operands[0]))
+		}
+	case "tag":
+		if len(args) == len(operands) && len(operands) >= 1 && len(operands) <= 2 {
+			return c.undo(sub, "tag -d", c.text(operands[0]))
+		}
+	case "add":
+		if hasShortFlag(args, 'A') || hasArg(args, "--all") || len(operands) == 0 {
+			return c.undo(sub, "reset")
+		}
+		return c.undo(sub, append([]string{"restore --staged --"}, c.texts(operands)...)...)
+	case "commit":
+		if hasArg(args, "--amend") {
+			return c.undo(sub, "reset --soft HEAD@{1}")
+		}
+		return c.undo(sub, "reset --soft HEAD~1")
+	case "reset":
+		switch {
+		case hasArg(args, "--hard"):
+			return irreversible, true // uncommitted changes are lost
+		case hasArg(args, "--soft"):
+			return c.undo(sub, "reset --soft ORIG_HEAD")
+		}
+	case "merge", "rebase", "pull":
+		// ORIG_HEAD is where the branch was before
+		for _, arg := range args {
+			switch arg.value {
+			case "--continue", "--abort", "--skip", "--quit", "--edit-todo", "--show-current-patch":
+				return UndoHint{}, false
+			}
+		}
+		if c.args[sub].value == "rebase" || hasArg(args, "--rebase") {
+			return c.undo(sub, "reset --hard ORIG_HEAD")
+		}
+		return c.undo(sub, "reset --merge ORIG_HEAD")
+	case "stash":
+		action := "push"
+		if operands := c.operands(sub+1, map[string]bool{"-m": true, "--message": true}); len(operands) > 0 {
+			action = c.args[operands[0]].value
+		}
+		switch action {
+		case "push", "save":
+			return c.undo(sub, "stash pop")
+		case "drop", "clear":
+			return irreversible, true
+		}
+	case "clean":
+		if !hasShortFlag(args, 'n') && !hasArg(args, "--dry-run") {
+			return irreversible, true // untracked files are deleted
+		}
+	case "restore":
+		staged := hasShortFlag(args, 'S') || hasArg(args, "--staged")
+		worktree := hasShortFlag(args, 'W') || hasArg(args, "--worktree")
+		if staged && !worktree {
+			return c.undo(sub, append([]string{"add --"}, c.texts(operands)...)...)
+		}
+		return irreversible, true // discards uncommitted changes
+	case "push":
+		if hasShortFlag(args, 'f') || hasArg(args, "--force") || hasArgPrefix(args, "--force-with-lease") {
+			return irreversible, true // overwritten remote commits may be lost for good
+		}
+	case "rm":
+		if hasArg(args, "--cached") {
+			return c.undo(sub, append([]string{"add --"}, c.texts(operands)...)...)
+		}
+	}
+	return UndoHint{}, false
+}
+
+// undoMv moves files back where they came from. Files the move overwrote
+// can't be brought back.
+func undoMv(c *undoCall) (UndoHint, bool) {
+	if hasShortFlag(c.args[1:], 'b') || hasArgPrefix(c.args[1:], "--backup") || hasArgPrefix(c.args[1:], "--target-directory") {
+		return UndoHint{}, false
+	}
+	operands := c.operands(1, map[string]bool{"-S": true, "--suffix": true, "-t": true})
+	for _, i := range operands {
+		if !c.args[i].static || c.args[i].glob {
+			return UndoHint{}, false
+		}
+	}
+
+	// With -t DIR every operand is a source; otherwise the last is the target
+	var target string
+	var sources []int
+	if i, ok := c.optionValue(1, "-t"); ok {
+		target, sources = c.args[i].value, operands
+	} else if len(operands) >= 2 {
+		target, sources = c.args[operands[len(operands)-1]].value, operands[:len(operands)-1]
+	} else {
+		return UndoHint{}, false
+	}
+	if len(sources) == 0 {
+		return UndoHint{}, false
+	}
+
+	// mv a b renames, unless b is a directory; mv a b/ and mv a b c/ move
+	// into the directory
+	intoDir := len(sources) > 1 || strings.HasSuffix(target, "/") || c.isDir(target)
+	if !intoDir {
+		return c.undo(0, c.text(0), shellQuote(target), c.text(sources[0]))
+	}
+
+	dir := path.Dir(strings.TrimSuffix(c.args[sources[0]].value, "/"))
+	moved := make([]string, 0, len(sources)+1)
+	for _, i := range sources {
+		source := strings.TrimSuffix(c.args[i].value, "/")
+		if path.Dir(source) != dir {
+			return UndoHint{}, false
+		}
+		moved = append(moved, shellQuote(path.Join(target, path.Base(source))))
+	}
+	return c.undo(0, append(append([]string{c.text(0)}, moved...), shellQuote(dir))...)
+}
+
+// isDir reports whether name is a directory, relative to the working
+// directory
+func (c *undoCall) isDir(name string) bool {
+	if c.cwd == "" {
+		return false
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(c.cwd, name)
+	}
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
+
+// undoChmod inverts symbolic modes, u+x becoming u-x, and otherwise restores
+// the mode the files have now, when they all have the same one
+func undoChmod(c *undoCall) (UndoHint, bool) {
+	if hasArgPrefix(c.args[1:], "--reference") {
+		return UndoHint{}, false
+	}
+	operands := c.operands(1, nil)
+	if len(operands) < 2 {
+		return UndoHint{}, false
+	}
+	mode, files := c.args[operands[0]], operands[1:]
+	recursive := hasShortFlag(c.args[1:], 'R') || hasArg(c.args[1:], "--recursive")
+
+	var options []string
+	for i := 1; i < operands[0]; i++ {
+		options = append(options, c.text(i))
+	}
+
+	if inverse, ok := invertMode(mode.value); ok && mode.static {
+		if strings.HasPrefix(inverse, "-") {
+			inverse = "-- " + inverse // or it would read as an option
+		}
+		return c.undo(0, append(append(append([]string{c.text(0)}, options...), inverse), c.texts(files)...)...)
+	}
+
+	// An absolute mode replaces the old ones, which are only known for the
+	// files named on the command line
+	if recursive || c.cwd == "" {
+		return UndoHint{}, false
+	}
+	var previous os.FileMode
+	for j, i := range files {
+		if !c.args[i].static || c.args[i].glob {
+			return UndoHint{}, false
+		}
+		name := c.args[i].value
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(c.cwd, name)
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return UndoHint{}, false
+		}
+		current := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if j > 0 && current != previous {
+			return UndoHint{}, false
+		}
+		previous = current
+	}
+	return c.undo(0, append([]string{c.text(0), octalMode(previous)}, c.texts(files)...)...)
+}
+
+// invertMode swaps + and - in a symbolic mode such as u+x,go-w. ok is false
+// for modes that set permissions outright, like 755 or u=rw.
+func invertMode(mode string) (string, bool) {
+	if mode == "" || strings.ContainsAny(mode, "=01234567") {
+		return "", false
+	}
+	inverse := []byte(mode)
+	for i, ch := range inverse {
+		switch ch {
+		case '+':
+			inverse[i] = '-'
+		case '-':
+			inverse[i] = '+'
+		}
+	}
+	return string(inverse), true
+}
+
+// shellQuote quotes s for the shell when it needs quoting
+func shellQuote(s string) string {
+	if quoted, err := syntax.Quote(s, syntax.LangBash); err == nil {
+		return quoted
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// octalMode formats mode's permission bits for chmod, with setuid, setgid
+// and sticky as the leading digit
+func octalMode(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
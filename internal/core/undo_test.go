@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+func TestUndoFor(t *testing.T) {
+	cwd := t.TempDir()
+	if err := os.Mkdir(filepath.Join(cwd, "archive"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, mode := range map[string]os.FileMode{"run.sh": 0640, "a.sh": 0755, "b.sh": 0755, "c.sh": 0700} {
+		if err := os.WriteFile(filepath.Join(cwd, name), nil, mode); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(filepath.Join(cwd, name), mode) // regardless of umask
+	}
+
+	tests := []struct {
+		command          string
+		wantUndo         string
+		wantIrreversible bool
+		wantOK           bool
+	}{
+		{"git checkout -b feature", "git checkout - && git branch -d feature", false, true},
+		{"git -C repo switch -c fix origin/main", "git -C repo switch - && git -C repo branch -d fix", false, true},
+		{"git switch main", "git switch -", false, true},
+		{"git branch topic", "git branch -d topic", false, true},
+		{"git branch -m old new", "git branch -m new old", false, true},
+		{"git add src/main.go 'my file'", "git restore --staged -- src/main.go 'my file'", false, true},
+		{"git add -A", "git reset", false, true},
+		{`git commit -m "wip"`, "git reset --soft HEAD~1", false, true},
+		{"git commit --amend --no-edit", "git reset --soft HEAD@{1}", false, true},
+		{"git reset --hard HEAD~1", "", true, true},
+		{"git reset --soft HEAD~2", "git reset --soft ORIG_HEAD", false, true},
+		{"git merge feature", "git reset --merge ORIG_HEAD", false, true},
+		{"git rebase -i main", "git reset --hard ORIG_HEAD", false, true},
+		{"git rebase --continue", "", false, false},
+		{"git stash", "git stash pop", false, true},
+		{"git stash push -m wip", "git stash pop", false, true},
+		{"git stash drop", "", true, true},
+		{"git clean -fd", "", true, true},
+		{"git clean -n", "", false, false},
+		{"git checkout -- file.go", "", true, true},
+		{"git restore --staged file.go", "git add -- file.go", false, true},
+		{"git restore file.go", "", true, true},
+		{"git push --force origin main", "", true, true},
+		{"git rm --cached secrets.env", "git add -- secrets.env", false, true},
+		{"git status", "", false, false},
+		{"mv old.txt new.txt", "mv new.txt old.txt", false, true},
+		{"sudo mv /etc/app.conf /etc/app.conf.bak", "sudo mv /etc/app.conf.bak /etc/app.conf", false, true},
+		{"mv notes.txt archive", "mv archive/notes.txt .", false, true},
+		{"mv src/a.go src/b.go pkg/", "mv pkg/a.go pkg/b.go src", false, true},
+		{"mv -t archive a b", "mv archive/a archive/b .", false, true},
+		{"mv 'my file' dest", "mv dest 'my file'", false, true},
+		{"mv *.log logs/", "", false, false},
+		{"chmod +x run.sh", "chmod -- -x run.sh", false, true},
+		{"chmod -R go-w,u+x bin", "chmod -R go+w,u-x bin", false, true},
+		{"chmod 755 run.sh", "chmod 0640 run.sh", false, true},
+		{"chmod 600 a.sh b.sh", "chmod 0755 a.sh b.sh", false, true},
+		{"chmod 600 a.sh c.sh", "", false, false},
+		{"chmod -R 755 archive", "", false, false},
+		{"chmod u=rw missing", "", false, false},
+		{"rm -rf build", "", false, false},
+		{"git checkout -b x && make", "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			hint, ok := UndoFor(tt.command, cwd)
+			if ok != tt.wantOK || hint.Undo != tt.wantUndo || hint.Irreversible != tt.wantIrreversible {
+				t.Errorf("UndoFor(%q) = %+v, %v, want undo %q, irreversible %v, %v", tt.command, hint, ok, tt.wantUndo, tt.wantIrreversible, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestEngine_SuggestUndo(t *testing.T) {
+	cfg := &config.Config{Safety: config.SafetyConfig{Denylist: []string{`^sudo systemctl start`}}}
+	provider := &fakeProvider{
+		suggestions: []Suggestion{
+			{Command: "git checkout -b feature", Undo: "git branch -D feature"},
+			{Command: "rm -rf build", Irreversible: true},
+			{Command: "sudo systemctl stop nginx", Undo: "sudo systemctl start nginx"},
+			{Command: "ls -la"},
+		},
+	}
+	engine := NewEngine(cfg, provider)
+
+	env := &ContextEnvelope{Shell: "bash", Line: "clean up", CWD: t.TempDir()}
+	suggestions, err := engine.Suggest(context.Background(), SuggestInput{Context: env})
+	if err != nil {
+		t.Fatalf("Suggest() error = %v", err)
+	}
+
+	// The local rules win over the model's hint
+	if suggestions[0].Undo != "git checkout - && git branch -d feature" {
+		t.Errorf("local undo = %q", suggestions[0].Undo)
+	}
+	if !suggestions[1].Irreversible {
+		t.Errorf("model hint not kept: %+v", suggestions[1])
+	}
+	if suggestions[2].Undo != "" {
+		t.Errorf("denylisted undo = %q, want it dropped", suggestions[2].Undo)
+	}
+	if suggestions[3].Undo != "" || suggestions[3].Irreversible {
+		t.Errorf("read-only suggestion got a hint: %+v", suggestions[3])
+	}
+}
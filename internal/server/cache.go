@@ -0,0 +1,86 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// cache is a small in-memory response cache with per-entry expiry
+type cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	max     int
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// newCache creates a cache holding at most max entries
+func newCache(max int) *cache {
+	return &cache{
+		entries: make(map[string]cacheEntry),
+		max:     max,
+	}
+}
+
+// get returns the cached value for key if it has not expired
+func (c *cache) get(key string, now time.Time) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// put stores value under key for ttl. When the cache is full, expired entries
+// are dropped first, then the entry closest to expiring.
+func (c *cache) put(key string, value interface{}, ttl time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.max {
+		c.evict(now)
+	}
+	c.entries[key] = cacheEntry{value: value, expires: now.Add(ttl)}
+}
+
+// evict makes room for one entry; the caller holds c.mu
+func (c *cache) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || entry.expires.Before(oldest) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	if len(c.entries) >= c.max && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// clear removes every entry
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cacheEntry)
+}
+
+// len returns the number of entries, including expired ones not yet dropped
+func (c *cache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/traves/linesense/internal/core"
+)
+
+// dialTimeout bounds how long Dial waits for the daemon to accept and, when
+// checking its version, to answer
+const dialTimeout = 200 * time.Millisecond
+
+// Client calls a running daemon. Each call uses its own connection, so a
+// Client can be used from several goroutines.
+type Client struct {
+	path string
+}
+
+// UnavailableError is returned by calls that got no usable answer from the
+// daemon: it couldn't be reached, stopped while answering, or didn't
+// understand the request. The same call can be retried in process.
+type UnavailableError struct {
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// Dial returns a client for the daemon listening on path, or an error if no
+// daemon is accepting connections there. If version is set, a daemon that
+// doesn't answer a status request or runs another version is refused too,
+// since it may not know the fields of newer requests and results.
+func Dial(path, version string) (*Client, error) {
+	client := &Client{path: path}
+
+	if version == "" {
+		conn, err := net.DialTimeout("unix", path, dialTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("daemon is not running: %w", err)
+		}
+		conn.Close()
+		return client, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("daemon is not running: %w", err)
+	}
+	if status.Version != version {
+		return nil, fmt.Errorf("daemon is running version %s, not %s", status.Version, version)
+	}
+	return client, nil
+}
+
+// Call invokes method with params and decodes the result into result.
+// Canceling ctx closes the connection, which stops the request in the daemon.
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.path)
+	if err != nil {
+		return c.callError(ctx, fmt.Errorf("failed to connect to daemon: %w", err))
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	paramsData, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal params: %w", err)
+	}
+	req := rpcRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: method, Params: paramsData}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return c.callError(ctx, fmt.Errorf("failed to send request: %w", err))
+	}
+
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return c.callError(ctx, fmt.Errorf("failed to read response: %w", err))
+	}
+
+	var resp rpcResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return &UnavailableError{Err: fmt.Errorf("failed to parse response: %w", err)}
+	}
+	if resp.Error != nil {
+		switch resp.Error.Code {
+		case CodeParseError, CodeInvalidRequest, CodeMethodNotFound:
+			// An older daemon that doesn't know the request
+			return &UnavailableError{Err: resp.Error}
+		}
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("failed to parse result: %w", err)
+	}
+	return nil
+}
+
+// callError reports cancellation instead of the I/O error it caused, and
+// the daemon as unavailable otherwise
+func (c *Client) callError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return &UnavailableError{Err: err}
+}
+
+// Suggest generates command suggestions in the daemon
+func (c *Client) Suggest(ctx context.Context, input core.SuggestInput) ([]core.Suggestion, error) {
+	var result SuggestResult
+	if err := c.Call(ctx, "suggest", input, &result); err != nil {
+		return nil, err
+	}
+	return result.Suggestions, nil
+}
+
+// Explain generates an explanation in the daemon
+func (c *Client) Explain(ctx context.Context, input core.ExplainInput) (core.Explanation, error) {
+	var result core.Explanation
+	if err := c.Call(ctx, "explain", input, &result); err != nil {
+		return core.Explanation{}, err
+	}
+	return result, nil
+}
+
+// Fix generates corrected versions of a failed command in the daemon
+func (c *Client) Fix(ctx context.Context, input core.FixInput) ([]core.Suggestion, error) {
+	var result FixResult
+	if err := c.Call(ctx, "fix", input, &result); err != nil {
+		return nil, err
+	}
+	return result.Suggestions, nil
+}
+
+// Complete completes the current line in the daemon
+func (c *Client) Complete(ctx context.Context, input core.CompleteInput) (core.Completion, error) {
+	var result core.Completion
+	if err := c.Call(ctx, "complete", input, &result); err != nil {
+		return core.Completion{}, err
+	}
+	return result, nil
+}
+
+// Status reports on the running daemon
+func (c *Client) Status(ctx context.Context) (StatusResult, error) {
+	var result StatusResult
+	if err := c.Call(ctx, "status", struct{}{}, &result); err != nil {
+		return StatusResult{}, err
+	}
+	return result, nil
+}
+
+// Shutdown asks the daemon to exit
+func (c *Client) Shutdown(ctx context.Context) error {
+	return c.Call(ctx, "shutdown", struct{}{}, nil)
+}
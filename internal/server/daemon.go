@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SocketPath returns the per-user daemon socket: $LINESENSE_SOCKET if set,
+// otherwise linesense.sock in $XDG_RUNTIME_DIR, otherwise
+// linesense-<uid>/daemon.sock in the temp directory
+func SocketPath() string {
+	if path := os.Getenv("LINESENSE_SOCKET"); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "linesense.sock")
+	}
+	return filepath.Join(os.TempDir(), "linesense-"+strconv.Itoa(os.Getuid()), "daemon.sock")
+}
+
+// Listen creates the daemon socket at path. The socket's directory is created
+// if needed and must not be accessible by other users. A stale socket left by
+// a daemon that exited is replaced; a live one is an error.
+func Listen(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	// Don't follow symlinks: the directory itself must be private
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check socket directory: %w", err)
+	}
+	if !info.IsDir() || info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("socket directory %s must be a directory accessible only by you (mode 0700)", dir)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("daemon is already running on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	return listener, nil
+}
+
+// shutdownGrace is how long Serve waits for open connections to finish after
+// it stops accepting new ones
+const shutdownGrace = 2 * time.Second
+
+// Serve answers JSON-RPC connections on listener until ctx is canceled or a
+// client calls the shutdown method. Requests still running are canceled, and
+// connections that stay open past a short grace period are closed.
+func Serve(ctx context.Context, listener net.Listener, svc *Service) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	svc.onShutdown(cancel)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	conns := make(map[net.Conn]struct{})
+	defer func() {
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(shutdownGrace):
+			mu.Lock()
+			for conn := range conns {
+				conn.Close()
+			}
+			mu.Unlock()
+			<-done
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = serveConn(ctx, conn, conn, svc.Call, true)
+
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
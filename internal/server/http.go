@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+// maxRequestBody bounds the size of an HTTP API request body
+const maxRequestBody = 1 << 20
+
+// httpMethods maps HTTP API paths to service methods
+var httpMethods = map[string]string{
+	"/v1/suggest": "suggest",
+	"/v1/explain": "explain",
+}
+
+// TokenPath returns the file holding the HTTP API bearer token
+func TokenPath() string {
+	return filepath.Join(config.GetConfigDir(), "http_token")
+}
+
+// LoadOrCreateToken reads the bearer token from path. If the file doesn't
+// exist, a random token is generated and saved there with mode 0600; created
+// reports whether that happened. A token file other users can read is refused.
+func LoadOrCreateToken(path string) (token string, created bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return "", false, fmt.Errorf("failed to generate token: %w", err)
+		}
+		token = hex.EncodeToString(buf)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return "", false, fmt.Errorf("failed to create config directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+			return "", false, fmt.Errorf("failed to write token file: %w", err)
+		}
+		return token, true, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check token file: %w", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return "", false, fmt.Errorf("token file %s must not be accessible by other users (chmod 600)", path)
+	}
+
+	token = strings.TrimSpace(string(data))
+	if token == "" {
+		return "", false, fmt.Errorf("token file %s is empty", path)
+	}
+	return token, false, nil
+}
+
+// NewHTTPHandler returns the HTTP API: POST /v1/suggest and POST /v1/explain
+// take the same params as the JSON-RPC methods and return the same JSON as
+// `--format json`. Every request must carry the bearer token and is logged to
+// logger. svc is limited to the context sent with each request.
+func NewHTTPHandler(svc *Service, token string, logger *log.Logger) http.Handler {
+	svc.LimitContextToRequest()
+
+	api := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !validBearer(r.Header.Get("Authorization"), token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="linesense"`)
+			writeHTTPError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+
+		method, ok := httpMethods[r.URL.Path]
+		if !ok {
+			writeHTTPError(w, http.StatusNotFound, "not found")
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeHTTPError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			writeHTTPError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+
+		// The request context ends when the client disconnects
+		result, err := svc.Call(r.Context(), method, body)
+		if err != nil {
+			writeHTTPError(w, httpStatus(err), err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	})
+
+	return logRequests(api, logger)
+}
+
+// ServeHTTP serves handler on listener until ctx is canceled, then lets
+// running requests finish for a short grace period
+func ServeHTTP(ctx context.Context, listener net.Listener, handler http.Handler) error {
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("HTTP server failed: %w", err)
+	}
+	return nil
+}
+
+// validBearer reports whether header is "Bearer <token>"
+func validBearer(header, token string) bool {
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return false
+	}
+	given := strings.TrimSpace(header[len(prefix):])
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// httpStatus maps a service error to an HTTP status code
+func httpStatus(err error) int {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.Code {
+		case CodeParseError, CodeInvalidRequest, CodeInvalidParams:
+			return http.StatusBadRequest
+		case CodeMethodNotFound:
+			return http.StatusNotFound
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// writeHTTPError writes {"error": message} with the given status
+func writeHTTPError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs the method, path, status, duration and client of every
+// request. Request bodies are not logged since they contain the user's
+// commands and environment.
+func logRequests(next http.Handler, logger *log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		logger.Printf("%s %s %d %s %s", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond), r.RemoteAddr)
+	})
+}
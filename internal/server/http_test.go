@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/traves/linesense/internal/config"
+	"github.com/traves/linesense/internal/core"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	var logs bytes.Buffer
+	handler := NewHTTPHandler(NewService("test"), "secret", log.New(&logs, "", 0))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		auth       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"no token", "POST", "/v1/suggest", "", `{}`, http.StatusUnauthorized, "missing or invalid bearer token"},
+		{"wrong token", "POST", "/v1/suggest", "Bearer nope", `{}`, http.StatusUnauthorized, "missing or invalid bearer token"},
+		{"unknown path", "POST", "/v1/run", "Bearer secret", `{}`, http.StatusNotFound, "not found"},
+		{"wrong method", "GET", "/v1/explain", "Bearer secret", "", http.StatusMethodNotAllowed, "method not allowed"},
+		{"bad json", "POST", "/v1/explain", "bearer secret", `{`, http.StatusBadRequest, "invalid params"},
+		{"no context", "POST", "/v1/suggest", "Bearer secret", `{"model_id":"x"}`, http.StatusBadRequest, "context is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			body, _ := io.ReadAll(rec.Body)
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	if got := strings.Count(logs.String(), "\n"); got != len(tests) {
+		t.Errorf("logged %d requests, want %d:\n%s", got, len(tests), logs.String())
+	}
+	if !strings.Contains(logs.String(), "POST /v1/suggest 401") {
+		t.Errorf("log should include method, path and status:\n%s", logs.String())
+	}
+}
+
+// fakeProvider suggests and explains the commands it is given
+type fakeProvider struct {
+	suggestions []core.Suggestion
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) Suggest(context.Context, core.SuggestInput) ([]core.Suggestion, error) {
+	return p.suggestions, nil
+}
+
+func (p *fakeProvider) Explain(context.Context, core.ExplainInput) (core.Explanation, error) {
+	return core.Explanation{Summary: "deletes files", Risk: core.RiskLow}, nil
+}
+
+func (p *fakeProvider) Fix(context.Context, core.FixInput) ([]core.Suggestion, error) {
+	return p.suggestions, nil
+}
+
+func (p *fakeProvider) Complete(context.Context, core.CompleteInput) (string, error) {
+	return "", nil
+}
+
+func TestHTTPHandler_IgnoresRequestCWD(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	// A directory of the server's user, named as the working directory
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "secret.sh"), nil, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := os.WriteFile(filepath.Join(dir, "data", fmt.Sprintf("f%d", i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newService := func() *Service {
+		svc := NewService("test")
+		svc.cfg = &config.Config{}
+		svc.provider = &fakeProvider{suggestions: []core.Suggestion{{Command: "chmod 755 secret.sh", Risk: core.RiskLow}}}
+		return svc
+	}
+	suggest := `{"model_id":"x","prompt":"p","context":{"shell":"bash","line":"p","cwd":"` + dir + `"}}`
+	explain := `{"model_id":"x","prompt":"p","context":{"shell":"bash","line":"rm -r data","cwd":"` + dir + `"}}`
+
+	// Locally, the file's mode and the number of files are looked up
+	local := newService()
+	for _, call := range []struct{ method, params, want string }{
+		{"suggest", suggest, "chmod 0640 secret.sh"},
+		{"explain", explain, `"targets":4`},
+	} {
+		result, err := local.Call(context.Background(), call.method, []byte(call.params))
+		if err != nil {
+			t.Fatalf("%s error = %v", call.method, err)
+		}
+		if body, _ := json.Marshal(result); !strings.Contains(string(body), call.want) {
+			t.Fatalf("local %s = %s, want it to contain %q", call.method, body, call.want)
+		}
+	}
+
+	// Over HTTP, nothing on the server is looked at
+	handler := NewHTTPHandler(newService(), "secret", log.New(io.Discard, "", 0))
+	for _, call := range []struct{ path, body, unwanted string }{
+		{"/v1/suggest", suggest, "0640"},
+		{"/v1/explain", explain, "targets"},
+	} {
+		req := httptest.NewRequest("POST", call.path, strings.NewReader(call.body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		body, _ := io.ReadAll(rec.Body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s status = %d: %s", call.path, rec.Code, body)
+		}
+		if strings.Contains(string(body), call.unwanted) {
+			t.Errorf("%s = %s, want no %q from the server's files", call.path, body, call.unwanted)
+		}
+	}
+}
+
+func TestLoadOrCreateToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "linesense", "http_token")
+
+	token, created, err := LoadOrCreateToken(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateToken() error = %v", err)
+	}
+	if !created || len(token) != 64 {
+		t.Errorf("got token %q, created %v; want a new 64-character token", token, created)
+	}
+
+	again, created, err := LoadOrCreateToken(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateToken() error = %v", err)
+	}
+	if created || again != token {
+		t.Errorf("second load = %q, created %v; want the saved token", again, created)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadOrCreateToken(path); err == nil {
+		t.Error("LoadOrCreateToken() should refuse a token file other users can read")
+	}
+}
@@ -0,0 +1,339 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeServerError    = -32000
+
+	// CodeRequestCanceled is returned for requests stopped by the cancel
+	// method (the same code LSP uses)
+	CodeRequestCanceled = -32800
+)
+
+// maxMessageSize bounds a single JSON-RPC message. Requests carry the context
+// envelope, which includes history and environment variables.
+const maxMessageSize = 16 << 20
+
+// RPCError is a JSON-RPC 2.0 error object
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error returns the error message
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// rpcRequest is a JSON-RPC 2.0 request or notification (no ID)
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// handlerFunc answers a single method call
+type handlerFunc func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+// message is one JSON-RPC message and how it was framed on the wire
+type message struct {
+	data   []byte
+	framed bool // sent with a Content-Length header rather than as a line
+}
+
+// serveConn reads JSON-RPC requests from r and writes responses to w.
+// Messages are either single lines of JSON or, as in LSP, preceded by a
+// Content-Length header; each response uses the framing of its request.
+// Requests run concurrently, so responses may arrive out of order, and a
+// request can be stopped with the cancel method. When r reaches EOF, running
+// requests are canceled if cancelOnEOF is set (a socket client that hangs up)
+// and otherwise allowed to finish (stdin closed after the last request).
+func serveConn(ctx context.Context, r io.Reader, w io.Writer, handle handlerFunc, cancelOnEOF bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Read on a separate goroutine so a disconnect is noticed mid-request
+	messages := make(chan message)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(messages)
+		reader := bufio.NewReaderSize(r, 64*1024)
+		for {
+			msg, err := readMessage(reader)
+			if err != nil {
+				if err != io.EOF {
+					readErr <- err
+				}
+				if cancelOnEOF {
+					cancel()
+				}
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var writeMu sync.Mutex
+	var writeErr error
+	write := func(resp rpcResponse, framed bool) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if writeErr == nil {
+			writeErr = writeMessage(w, resp, framed)
+		}
+	}
+
+	// Running requests by ID, so the cancel method can find them
+	var pendingMu sync.Mutex
+	pending := make(map[string]context.CancelFunc)
+
+	var running sync.WaitGroup
+loop:
+	for {
+		var msg message
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				break loop
+			}
+			msg = m
+		case <-ctx.Done():
+			break loop
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(msg.data, &req); err != nil {
+			write(errorResponse(nil, &RPCError{Code: CodeParseError, Message: "parse error"}), msg.framed)
+			continue
+		}
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			write(errorResponse(req.ID, &RPCError{Code: CodeInvalidRequest, Message: "invalid request"}), msg.framed)
+			continue
+		}
+
+		// Cancellation is answered right away, in order with other messages
+		if req.Method == "cancel" {
+			var params struct {
+				ID json.RawMessage `json:"id"`
+			}
+			if err := decodeParams(req.Params, &params); err != nil || params.ID == nil {
+				if req.ID != nil {
+					write(errorResponse(req.ID, &RPCError{Code: CodeInvalidParams, Message: "cancel requires the id of a request"}), msg.framed)
+				}
+				continue
+			}
+
+			pendingMu.Lock()
+			stop, found := pending[idKey(params.ID)]
+			pendingMu.Unlock()
+			if found {
+				stop()
+			}
+			if req.ID != nil {
+				write(resultResponse(req.ID, map[string]bool{"canceled": found}), msg.framed)
+			}
+			continue
+		}
+
+		// An ID must identify one running request, or cancel couldn't tell
+		// which one to stop
+		key := idKey(req.ID)
+		if req.ID != nil {
+			pendingMu.Lock()
+			_, duplicate := pending[key]
+			pendingMu.Unlock()
+			if duplicate {
+				write(errorResponse(req.ID, &RPCError{Code: CodeInvalidRequest, Message: "a request with this id is still running"}), msg.framed)
+				continue
+			}
+		}
+
+		reqCtx, reqCancel := context.WithCancel(ctx)
+		if req.ID != nil {
+			pendingMu.Lock()
+			pending[key] = reqCancel
+			pendingMu.Unlock()
+		}
+
+		running.Add(1)
+		go func(req rpcRequest, framed bool) {
+			defer running.Done()
+			defer reqCancel()
+
+			result, err := handle(reqCtx, req.Method, req.Params)
+
+			if req.ID == nil {
+				return
+			}
+			pendingMu.Lock()
+			delete(pending, key)
+			pendingMu.Unlock()
+
+			switch {
+			case err != nil && reqCtx.Err() != nil:
+				write(errorResponse(req.ID, &RPCError{Code: CodeRequestCanceled, Message: "request canceled"}), framed)
+			case err != nil:
+				write(errorResponse(req.ID, toRPCError(err)), framed)
+			default:
+				write(resultResponse(req.ID, result), framed)
+			}
+		}(req, msg.framed)
+	}
+
+	running.Wait()
+
+	if writeErr != nil {
+		return fmt.Errorf("failed to write response: %w", writeErr)
+	}
+	select {
+	case err := <-readErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// readMessage reads one JSON line or one Content-Length framed message,
+// skipping blank lines
+func readMessage(reader *bufio.Reader) (message, error) {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > maxMessageSize {
+			return message{}, fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+		}
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 {
+			if err != nil {
+				return message{}, err
+			}
+			continue
+		}
+
+		if !hasHeaderPrefix(trimmed) {
+			// A final line without a newline is still a message
+			return message{data: trimmed}, nil
+		}
+
+		// Headers end with an empty line; only Content-Length matters
+		length := -1
+		for {
+			if hasHeaderPrefix(trimmed) {
+				n, convErr := strconv.Atoi(strings.TrimSpace(string(trimmed[len("content-length:"):])))
+				if convErr != nil || n < 0 || n > maxMessageSize {
+					return message{}, fmt.Errorf("invalid Content-Length header: %q", trimmed)
+				}
+				length = n
+			}
+			if err != nil {
+				return message{}, io.ErrUnexpectedEOF
+			}
+			line, err = reader.ReadBytes('\n')
+			trimmed = bytes.TrimSpace(line)
+			if len(trimmed) == 0 && err == nil {
+				break
+			}
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return message{}, io.ErrUnexpectedEOF
+		}
+		return message{data: data, framed: true}, nil
+	}
+}
+
+// hasHeaderPrefix reports whether line is a Content-Length header
+func hasHeaderPrefix(line []byte) bool {
+	const prefix = "content-length:"
+	return len(line) >= len(prefix) && strings.EqualFold(string(line[:len(prefix)]), prefix)
+}
+
+// writeMessage writes resp as a JSON line, or with a Content-Length header
+func writeMessage(w io.Writer, resp rpcResponse, framed bool) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	if framed {
+		_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// idKey normalizes a request ID for lookups
+func idKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+// resultResponse builds a success response
+func resultResponse(id json.RawMessage, result interface{}) rpcResponse {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(id, &RPCError{Code: CodeServerError, Message: fmt.Sprintf("failed to encode result: %v", err)})
+	}
+	return rpcResponse{JSONRPC: "2.0", ID: id, Result: data}
+}
+
+// errorResponse builds an error response, using a null ID when the request's
+// ID could not be read
+func errorResponse(id json.RawMessage, err *RPCError) rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return rpcResponse{JSONRPC: "2.0", ID: id, Error: err}
+}
+
+// toRPCError converts a handler error to a JSON-RPC error object
+func toRPCError(err error) *RPCError {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &RPCError{Code: CodeServerError, Message: err.Error()}
+}
+
+// decodeParams unmarshals params into v, reporting failures as invalid params
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return &RPCError{Code: CodeInvalidParams, Message: "params are required"}
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &RPCError{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid params: %v", err)}
+	}
+	return nil
+}
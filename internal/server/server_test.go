@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServeConn(t *testing.T) {
+	handle := func(_ context.Context, method string, params json.RawMessage) (interface{}, error) {
+		switch method {
+		case "echo":
+			var v map[string]string
+			if err := decodeParams(params, &v); err != nil {
+				return nil, err
+			}
+			return v, nil
+		case "fail":
+			return nil, errors.New("boom")
+		default:
+			return nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + method}
+		}
+	}
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"a":"b"}}`,
+		`not json`,
+		`{"jsonrpc":"2.0","id":"x","method":"fail"}`,
+		`{"jsonrpc":"2.0","method":"echo","params":{}}`, // notification, no response
+		`{"jsonrpc":"1.0","id":2,"method":"echo"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"nope"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"echo"}`,
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	if err := serveConn(context.Background(), strings.NewReader(input), &out, handle, false); err != nil {
+		t.Fatalf("serveConn() error = %v", err)
+	}
+
+	// Requests run concurrently, so compare without regard to order
+	want := []string{
+		`{"jsonrpc":"2.0","id":1,"result":{"a":"b"}}`,
+		`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`,
+		`{"jsonrpc":"2.0","id":"x","error":{"code":-32000,"message":"boom"}}`,
+		`{"jsonrpc":"2.0","id":2,"error":{"code":-32600,"message":"invalid request"}}`,
+		`{"jsonrpc":"2.0","id":3,"error":{"code":-32601,"message":"method not found: nope"}}`,
+		`{"jsonrpc":"2.0","id":4,"error":{"code":-32602,"message":"params are required"}}`,
+	}
+	got := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("got %d responses, want %d:\n%s", len(got), len(want), out.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("response %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestServeConn_Cancel(t *testing.T) {
+	started := make(chan struct{})
+	handle := func(ctx context.Context, method string, _ json.RawMessage) (interface{}, error) {
+		if method == "slow" {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return "ok", nil
+	}
+
+	r, w := io.Pipe()
+	var out safeBuffer
+	done := make(chan error, 1)
+	go func() {
+		done <- serveConn(context.Background(), r, &out, handle, false)
+	}()
+
+	fmt.Fprintln(w, `{"jsonrpc":"2.0","id":"a","method":"slow"}`)
+	<-started
+
+	// Other requests are answered while "a" is still running
+	fmt.Fprintln(w, `{"jsonrpc":"2.0","id":"b","method":"fast"}`)
+	// An ID that is still in use is refused, and "a" stays cancelable
+	fmt.Fprintln(w, `{"jsonrpc":"2.0","id":"a","method":"fast"}`)
+	fmt.Fprintln(w, `{"jsonrpc":"2.0","id":"c","method":"cancel","params":{"id":"a"}}`)
+	fmt.Fprintln(w, `{"jsonrpc":"2.0","id":"d","method":"cancel","params":{"id":"zzz"}}`)
+	w.Close()
+
+	if err := <-done; err != nil {
+		t.Fatalf("serveConn() error = %v", err)
+	}
+
+	for _, want := range []string{
+		`{"jsonrpc":"2.0","id":"b","result":"ok"}`,
+		`{"jsonrpc":"2.0","id":"a","error":{"code":-32600,"message":"a request with this id is still running"}}`,
+		`{"jsonrpc":"2.0","id":"c","result":{"canceled":true}}`,
+		`{"jsonrpc":"2.0","id":"d","result":{"canceled":false}}`,
+		`{"jsonrpc":"2.0","id":"a","error":{"code":-32800,"message":"request canceled"}}`,
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("missing response %s in:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestServeConn_ContentLength(t *testing.T) {
+	handle := func(_ context.Context, _ string, _ json.RawMessage) (interface{}, error) {
+		return "pong", nil
+	}
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	input := fmt.Sprintf("Content-Length: %d\r\nContent-Type: application/json\r\n\r\n%s", len(body), body)
+
+	var out strings.Builder
+	if err := serveConn(context.Background(), strings.NewReader(input), &out, handle, false); err != nil {
+		t.Fatalf("serveConn() error = %v", err)
+	}
+
+	resp := `{"jsonrpc":"2.0","id":1,"result":"pong"}`
+	want := fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(resp), resp)
+	if out.String() != want {
+		t.Errorf("output = %q, want %q", out.String(), want)
+	}
+}
+
+// safeBuffer is a strings.Builder that can be written and read concurrently
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestCache(t *testing.T) {
+	c := newCache(2)
+	now := time.Now()
+
+	c.put("a", 1, time.Minute, now)
+	if v, ok := c.get("a", now); !ok || v != 1 {
+		t.Errorf("get(a) = %v, %v, want 1, true", v, ok)
+	}
+
+	// Expired entries are not returned
+	if _, ok := c.get("a", now.Add(2*time.Minute)); ok {
+		t.Error("get(a) should miss after expiry")
+	}
+
+	// A full cache evicts the entry closest to expiring
+	c.put("b", 2, time.Minute, now)
+	c.put("c", 3, 2*time.Minute, now)
+	c.put("d", 4, time.Minute, now)
+	if _, ok := c.get("b", now); ok {
+		t.Error("get(b) should miss after eviction")
+	}
+	if _, ok := c.get("c", now); !ok {
+		t.Error("get(c) should hit")
+	}
+	if c.len() != 2 {
+		t.Errorf("len() = %d, want 2", c.len())
+	}
+
+	c.clear()
+	if c.len() != 0 {
+		t.Errorf("len() after clear = %d, want 0", c.len())
+	}
+}
+
+func TestSocketPath(t *testing.T) {
+	t.Setenv("LINESENSE_SOCKET", "")
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	if got := SocketPath(); got != "/run/user/1000/linesense.sock" {
+		t.Errorf("SocketPath() = %s, want /run/user/1000/linesense.sock", got)
+	}
+
+	t.Setenv("LINESENSE_SOCKET", "/custom/ls.sock")
+	if got := SocketPath(); got != "/custom/ls.sock" {
+		t.Errorf("SocketPath() = %s, want /custom/ls.sock", got)
+	}
+}
+
+func TestDaemonRoundTrip(t *testing.T) {
+	// Keep the path short; Unix socket paths are limited to about 100 bytes
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "run", "d.sock")
+
+	if _, err := Dial(path, ""); err == nil {
+		t.Fatal("Dial() should fail when no daemon is running")
+	}
+
+	listener, err := Listen(path)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	// A second daemon on the same socket is refused
+	if _, err := Listen(path); err == nil {
+		t.Error("Listen() should fail while a daemon is running")
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(context.Background(), listener, NewService("1.2.3"))
+	}()
+
+	client, err := Dial(path, "1.2.3")
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+
+	// A daemon running another version is skipped
+	if _, err := Dial(path, "1.2.4"); err == nil {
+		t.Error("Dial() should fail when the daemon runs another version")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.Version != "1.2.3" {
+		t.Errorf("Version = %s, want 1.2.3", status.Version)
+	}
+
+	var rpcErr *RPCError
+	var unavailable *UnavailableError
+	if err := client.Call(ctx, "nope", struct{}{}, nil); !errors.As(err, &rpcErr) || rpcErr.Code != CodeMethodNotFound || !errors.As(err, &unavailable) {
+		t.Errorf("Call(nope) error = %v, want method not found from an unavailable daemon", err)
+	}
+	if err := client.Call(ctx, "suggest", map[string]string{}, nil); !errors.As(err, &rpcErr) || rpcErr.Code != CodeInvalidParams || errors.As(err, &unavailable) {
+		t.Errorf("Call(suggest) without context error = %v, want invalid params", err)
+	}
+
+	if err := client.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Serve() did not return after shutdown")
+	}
+
+	// Calls to a daemon that stopped after Dial can be retried in process
+	if _, err := client.Status(ctx); !errors.As(err, &unavailable) {
+		t.Errorf("Status() after shutdown error = %v, want the daemon unavailable", err)
+	}
+}
+
+func TestListen_InsecureDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Listen(filepath.Join(dir, "d.sock")); err == nil {
+		t.Error("Listen() should refuse a directory other users can read")
+	}
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/traves/linesense/internal/ai"
+	"github.com/traves/linesense/internal/config"
+	"github.com/traves/linesense/internal/core"
+)
+
+// Cache lifetimes for responses that are safe to reuse. Suggestions and fixes
+// are never cached so asking again gives fresh alternatives.
+const (
+	explainCacheTTL  = 10 * time.Minute
+	completeCacheTTL = 30 * time.Second
+	maxCacheEntries  = 256
+)
+
+// SuggestResult is the result of the suggest method, shaped like the output
+// of `linesense suggest --format json`
+type SuggestResult struct {
+	Suggestions []core.Suggestion `json:"suggestions"`
+}
+
+// FixResult is the result of the fix method, shaped like the output of
+// `linesense fix --format json`
+type FixResult struct {
+	Command     string            `json:"command"`
+	Suggestions []core.Suggestion `json:"suggestions"`
+}
+
+// StatusResult describes a running daemon
+type StatusResult struct {
+	Version      string `json:"version"`
+	PID          int    `json:"pid"`
+	Uptime       string `json:"uptime"`
+	Requests     int64  `json:"requests"`
+	CacheEntries int    `json:"cache_entries"`
+}
+
+// Service answers requests using state that outlives a single CLI run: the
+// loaded configs, detected OS facts, a provider whose HTTP client keeps its
+// connections alive, and a response cache
+type Service struct {
+	version  string
+	started  time.Time
+	requests atomic.Int64
+	cache    *cache
+
+	mu       sync.Mutex
+	cfg      *config.Config
+	provider core.Provider
+	stamps   map[string]time.Time // modification times of the files cfg was loaded from
+	gen      int                  // bumped on every reload, part of each cache key
+	shutdown func()
+
+	osOnce sync.Once
+	osInfo core.ContextEnvelope // only OS, Distribution and PackageManager are set
+
+	requestOnly bool // see LimitContextToRequest
+}
+
+// NewService creates a service reporting the given version
+func NewService(version string) *Service {
+	return &Service{
+		version: version,
+		started: time.Now(),
+		cache:   newCache(maxCacheEntries),
+	}
+}
+
+// LimitContextToRequest makes the service use only the context sent with each
+// request, plus the OS facts. It is meant for clients that aren't the local
+// user, such as those of the HTTP API, which must not see the local user's
+// git state, shell history, environment or working directory.
+func (s *Service) LimitContextToRequest() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requestOnly = true
+}
+
+// Call runs a single method with JSON-encoded params
+func (s *Service) Call(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	s.requests.Add(1)
+
+	switch method {
+	case "suggest":
+		var input core.SuggestInput
+		if err := decodeParams(params, &input); err != nil {
+			return nil, err
+		}
+		engine, err := s.engine(input.Context)
+		if err != nil {
+			return nil, err
+		}
+		suggestions, err := engine.Suggest(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		return SuggestResult{Suggestions: suggestions}, nil
+
+	case "explain":
+		var input core.ExplainInput
+		if err := decodeParams(params, &input); err != nil {
+			return nil, err
+		}
+		engine, err := s.engine(input.Context)
+		if err != nil {
+			return nil, err
+		}
+		return s.cached(method, params, explainCacheTTL, func() (interface{}, error) {
+			return engine.Explain(ctx, input)
+		})
+
+	case "fix":
+		var input core.FixInput
+		if err := decodeParams(params, &input); err != nil {
+			return nil, err
+		}
+		engine, err := s.engine(input.Context)
+		if err != nil {
+			return nil, err
+		}
+		suggestions, err := engine.Fix(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		return FixResult{Command: input.Command, Suggestions: suggestions}, nil
+
+	case "complete":
+		var input core.CompleteInput
+		if err := decodeParams(params, &input); err != nil {
+			return nil, err
+		}
+		engine, err := s.engine(input.Context)
+		if err != nil {
+			return nil, err
+		}
+		return s.cached(method, params, completeCacheTTL, func() (interface{}, error) {
+			return engine.Complete(ctx, input)
+		})
+
+	case "status":
+		return StatusResult{
+			Version:      s.version,
+			PID:          os.Getpid(),
+			Uptime:       time.Since(s.started).Round(time.Second).String(),
+			Requests:     s.requests.Load(),
+			CacheEntries: s.cache.len(),
+		}, nil
+
+	case "shutdown":
+		s.mu.Lock()
+		shutdown := s.shutdown
+		s.mu.Unlock()
+		if shutdown == nil {
+			return nil, &RPCError{Code: CodeServerError, Message: "shutdown is not supported by this server"}
+		}
+		shutdown()
+		return struct{}{}, nil
+
+	default:
+		return nil, &RPCError{Code: CodeMethodNotFound, Message: fmt.Sprintf("method not found: %s", method)}
+	}
+}
+
+// cached returns the cached result for method and params, or runs fn and
+// caches its result for ttl if it succeeds
+func (s *Service) cached(method string, params json.RawMessage, ttl time.Duration, fn func() (interface{}, error)) (interface{}, error) {
+	s.mu.Lock()
+	key := method + "\x00" + strconv.Itoa(s.gen) + "\x00" + string(params)
+	s.mu.Unlock()
+
+	if value, ok := s.cache.get(key, time.Now()); ok {
+		return value, nil
+	}
+
+	value, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(key, value, ttl, time.Now())
+	return value, nil
+}
+
+// onShutdown registers fn to be called by the shutdown method
+func (s *Service) onShutdown(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutdown = fn
+}
+
+// engine reloads the configs if they changed on disk, prepares env with the
+// cached OS facts and returns an engine for the current config
+func (s *Service) engine(env *core.ContextEnvelope) (*core.Engine, error) {
+	if env == nil {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: "context is required"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reloadLocked(); err != nil {
+		return nil, err
+	}
+
+	// Editor integrations may leave out the directory they run in
+	if env.CWD == "" && !s.requestOnly {
+		if cwd, err := os.Getwd(); err == nil {
+			env.CWD = cwd
+		}
+	}
+
+	// Environment variables are only shared with the model when enabled
+	if !s.cfg.Context.IncludeEnv {
+		env.Env = nil
+	}
+
+	// OS facts don't change while the daemon runs
+	s.osOnce.Do(func() {
+		s.osInfo = core.ContextEnvelope{
+			OS:             core.DetectOS(),
+			Distribution:   core.DetectDistribution(),
+			PackageManager: core.DetectPackageManager(),
+		}
+	})
+	if env.OS == "" {
+		env.OS = s.osInfo.OS
+	}
+	if env.Distribution == "" {
+		env.Distribution = s.osInfo.Distribution
+	}
+	if env.PackageManager == "" {
+		env.PackageManager = s.osInfo.PackageManager
+	}
+
+	engine := core.NewEngine(s.cfg, s.provider)
+	if s.requestOnly {
+		engine.LimitContextToRequest()
+	}
+	return engine, nil
+}
+
+// reloadLocked loads the configs and API key on first use and again whenever
+// one of their files changes. The caller holds s.mu.
+func (s *Service) reloadLocked() error {
+	configDir := config.GetConfigDir()
+	paths := []string{
+		filepath.Join(configDir, "config.toml"),
+		filepath.Join(configDir, "providers.toml"),
+		filepath.Join(configDir, ".env"),
+	}
+
+	stamps := make(map[string]time.Time, len(paths))
+	changed := s.cfg == nil
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = info.ModTime()
+		}
+		if !stamps[path].Equal(s.stamps[path]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	// A new API key set with `config set-key` replaces the one loaded at startup
+	if s.cfg != nil {
+		if _, ok := stamps[paths[2]]; ok {
+			_ = godotenv.Overload(paths[2])
+		}
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	s.cfg = cfg
+	s.provider = ai.LoadProvider(cfg.AI.ProviderProfile)
+	s.stamps = stamps
+	s.gen++
+	s.cache.clear()
+	return nil
+}
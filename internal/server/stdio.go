@@ -0,0 +1,17 @@
+package server
+
+import (
+	"context"
+	"io"
+)
+
+// ServeStdio answers JSON-RPC requests read from r, writing responses to w,
+// until r reaches EOF or a client calls the shutdown method. Requests that
+// are still running at EOF are allowed to finish.
+func ServeStdio(ctx context.Context, r io.Reader, w io.Writer, svc *Service) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	svc.onShutdown(cancel)
+
+	return serveConn(ctx, r, w, svc.Call, false)
+}
@@ -0,0 +1,188 @@
+package scripts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keystroke is one key press: a base key and its modifiers
+type keystroke struct {
+	ctrl bool
+	alt  bool
+	key  string // a single printable character, or "space", "tab", "enter" or "escape"
+}
+
+// keyNames maps the accepted names of non-printing keys to their canonical name
+var keyNames = map[string]string{
+	"space":  "space",
+	"tab":    "tab",
+	"enter":  "enter",
+	"return": "enter",
+	"esc":    "escape",
+	"escape": "escape",
+}
+
+// parseKeys parses a keybinding such as "ctrl+space", "alt+a" or
+// "ctrl+x ctrl+e" (a sequence of keystrokes separated by spaces or commas)
+func parseKeys(spec string) ([]keystroke, error) {
+	fields := strings.FieldsFunc(spec, func(r rune) bool { return r == ' ' || r == ',' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty keybinding")
+	}
+
+	keys := make([]keystroke, 0, len(fields))
+	for _, field := range fields {
+		parts := strings.Split(field, "+")
+		var k keystroke
+		for _, mod := range parts[:len(parts)-1] {
+			switch strings.ToLower(mod) {
+			case "ctrl", "control":
+				k.ctrl = true
+			case "alt", "meta", "option":
+				k.alt = true
+			default:
+				return nil, fmt.Errorf("unsupported modifier %q in %q", mod, spec)
+			}
+		}
+
+		base := parts[len(parts)-1]
+		if name, ok := keyNames[strings.ToLower(base)]; ok {
+			k.key = name
+		} else if len(base) == 1 && base[0] > ' ' && base[0] < 0x7f {
+			k.key = base
+		} else {
+			return nil, fmt.Errorf("unsupported key %q in %q", base, spec)
+		}
+
+		// Terminals only send control codes for letters and space
+		if k.ctrl {
+			if k.key != "space" && !isLetter(k.key) {
+				return nil, fmt.Errorf("ctrl can only be combined with a letter or space in %q", spec)
+			}
+			k.key = strings.ToLower(k.key)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// KeyNotation translates a keybinding from config.toml, such as
+// "ctrl+space", "alt+a" or "ctrl+x ctrl+e", into the notation the shell's
+// bind command expects: readline escapes for bash, bindkey caret notation
+// for zsh and fish escapes
+func KeyNotation(shell, spec string) (string, error) {
+	keys, err := parseKeys(spec)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	for _, k := range keys {
+		switch shell {
+		case "bash":
+			out.WriteString(bashKey(k))
+		case "zsh":
+			out.WriteString(zshKey(k))
+		case "fish":
+			// Fish can't hold NUL in a string, so the script binds Ctrl+Space by name
+			if k.ctrl && k.key == "space" {
+				if len(keys) > 1 {
+					return "", fmt.Errorf("ctrl+space can't be part of a key sequence in fish")
+				}
+				return "ctrl-space", nil
+			}
+			out.WriteString(fishKey(k))
+		default:
+			return "", fmt.Errorf("unsupported shell: %s", shell)
+		}
+	}
+	return out.String(), nil
+}
+
+// bashKey renders a keystroke in readline notation
+func bashKey(k keystroke) string {
+	prefix := ""
+	if k.alt {
+		prefix = `\e`
+	}
+	if k.ctrl {
+		if k.key == "space" {
+			return prefix + `\C-@`
+		}
+		return prefix + `\C-` + k.key
+	}
+
+	switch k.key {
+	case "space":
+		return prefix + " "
+	case "tab":
+		return prefix + `\t`
+	case "enter":
+		return prefix + `\C-m`
+	case "escape":
+		return prefix + `\e`
+	case `"`, `\`:
+		return prefix + `\` + k.key
+	}
+	return prefix + k.key
+}
+
+// zshKey renders a keystroke in bindkey caret notation
+func zshKey(k keystroke) string {
+	prefix := ""
+	if k.alt {
+		prefix = "^["
+	}
+	if k.ctrl {
+		if k.key == "space" {
+			return prefix + "^ "
+		}
+		return prefix + "^" + strings.ToUpper(k.key)
+	}
+
+	switch k.key {
+	case "space":
+		return prefix + " "
+	case "tab":
+		return prefix + "^I"
+	case "enter":
+		return prefix + "^M"
+	case "escape":
+		return prefix + "^["
+	case "^", `\`:
+		return prefix + `\` + k.key
+	}
+	return prefix + k.key
+}
+
+// fishKey renders a keystroke as fish escapes, quoting characters that are
+// special in an unquoted fish word
+func fishKey(k keystroke) string {
+	prefix := ""
+	if k.alt {
+		prefix = `\e`
+	}
+	if k.ctrl {
+		return prefix + `\c` + k.key
+	}
+
+	switch k.key {
+	case "space":
+		return prefix + `\ `
+	case "tab":
+		return prefix + `\t`
+	case "enter":
+		return prefix + `\r`
+	case "escape":
+		return prefix + `\e`
+	}
+	if strings.ContainsAny(k.key, `\'"$;#&|<>(){}[]*?~%`) {
+		return prefix + `\` + k.key
+	}
+	return prefix + k.key
+}
+
+// isLetter reports whether s is a single ASCII letter
+func isLetter(s string) bool {
+	return len(s) == 1 && (s[0] >= 'a' && s[0] <= 'z' || s[0] >= 'A' && s[0] <= 'Z')
+}
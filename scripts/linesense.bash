@@ -1,7 +1,7 @@
 #!/usr/bin/env bash
 # LineSense bash integration
-# Source this file in your ~/.bashrc:
-#   source /path/to/linesense.bash
+# Load it from your ~/.bashrc:
+#   eval "$(linesense init bash)"
 
 # Check if linesense is available
 if ! command -v linesense &> /dev/null; then
@@ -9,7 +9,102 @@ if ! command -v linesense &> /dev/null; then
     return 1
 fi
 
+# Read the first suggestion's command and risk from linesense JSON output
+# into _linesense_suggestion and _linesense_risk
+_linesense_parse_first_suggestion() {
+    local json="$1"
+    _linesense_suggestion=
+    _linesense_risk=
+
+    if command -v jq &> /dev/null; then
+        _linesense_suggestion=$(jq -r '.suggestions[0].command // empty' <<< "$json" 2>/dev/null)
+        _linesense_risk=$(jq -r '.suggestions[0].risk // empty' <<< "$json" 2>/dev/null)
+        return
+    fi
+
+    # Without jq, match the first command and risk inside the suggestions list
+    json="${json#*\"suggestions\"}"
+    local command_re='"command":[[:space:]]*"(([^"\\]|\\.)*)"'
+    local risk_re='"risk":[[:space:]]*"([a-z]*)"'
+    if [[ "$json" =~ $command_re ]]; then
+        local value="${BASH_REMATCH[1]}" amp='&'
+        value="${value//\\u003c/<}"
+        value="${value//\\u003e/>}"
+        value="${value//\\u0026/"$amp"}"
+        value="${value//\\\"/\"}"
+        value="${value//\\\\/\\}"
+        _linesense_suggestion="$value"
+    fi
+    if [[ "$json" =~ $risk_re ]]; then
+        _linesense_risk="${BASH_REMATCH[1]}"
+    fi
+}
+
+# Print why the first suggestion in linesense JSON output is high risk, one
+# reason per finding joined with "; "
+_linesense_high_risk_reasons() {
+    local json="$1"
+    if command -v jq &> /dev/null; then
+        jq -r '[.suggestions[0].findings[]? | select(.severity == "high") | .reason] | join("; ")' <<< "$json" 2>/dev/null
+        return
+    fi
+
+    # Without jq, take the reason that follows the first high severity
+    local reason_re='"severity":[[:space:]]*"high",[[:space:]]*"reason":[[:space:]]*"(([^"\\]|\\.)*)"'
+    if [[ "$json" =~ $reason_re ]]; then
+        local value="${BASH_REMATCH[1]}"
+        value="${value//\\\"/\"}"
+        printf '%s\n' "$value"
+    fi
+}
+
+# Replace the readline buffer with a linesense result, leaving it untouched
+# unless the command succeeded and returned a suggestion
+_linesense_replace_line() {
+    local result="$1"
+    [ -z "$result" ] && return 1
+
+    _linesense_parse_first_suggestion "$result"
+    if [[ -z "$_linesense_suggestion" || "$_linesense_suggestion" == "null" ]]; then
+        return 1
+    fi
+
+    # Show risk indicator for high-risk commands
+    if [[ "$_linesense_risk" == "high" ]]; then
+        local reasons
+        reasons=$(_linesense_high_risk_reasons "$result")
+        if [[ -n "$reasons" ]]; then
+            echo "⚠️  WARNING: High-risk command: $reasons" >&2
+        else
+            echo "⚠️  WARNING: High-risk command detected!" >&2
+        fi
+    fi
+
+    # Record a risky suggestion, and the overrides that loosened it, before
+    # it is put on the line; the picker has already recorded the one it
+    # returned
+    if [[ "${LINESENSE_PICKER:-0}" != "1" && ( "$_linesense_risk" == "medium" || "$_linesense_risk" == "high" || "$result" == *'"overrides"'* ) ]]; then
+        printf '%s' "$result" | linesense audit record --cwd "$PWD" || return 1
+    fi
+
+    # READLINE_POINT counts bytes in older bash releases; a byte count also
+    # lands at the end of the line where it counts characters
+    local LC_ALL=C
+    READLINE_LINE="$_linesense_suggestion"
+    READLINE_POINT=${#READLINE_LINE}
+}
+
+# Add --histfile "$HISTFILE" to the caller's args, unless the hooks below
+# record this shell's history: an explicit history file takes precedence
+# over the recorded one, which also has exit codes
+_linesense_add_histfile() {
+    if [[ -z "$_linesense_recording" ]]; then
+        args+=(--histfile "$HISTFILE")
+    fi
+}
+
 # Function to request a suggestion from linesense
+# Set LINESENSE_PICKER=1 to choose between suggestions instead of taking the first
 _linesense_request() {
     local current_line="$READLINE_LINE"
     local cwd="$PWD"
@@ -19,14 +114,28 @@ _linesense_request() {
         return
     fi
 
-    # Clear line and show the pretty output
+    # Flush this session's commands so linesense sees them
+    history -a
+
+    local args=(suggest --shell bash --line "$current_line" --cwd "$cwd" --format json)
+    _linesense_add_histfile
+    if [[ "${LINESENSE_PICKER:-0}" == "1" ]]; then
+        args+=(--interactive)
+    fi
+
+    # Progress, the picker and errors go to stderr; only JSON is captured
     echo "" >&2
+    local result
+    result=$(linesense "${args[@]}") || return
 
-    # Call linesense suggest with pretty format
-    linesense suggest --shell bash --line "$current_line" --cwd "$cwd" --format pretty
+    _linesense_replace_line "$result"
+}
 
-    # Note: We display the suggestions but don't auto-replace the line
-    # User can manually copy the command they want
+# Function to choose between suggestions in the picker, whatever
+# LINESENSE_PICKER is set to
+_linesense_alternatives() {
+    local LINESENSE_PICKER=1
+    _linesense_request
 }
 
 # Function to explain the current command
@@ -43,20 +152,132 @@ _linesense_explain() {
     echo "" >&2
 
     # Call linesense explain with pretty format
-    linesense explain --shell bash --line "$current_line" --cwd "$cwd" --format pretty
+    local args=(explain --shell bash --line "$current_line" --cwd "$cwd" --format pretty)
+    _linesense_add_histfile
+    linesense "${args[@]}"
+}
+
+# Function to replace the line with a fix for the last failed command
+_linesense_fix() {
+    local cwd="$PWD"
+
+    local args=(fix --shell bash --cwd "$cwd" --format json)
+    _linesense_add_histfile
+    if [[ "${LINESENSE_PICKER:-0}" == "1" ]]; then
+        args+=(--interactive)
+    fi
+
+    echo "" >&2
+    local result
+    result=$(linesense "${args[@]}") || return
+
+    _linesense_replace_line "$result"
+}
+
+# Exit-code-aware history
+# After each command, append the command, exit code, cwd, duration and start
+# time to LineSense's own history so suggestions know what failed. Commands
+# hidden from bash history (e.g. by HISTCONTROL=ignorespace) are not recorded.
+# Disable by setting LINESENSE_RECORD_HISTORY=0 before sourcing this file.
+_linesense_history_file="${XDG_CONFIG_HOME:-$HOME/.config}/linesense/history.jsonl"
+_linesense_last_histnum=
+_linesense_cmd_start=
+
+# Escape a string for use inside a JSON string literal; result in REPLY
+_linesense_json_escape() {
+    local s="$1" nl=$'\n' tab=$'\t' cr=$'\r'
+    s="${s//\\/\\\\}"
+    s="${s//\"/\\\"}"
+    s="${s//$nl/\\n}"
+    s="${s//$tab/\\t}"
+    s="${s//$cr/\\r}"
+    REPLY="$s"
+}
+
+_linesense_record_history() {
+    local exit_code=$?
+    local start="$_linesense_cmd_start"
+    _linesense_cmd_start=
+
+    # Where PS0 is supported it marks that a command actually ran; pressing
+    # Enter on an empty line does not expand it
+    if [[ -n "$_linesense_ps0" && -z "$start" ]]; then
+        return $exit_code
+    fi
+
+    local entry
+    entry=$(HISTTIMEFORMAT= builtin history 1)
+    if [[ ! "$entry" =~ ^[[:space:]]*([0-9]+)[*]?[[:space:]]+(.*)$ ]]; then
+        return $exit_code
+    fi
+    local histnum="${BASH_REMATCH[1]}" command="${BASH_REMATCH[2]}"
+
+    # The same history number means the command was not added to history
+    if [[ "$histnum" == "$_linesense_last_histnum" ]]; then
+        return $exit_code
+    fi
+    _linesense_last_histnum="$histnum"
+
+    local now="$EPOCHSECONDS"
+    if [[ -z "$now" ]]; then
+        printf -v now '%(%s)T' -1 2>/dev/null || now=$(date +%s)
+    fi
+
+    local duration=
+    if [[ -n "$start" ]]; then
+        duration=$((SECONDS - start))
+    fi
+
+    local command_json cwd_json
+    _linesense_json_escape "$command"; command_json="$REPLY"
+    _linesense_json_escape "$PWD"; cwd_json="$REPLY"
+
+    printf '{"command":"%s","exit_code":%d,"cwd":"%s","duration":%s,"timestamp":%d,"shell":"bash"}\n' \
+        "$command_json" "$exit_code" "$cwd_json" "${duration:-null}" "$((now - ${duration:-0}))" \
+        >> "$_linesense_history_file" 2>/dev/null
+
+    return $exit_code
 }
 
+if [[ "${LINESENSE_RECORD_HISTORY:-1}" != "0" ]]; then
+    _linesense_recording=1
+    mkdir -p "${_linesense_history_file%/*}" 2>/dev/null
+
+    # PS0 (bash 4.4+) is expanded right before a command runs; the arithmetic
+    # records the start time without spawning a subshell
+    if (( BASH_VERSINFO[0] > 4 || (BASH_VERSINFO[0] == 4 && BASH_VERSINFO[1] >= 4) )); then
+        _linesense_ps0=1
+        PS0="${PS0}"'${_linesense_ps0:0:$((_linesense_cmd_start=SECONDS, 0))}'
+    fi
+
+    # Run first so $? is still the exit code of the user's command
+    if [[ "$PROMPT_COMMAND" != *_linesense_record_history* ]]; then
+        PROMPT_COMMAND="_linesense_record_history${PROMPT_COMMAND:+; $PROMPT_COMMAND}"
+    fi
+fi
+
 # Default keybindings
-# Override these by setting environment variables before sourcing this file:
-#   export LINESENSE_SUGGEST_KEY="\C-s"  # Ctrl+S for suggest
-#   export LINESENSE_EXPLAIN_KEY="\C-h"  # Ctrl+H for explain
+# Override these in the [keybindings] section of config.toml, or by setting
+# environment variables before loading this file:
+#   export LINESENSE_SUGGEST_KEY="\C-s"       # Ctrl+S for suggest
+#   export LINESENSE_EXPLAIN_KEY="\C-h"       # Ctrl+H for explain
+#   export LINESENSE_FIX_KEY="\C-f"           # Ctrl+F for fix
+#   export LINESENSE_ALTERNATIVES_KEY="\ea"   # Alt+A for alternatives
 
 # Suggest keybinding (default: Ctrl+Space)
 # Note: \C-@ is the readline notation for Ctrl+Space (ASCII NUL)
 LINESENSE_SUGGEST_KEY="${LINESENSE_SUGGEST_KEY:-\C-@}"
 bind -x "\"${LINESENSE_SUGGEST_KEY}\": _linesense_request"
 
-# Explain keybinding (default: Ctrl+X)
-LINESENSE_EXPLAIN_KEY="${LINESENSE_EXPLAIN_KEY:-\C-x}"
+# Explain keybinding (default: Ctrl+X Ctrl+E, as in zsh and fish; a plain
+# Ctrl+X would be a prefix of the fix key and wait for keyseq-timeout)
+LINESENSE_EXPLAIN_KEY="${LINESENSE_EXPLAIN_KEY:-\C-x\C-e}"
 bind -x "\"${LINESENSE_EXPLAIN_KEY}\": _linesense_explain"
 
+# Fix keybinding (default: Ctrl+X Ctrl+F)
+LINESENSE_FIX_KEY="${LINESENSE_FIX_KEY:-\C-x\C-f}"
+bind -x "\"${LINESENSE_FIX_KEY}\": _linesense_fix"
+
+# Alternatives keybinding (default: Alt+A)
+LINESENSE_ALTERNATIVES_KEY="${LINESENSE_ALTERNATIVES_KEY:-\ea}"
+bind -x "\"${LINESENSE_ALTERNATIVES_KEY}\": _linesense_alternatives"
@@ -0,0 +1,258 @@
+#!/usr/bin/env fish
+# LineSense fish integration
+# Load it from your ~/.config/fish/config.fish:
+#   linesense init fish | source
+
+# Check if linesense is available
+if not command -q linesense
+    echo "Warning: linesense not found in PATH. Shell integration disabled." >&2
+    return 1
+end
+
+# Extract a string field from linesense JSON output, with a jq-less fallback
+function __linesense_json_field --argument-names json field
+    if command -q jq
+        echo $json | jq -r "$field" 2>/dev/null
+    else
+        set -l key (string replace -r '^.*\.' '' -- $field)
+        # Look inside the suggestions list, past a top-level field of the
+        # same name such as the failed command in fix output
+        if string match -q '.suggestions*' -- $field
+            set json (string replace -r '(?s)^.*?"suggestions"' '' -- $json)
+        end
+        string match -r -g "\"$key\":\s*\"((?:[^\"\\\\]|\\\\.)*)\"" -- $json | head -n 1
+    end
+end
+
+# Warn that the first suggestion in linesense JSON output is high risk, and why
+function __linesense_warn_high_risk --argument-names json
+    set -l reasons
+    if command -q jq
+        set reasons (echo $json | jq -r '[.suggestions[0].findings[]? | select(.severity == "high") | .reason] | join("; ")' 2>/dev/null)
+    else
+        # Findings list the reason right after the severity
+        set reasons (string match -r -g '"severity":\s*"high",\s*"reason":\s*"((?:[^"\\\\]|\\\\.)*)"' -- $json | head -n 1 | string replace -a '\\"' '"')
+    end
+
+    if test -n "$reasons"
+        echo \n"⚠️  WARNING: High-risk command: $reasons" >&2
+    else
+        echo \n"⚠️  WARNING: High-risk command detected!" >&2
+    end
+end
+
+# Record a medium- or high-risk suggestion from linesense JSON output in the
+# audit log, and the overrides that loosened it, before it is put on the
+# command line. The picker has already recorded the suggestion it returned.
+function __linesense_record_accepted --argument-names json risk picker
+    if test "$picker" = 1
+        return 0
+    end
+    if not contains -- "$risk" medium high; and not string match -q '*"overrides"*' -- $json
+        return 0
+    end
+    printf '%s' "$json" | linesense audit record --cwd "$PWD"
+end
+
+# Replace the command line with the first suggestion
+function linesense_suggest
+    __linesense_suggest "$LINESENSE_PICKER"
+end
+
+# Choose between suggestions in the picker, whatever LINESENSE_PICKER is set to
+function linesense_alternatives
+    __linesense_suggest 1
+end
+
+# Request suggestions for the command line, opening the picker if picker is 1
+function __linesense_suggest --argument-names picker
+    set -l current_buffer (commandline -b)
+
+    # Don't suggest for empty buffers
+    if test -z "$current_buffer"
+        return
+    end
+
+    # Call linesense suggest and capture JSON output
+    # Set LINESENSE_PICKER=1 to choose between suggestions instead of taking the first
+    set -l result
+    if test "$picker" = 1
+        # The picker draws on stderr, so leave it connected to the terminal
+        set result (linesense suggest --shell fish --line "$current_buffer" --cwd "$PWD" --format json --interactive | string collect)
+    else
+        set result (linesense suggest --shell fish --line "$current_buffer" --cwd "$PWD" --format json 2>/dev/null | string collect)
+    end
+
+    if test $status -eq 0 -a -n "$result"
+        set -l suggestion (__linesense_json_field "$result" '.suggestions[0].command')
+        set -l risk (__linesense_json_field "$result" '.suggestions[0].risk')
+
+        if test -n "$suggestion" -a "$suggestion" != null
+            # Show risk indicator for high-risk commands
+            if test "$risk" = high
+                __linesense_warn_high_risk "$result"
+            end
+
+            # Replace buffer with suggestion
+            if __linesense_record_accepted "$result" "$risk" "$picker"
+                commandline -r -- $suggestion
+                commandline -f end-of-line
+            end
+        end
+    end
+
+    # Redraw the line
+    commandline -f repaint
+end
+
+# Explain the current command line
+function linesense_explain
+    set -l current_buffer (commandline -b)
+
+    # Don't explain empty buffers
+    if test -z "$current_buffer"
+        return
+    end
+
+    # Call linesense explain and capture JSON output
+    set -l result (linesense explain --shell fish --line "$current_buffer" --cwd "$PWD" --format json 2>/dev/null | string collect)
+
+    if test $status -eq 0 -a -n "$result"
+        set -l summary (__linesense_json_field "$result" '.summary')
+        set -l risk (__linesense_json_field "$result" '.risk')
+
+        # Display formatted explanation
+        echo "" >&2
+        echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━" >&2
+        echo "📝 LineSense Explanation" >&2
+        echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━" >&2
+        echo "" >&2
+        echo "Command: $current_buffer" >&2
+        echo "" >&2
+
+        # Color-code risk level
+        switch $risk
+            case high
+                echo "⚠️  Risk: "(set_color --bold red)"HIGH"(set_color normal) >&2
+            case medium
+                echo "⚠️  Risk: "(set_color --bold yellow)"MEDIUM"(set_color normal) >&2
+            case low
+                echo "✓ Risk: "(set_color --bold green)"LOW"(set_color normal) >&2
+        end
+
+        echo "" >&2
+        echo $summary >&2
+        echo "" >&2
+        echo "━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━" >&2
+        echo "" >&2
+    else
+        echo "❌ Failed to get explanation" >&2
+    end
+
+    # Redraw the line
+    commandline -f repaint
+end
+
+# Replace the command line with a fix for the last failed command
+function linesense_fix
+    set -l result
+    if test "$LINESENSE_PICKER" = 1
+        set result (linesense fix --shell fish --cwd "$PWD" --format json --interactive | string collect)
+    else
+        set result (linesense fix --shell fish --cwd "$PWD" --format json 2>/dev/null | string collect)
+    end
+
+    if test $status -eq 0 -a -n "$result"
+        set -l suggestion (__linesense_json_field "$result" '.suggestions[0].command')
+        set -l risk (__linesense_json_field "$result" '.suggestions[0].risk')
+
+        if test -n "$suggestion" -a "$suggestion" != null
+            # Show risk indicator for high-risk commands
+            if test "$risk" = high
+                __linesense_warn_high_risk "$result"
+            end
+
+            # Replace buffer with the fixed command
+            if __linesense_record_accepted "$result" "$risk" "$LINESENSE_PICKER"
+                commandline -r -- $suggestion
+                commandline -f end-of-line
+            end
+        end
+    else
+        echo \n"❌ No failed command to fix" >&2
+    end
+
+    # Redraw the line
+    commandline -f repaint
+end
+
+# Exit-code-aware history
+# After each command, append the command, exit code, cwd, duration and start
+# time to LineSense's own history so suggestions know what failed. Commands
+# starting with a space are not recorded.
+# Disable by setting LINESENSE_RECORD_HISTORY=0 before sourcing this file.
+set -g __linesense_history_file (set -q XDG_CONFIG_HOME; and echo $XDG_CONFIG_HOME; or echo $HOME/.config)/linesense/history.jsonl
+
+# Escape a string for use inside a JSON string literal
+function __linesense_json_escape
+    string join \n -- $argv | string replace -a '\\' '\\\\' | string replace -a '"' '\\"' \
+        | string replace -a \t '\\t' | string replace -a \r '\\r' | string join '\\n'
+end
+
+function __linesense_record_history --on-event fish_postexec
+    set -l exit_code $status
+    set -l command $argv[1]
+
+    # Nothing ran (empty line), or the command was meant to stay private
+    if not string length -q -- (string trim -- "$command"); or string match -q ' *' -- "$command"
+        return
+    end
+
+    set -l duration (math --scale=0 "$CMD_DURATION / 1000")
+    set -l start (math (date +%s) - $duration)
+
+    printf '{"command":"%s","exit_code":%d,"cwd":"%s","duration":%d,"timestamp":%d,"shell":"fish"}\n' \
+        (__linesense_json_escape $command) $exit_code (__linesense_json_escape $PWD) $duration $start \
+        >>$__linesense_history_file 2>/dev/null
+end
+
+if test "$LINESENSE_RECORD_HISTORY" = 0
+    functions -e __linesense_record_history
+else
+    mkdir -p (dirname $__linesense_history_file) 2>/dev/null
+end
+
+# Bind key to command; ctrl-space stands for Ctrl+Space, which older fish
+# releases only know as the terminfo key nul
+function __linesense_bind --argument-names key command
+    if test "$key" = ctrl-space
+        bind -k nul $command 2>/dev/null
+        bind ctrl-space $command 2>/dev/null
+    else
+        bind $key $command
+    end
+end
+
+# Default keybindings
+# Override these in the [keybindings] section of config.toml, or by setting
+# variables before loading this file:
+#   set -gx LINESENSE_SUGGEST_KEY \cs        # Ctrl+S for suggest
+#   set -gx LINESENSE_EXPLAIN_KEY \ch        # Ctrl+H for explain
+#   set -gx LINESENSE_FIX_KEY \cf            # Ctrl+F for fix
+#   set -gx LINESENSE_ALTERNATIVES_KEY \ea   # Alt+A for alternatives
+
+# Suggest keybinding (default: Ctrl+Space)
+set -q LINESENSE_SUGGEST_KEY; or set -g LINESENSE_SUGGEST_KEY ctrl-space
+__linesense_bind $LINESENSE_SUGGEST_KEY linesense_suggest
+
+# Explain keybinding (default: Ctrl+X Ctrl+E to match the zsh integration)
+set -q LINESENSE_EXPLAIN_KEY; or set -g LINESENSE_EXPLAIN_KEY \cx\ce
+__linesense_bind $LINESENSE_EXPLAIN_KEY linesense_explain
+
+# Fix keybinding (default: Ctrl+X Ctrl+F)
+set -q LINESENSE_FIX_KEY; or set -g LINESENSE_FIX_KEY \cx\cf
+__linesense_bind $LINESENSE_FIX_KEY linesense_fix
+
+# Alternatives keybinding (default: Alt+A)
+set -q LINESENSE_ALTERNATIVES_KEY; or set -g LINESENSE_ALTERNATIVES_KEY \ea
+__linesense_bind $LINESENSE_ALTERNATIVES_KEY linesense_alternatives
@@ -0,0 +1,87 @@
+// Package scripts embeds the shell integration scripts so that
+// `linesense init <shell>` can print them with the configured keybindings
+package scripts
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+//go:embed linesense.bash linesense.zsh linesense.fish
+var files embed.FS
+
+// Shells lists the shells with an integration script
+var Shells = []string{"bash", "zsh", "fish"}
+
+// Script returns the integration script for shell as shipped
+func Script(shell string) ([]byte, error) {
+	data, err := files.ReadFile("linesense." + shell)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported shell: %s (supported: %s)", shell, strings.Join(Shells, ", "))
+	}
+	return data, nil
+}
+
+// binding ties a configured keybinding to the variable the scripts read
+type binding struct {
+	name string // config key, for error messages
+	env  string
+	spec string
+}
+
+// Generate returns the integration script for shell, preceded by
+// assignments of the LINESENSE_*_KEY variables translated from the
+// configured keybindings. Variables already set in the environment take
+// precedence. Keybindings that can't be translated are reported to warn and
+// left at the script's default.
+func Generate(shell string, keys config.KeybindingsConfig, warn func(error)) ([]byte, error) {
+	script, err := Script(shell)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings := []binding{
+		{"suggest", "LINESENSE_SUGGEST_KEY", keys.Suggest},
+		{"explain", "LINESENSE_EXPLAIN_KEY", keys.Explain},
+		{"fix", "LINESENSE_FIX_KEY", keys.Fix},
+		{"alternatives", "LINESENSE_ALTERNATIVES_KEY", keys.Alternatives},
+	}
+
+	var out strings.Builder
+	for _, b := range bindings {
+		if strings.TrimSpace(b.spec) == "" {
+			continue
+		}
+		notation, err := KeyNotation(shell, b.spec)
+		if err != nil {
+			if warn != nil {
+				warn(fmt.Errorf("keybindings.%s: %w", b.name, err))
+			}
+			continue
+		}
+
+		if out.Len() == 0 {
+			out.WriteString("# Keybindings from config.toml (LINESENSE_*_KEY variables already set win)\n")
+		}
+		if shell == "fish" {
+			// Fish expands the escapes when the assignment runs
+			fmt.Fprintf(&out, "set -q %s; or set -g %s %s\n", b.env, b.env, notation)
+		} else {
+			fmt.Fprintf(&out, "[ -n \"$%s\" ] || %s=%s\n", b.env, b.env, shellQuote(notation))
+		}
+	}
+	if out.Len() > 0 {
+		out.WriteString("\n")
+	}
+
+	out.Write(script)
+	return []byte(out.String()), nil
+}
+
+// shellQuote single-quotes s for bash and zsh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
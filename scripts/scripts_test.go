@@ -0,0 +1,88 @@
+package scripts
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/traves/linesense/internal/config"
+)
+
+func TestKeyNotation(t *testing.T) {
+	tests := []struct {
+		spec string
+		bash string
+		zsh  string
+		fish string
+	}{
+		{"ctrl+space", `\C-@`, "^ ", "ctrl-space"},
+		{"ctrl+e", `\C-e`, "^E", `\ce`},
+		{"Ctrl+T", `\C-t`, "^T", `\ct`},
+		{"alt+a", `\ea`, "^[a", `\ea`},
+		{"ctrl+x ctrl+e", `\C-x\C-e`, "^X^E", `\cx\ce`},
+		{"ctrl+x,ctrl+f", `\C-x\C-f`, "^X^F", `\cx\cf`},
+		{"meta+ctrl+f", `\e\C-f`, "^[^F", `\e\cf`},
+		{"alt+enter", `\e\C-m`, "^[^M", `\e\r`},
+		{"alt+;", `\e;`, "^[;", `\e\;`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			for shell, want := range map[string]string{"bash": tt.bash, "zsh": tt.zsh, "fish": tt.fish} {
+				got, err := KeyNotation(shell, tt.spec)
+				if err != nil {
+					t.Fatalf("KeyNotation(%q, %q) error = %v", shell, tt.spec, err)
+				}
+				if got != want {
+					t.Errorf("KeyNotation(%q, %q) = %q, want %q", shell, tt.spec, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyNotation_Invalid(t *testing.T) {
+	tests := []struct {
+		shell string
+		spec  string
+	}{
+		{"bash", "shift+a"},
+		{"bash", "ctrl+1"},
+		{"zsh", "ctrl+f13"},
+		{"fish", "ctrl+space a"},
+		{"powershell", "ctrl+a"},
+	}
+
+	for _, tt := range tests {
+		if _, err := KeyNotation(tt.shell, tt.spec); err == nil {
+			t.Errorf("KeyNotation(%q, %q) should fail", tt.shell, tt.spec)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	keys := config.KeybindingsConfig{Suggest: "ctrl+t", Alternatives: "bogus+a"}
+
+	var warnings []error
+	script, err := Generate("bash", keys, func(err error) { warnings = append(warnings, err) })
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	out := string(script)
+	if !strings.Contains(out, `[ -n "$LINESENSE_SUGGEST_KEY" ] || LINESENSE_SUGGEST_KEY='\C-t'`) {
+		t.Errorf("script doesn't set the configured suggest key:\n%s", out[:200])
+	}
+	if strings.Contains(out, "|| LINESENSE_EXPLAIN_KEY=") {
+		t.Error("unconfigured keybindings should keep the script default")
+	}
+	if !strings.Contains(out, "_linesense_alternatives") {
+		t.Error("script should include the embedded integration")
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "keybindings.alternatives") {
+		t.Errorf("warnings = %v, want one for keybindings.alternatives", warnings)
+	}
+
+	if _, err := Generate("tcsh", keys, nil); err == nil {
+		t.Error("Generate() should reject unsupported shells")
+	}
+}